@@ -0,0 +1,99 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package addressgroup resolves the CIDRs of the AddressGroups referenced by rules.
+package addressgroup
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	paasv1 "security-group/api/v1"
+)
+
+// DefaultConfigMapKey is the key of the CIDRs in a ConfigMap if none is set.
+const DefaultConfigMapKey string = "cidrs"
+
+// Resolve returns the CIDRs of the named address groups in the namespace. The names of the
+// groups that do not exist are returned separately.
+func Resolve(ctx context.Context, c client.Reader, namespace string, names []string) (map[string][]string, []string, error) {
+	groups := map[string][]string{}
+	var missing []string
+	for _, name := range names {
+		ag := &paasv1.AddressGroup{}
+		if err := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, ag); err != nil {
+			if apierrors.IsNotFound(err) {
+				missing = append(missing, name)
+				continue
+			}
+			return nil, nil, err
+		}
+		cidrs, err := CIDRs(ctx, c, ag)
+		if err != nil {
+			return nil, nil, err
+		}
+		groups[name] = cidrs
+	}
+	return groups, missing, nil
+}
+
+// CIDRs returns the CIDRs of the address group, including those of its ConfigMap, which
+// must be labeled with paasv1.AddressGroupConfigMapLabel.
+func CIDRs(ctx context.Context, c client.Reader, ag *paasv1.AddressGroup) ([]string, error) {
+	cidrs := append([]string{}, ag.Spec.CIDRs...)
+	ref := ag.Spec.ConfigMapRef
+	if ref == nil {
+		return cidrs, nil
+	}
+	cm := &corev1.ConfigMap{}
+	if err := c.Get(ctx, types.NamespacedName{Namespace: ag.Namespace, Name: ref.Name}, cm); err != nil {
+		return nil, fmt.Errorf("address group %s: failed to get ConfigMap %s: %v", ag.Name, ref.Name, err)
+	}
+	// 只读取带标签的 ConfigMap，控制器只监听这些 ConfigMap 的变化
+	if _, ok := cm.Labels[paasv1.AddressGroupConfigMapLabel]; !ok {
+		return nil, fmt.Errorf("address group %s: ConfigMap %s is not labeled %s", ag.Name, ref.Name, paasv1.AddressGroupConfigMapLabel)
+	}
+	key := ref.Key
+	if key == "" {
+		key = DefaultConfigMapKey
+	}
+	value, ok := cm.Data[key]
+	if !ok {
+		return nil, fmt.Errorf("address group %s: ConfigMap %s has no key %s", ag.Name, ref.Name, key)
+	}
+	return append(cidrs, ParseList(value)...), nil
+}
+
+// ParseList splits a list of CIDRs separated by white space or commas. Everything after a #
+// on a line is a comment.
+func ParseList(list string) []string {
+	var cidrs []string
+	for _, line := range strings.Split(list, "\n") {
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		cidrs = append(cidrs, strings.FieldsFunc(line, func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\t' || r == '\r'
+		})...)
+	}
+	return cidrs
+}
@@ -0,0 +1,77 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package addressgroup
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	paasv1 "security-group/api/v1"
+)
+
+func TestParseList(t *testing.T) {
+	got := ParseList(`# partner A
+203.0.113.0/24, 198.51.100.7
+  192.0.2.0/28	# partner B
+
+`)
+	want := []string{"203.0.113.0/24", "198.51.100.7", "192.0.2.0/28"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseList() = %v, want %v", got, want)
+	}
+	if got := ParseList(""); got != nil {
+		t.Errorf("ParseList(\"\") = %v, want nil", got)
+	}
+}
+
+func TestCIDRs(t *testing.T) {
+	configMap := func(name string, labels map[string]string) *corev1.ConfigMap {
+		return &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: name, Labels: labels},
+			Data:       map[string]string{DefaultConfigMapKey: "192.0.2.0/28"},
+		}
+	}
+	c := fake.NewFakeClientWithScheme(scheme.Scheme,
+		configMap("labeled", map[string]string{paasv1.AddressGroupConfigMapLabel: "true"}),
+		configMap("unlabeled", nil),
+	)
+	group := func(configMap string) *paasv1.AddressGroup {
+		return &paasv1.AddressGroup{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "partners"},
+			Spec:       paasv1.AddressGroupSpec{CIDRs: []string{"203.0.113.0/24"}, ConfigMapRef: &paasv1.ConfigMapKeyReference{Name: configMap}},
+		}
+	}
+
+	got, err := CIDRs(context.Background(), c, group("labeled"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"203.0.113.0/24", "192.0.2.0/28"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("CIDRs() = %v, want %v", got, want)
+	}
+	// 不带标签的 ConfigMap 的变化不会触发调谐，拒绝引用
+	if _, err := CIDRs(context.Background(), c, group("unlabeled")); err == nil || !strings.Contains(err.Error(), paasv1.AddressGroupConfigMapLabel) {
+		t.Errorf("CIDRs() error = %v, want an error naming the label", err)
+	}
+}
@@ -0,0 +1,71 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// AddressGroupConfigMapLabel marks the ConfigMaps that AddressGroups may reference. The
+// controller watches their changes, and refuses to read unlabeled ConfigMaps, whose
+// changes it would miss.
+const AddressGroupConfigMapLabel string = "paas.unicom.cn/address-group"
+
+// AddressGroupSpec defines a named list of CIDRs
+type AddressGroupSpec struct {
+	// CIDRs of the group, e.g. "203.0.113.0/24" or a single address.
+	// +optional
+	CIDRs []string `json:"cidrs,omitempty"`
+	// ConfigMapRef adds the CIDRs listed in a key of a ConfigMap in the same namespace. The
+	// ConfigMap must be labeled with paas.unicom.cn/address-group.
+	// +optional
+	ConfigMapRef *ConfigMapKeyReference `json:"configMapRef,omitempty"`
+}
+
+// ConfigMapKeyReference references a key of a ConfigMap. The value lists CIDRs separated
+// by white space or commas. Lines starting with # are comments.
+type ConfigMapKeyReference struct {
+	// Name of the ConfigMap.
+	Name string `json:"name"`
+	// Key of the CIDRs in the ConfigMap. Defaults to "cidrs".
+	// +optional
+	Key string `json:"key,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:shortName=ag
+
+// AddressGroup is the Schema for the addressgroups API
+type AddressGroup struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec AddressGroupSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// AddressGroupList contains a list of AddressGroup
+type AddressGroupList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []AddressGroup `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&AddressGroup{}, &AddressGroupList{})
+}
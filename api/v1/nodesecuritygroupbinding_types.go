@@ -0,0 +1,107 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// NodeSecurityGroupBindingSpec defines the desired state of NodeSecurityGroupBinding
+type NodeSecurityGroupBindingSpec struct {
+	// NodeSelector selects the nodes whose DCS instances the security groups are attached to.
+	NodeSelector metav1.LabelSelector `json:"nodeSelector"`
+	// SecurityGroups are the names of SecurityGroup resources in the same namespace
+	// that are attached to every selected node.
+	SecurityGroups []string `json:"securityGroups"`
+}
+
+// BoundSecurityGroup is a security group attached to a node's DCS instance.
+type BoundSecurityGroup struct {
+	// Name of the SecurityGroup resource.
+	Name string `json:"name"`
+	// Id of the security group in DCS.
+	Id string `json:"id"`
+	// AccountId and UserId are the DCS account the security group was attached with, so
+	// that it can be detached after its SecurityGroup is deleted.
+	// +optional
+	AccountId string `json:"accountId,omitempty"`
+	// +optional
+	UserId string `json:"userId,omitempty"`
+}
+
+// BoundNode records the security groups attached to a node's DCS instance.
+type BoundNode struct {
+	// Name of the node.
+	NodeName string `json:"nodeName"`
+	// InstanceId is the DCS instance parsed from the node's providerID.
+	InstanceId string `json:"instanceId"`
+	// +optional
+	SecurityGroups []BoundSecurityGroup `json:"securityGroups,omitempty"`
+}
+
+// NodeSecurityGroupBindingStatus defines the observed state of NodeSecurityGroupBinding
+type NodeSecurityGroupBindingStatus struct {
+	// Represents the latest available observations of the binding's current state.
+	// +optional
+	Conditions []SecurityGroupCondition `json:"conditions,omitempty"`
+	// Nodes are the nodes whose instances currently have security groups attached.
+	// +optional
+	Nodes []BoundNode `json:"nodes,omitempty"`
+}
+
+// SetConditions sets the supplied conditions, replacing any existing conditions of the same type.
+func (s *NodeSecurityGroupBindingStatus) SetConditions(c ...SecurityGroupCondition) {
+	cs := SecurityGroupStatus{Conditions: s.Conditions}
+	cs.SetConditions(c...)
+	s.Conditions = cs.Conditions
+}
+
+// GetNode returns the bound node with the given name, or nil if it is not bound.
+func (s *NodeSecurityGroupBindingStatus) GetNode(name string) *BoundNode {
+	for i := range s.Nodes {
+		if s.Nodes[i].NodeName == name {
+			return &s.Nodes[i]
+		}
+	}
+	return nil
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:shortName=nsgb
+// +kubebuilder:subresource:status
+
+// NodeSecurityGroupBinding is the Schema for the nodesecuritygroupbindings API
+type NodeSecurityGroupBinding struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   NodeSecurityGroupBindingSpec   `json:"spec,omitempty"`
+	Status NodeSecurityGroupBindingStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// NodeSecurityGroupBindingList contains a list of NodeSecurityGroupBinding
+type NodeSecurityGroupBindingList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []NodeSecurityGroupBinding `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&NodeSecurityGroupBinding{}, &NodeSecurityGroupBindingList{})
+}
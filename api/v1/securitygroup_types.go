@@ -19,6 +19,7 @@ package v1
 import (
 	// "k8s.io/api/core/v1"
 
+	"fmt"
 	"sort"
 	"time"
 
@@ -37,6 +38,196 @@ type SecurityGroupSpec struct {
 	UserId      string `json:"userId"`
 	Name        string `json:"name"`
 	Description string `json:"description,omitempty"`
+	// Rules of the security group. Rules in DCS that are not listed here are removed if
+	// the rules are managed, see ManageRules.
+	// +optional
+	Rules []SecurityGroupRule `json:"rules,omitempty"`
+	// ManageRules makes the controller remove the rules in DCS that the SecurityGroup
+	// does not want. Otherwise the wanted rules are only added. Defaults to true if the
+	// SecurityGroup has rules or a template, so that the rules of SecurityGroups that
+	// predate spec.rules are kept. Set it to true to remove all rules the SecurityGroup
+	// does not want. The rules generated for Services are removed with their Services
+	// either way.
+	// +optional
+	ManageRules *bool `json:"manageRules,omitempty"`
+	// RequireApproval makes every change to the spec wait for an approved
+	// SecurityGroupChangeRequest before it is applied to DCS. Turning it off
+	// is itself a change that must be approved, as are changes to the address groups,
+	// services and Services its rules expand to. Deleting the SecurityGroup deletes its
+	// security group without approval, so restrict who may delete it with RBAC, or use the
+	// CreateOnly policy to keep the security group. Requires the webhooks of the controller.
+	// +optional
+	RequireApproval bool `json:"requireApproval,omitempty"`
+	// Template the description and rules are rendered from. The rules of the spec are
+	// added to the rendered rules and a description in the spec overrides the rendered one.
+	// +optional
+	Template *TemplateReference `json:"template,omitempty"`
+	// Tags of the security group in DCS. The controller adds tags with the name of the
+	// cluster and the namespace, name and UID of the SecurityGroup, whose keys start with
+	// "paas.unicom.cn/" and cannot be used here.
+	// +optional
+	Tags map[string]string `json:"tags,omitempty"`
+	// ManagementPolicy controls what the controller may change in DCS. Full SecurityGroups
+	// are created, updated and deleted. CreateOnly SecurityGroups are created with their
+	// rules if they have no security group yet, and then left to be changed in DCS.
+	// ObserveOnly SecurityGroups only reflect the security group in DCS named by their status
+	// id or adopt annotation. Either way the status is refreshed from DCS. Deleting a
+	// CreateOnly or ObserveOnly SecurityGroup keeps its security group, without the owner
+	// marker and the tags of the controller. Defaults to Full.
+	// +kubebuilder:validation:Enum=Full;CreateOnly;ObserveOnly
+	// +optional
+	ManagementPolicy string `json:"managementPolicy,omitempty"`
+}
+
+// Management policies.
+const (
+	ManagementPolicyFull        string = "Full"
+	ManagementPolicyCreateOnly  string = "CreateOnly"
+	ManagementPolicyObserveOnly string = "ObserveOnly"
+)
+
+// Annotations of SecurityGroups.
+const (
+	// ChangedByAnnotation is set by the webhook to the user who last changed the spec.
+	ChangedByAnnotation string = "paas.unicom.cn/changed-by"
+
+	// PausedAnnotation set to "true" stops all changes to DCS for a SecurityGroup,
+	// including its deletion and attaching it to or detaching it from nodes, until the
+	// annotation is removed.
+	PausedAnnotation string = "paas.unicom.cn/paused"
+
+	// ResyncAnnotation set to a new value, e.g. the current time, makes the controller
+	// reconcile the SecurityGroup and compare it with DCS again right away.
+	ResyncAnnotation string = "paas.unicom.cn/resync"
+)
+
+// Rule directions.
+const (
+	DirectionIngress string = "ingress"
+	DirectionEgress  string = "egress"
+)
+
+// Rule actions.
+const (
+	ActionAllow string = "allow"
+	ActionDeny  string = "deny"
+)
+
+// Rule ethertypes.
+const (
+	EthertypeIPv4 string = "IPv4"
+	EthertypeIPv6 string = "IPv6"
+)
+
+// SecurityGroupRule defines a rule of a SecurityGroup
+type SecurityGroupRule struct {
+	// Direction of the traffic, one of ingress, egress.
+	// +kubebuilder:validation:Enum=ingress;egress
+	Direction string `json:"direction"`
+	// Ethertype of the traffic, one of IPv4, IPv6. Defaults to the family of the CIDR,
+	// or to IPv4 if the rule has no CIDR.
+	// +kubebuilder:validation:Enum=IPv4;IPv6
+	// +optional
+	Ethertype string `json:"ethertype,omitempty"`
+	// Protocol of the traffic, e.g. tcp, udp, icmp, icmpv6. Empty means any protocol.
+	// +optional
+	Protocol string `json:"protocol,omitempty"`
+	// Ports is a single port such as "22" or an inclusive range such as "8000-8080".
+	// Empty means all ports.
+	// +optional
+	Ports string `json:"ports,omitempty"`
+	// Service is the name of a service of the built-in catalog or of a ServiceCatalog,
+	// e.g. "https" or "postgres". The rule applies to each of its protocols and ports.
+	// It cannot be combined with protocol and ports.
+	// +optional
+	Service string `json:"service,omitempty"`
+	// CIDR of the remote address, e.g. "10.0.0.0/16" or "fd00::/64". Empty means any
+	// address of the ethertype.
+	// +optional
+	CIDR string `json:"cidr,omitempty"`
+	// AddressGroup is the name of an AddressGroup in the same namespace. The rule applies to
+	// each of its CIDRs. It cannot be combined with cidr.
+	// +optional
+	AddressGroup string `json:"addressGroup,omitempty"`
+	// +optional
+	Description string `json:"description,omitempty"`
+	// ExpiresAt makes the rule temporary. The rule is removed from DCS at this time,
+	// e.g. "2020-06-01T18:00:00+08:00".
+	// +kubebuilder:validation:Format=date-time
+	// +optional
+	ExpiresAt string `json:"expiresAt,omitempty"`
+	// TTL makes the rule temporary. The rule is removed from DCS this long after it was
+	// first applied, e.g. "1h" or "30m".
+	// +optional
+	TTL string `json:"ttl,omitempty"`
+	// Schedule limits the rule to recurring time windows. The rule is added to DCS when
+	// a window opens and removed when it closes.
+	// +optional
+	Schedule *RuleSchedule `json:"schedule,omitempty"`
+	// Action of the rule, one of allow, deny. Defaults to allow. DCS does not support deny
+	// rules yet, so they are rejected by the webhook and only used by sgctl's analysis.
+	// +kubebuilder:validation:Enum=allow;deny
+	// +optional
+	Action string `json:"action,omitempty"`
+	// Priority orders the rule among the rules of its direction: rules with a lower priority
+	// are evaluated first, and rules without a priority after all rules with one. A priority
+	// can only be used by one rule of each direction. Not supported by DCS yet, see Action.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	Priority int32 `json:"priority,omitempty"`
+	// Stateless turns off connection tracking for the rule, so return traffic needs a rule
+	// of its own. Not supported by DCS yet, see Action.
+	// +optional
+	Stateless bool `json:"stateless,omitempty"`
+}
+
+// RuleSchedule is a recurring time window.
+type RuleSchedule struct {
+	// Cron is when each window opens, in the five-field cron format
+	// "minute hour day-of-month month day-of-week", e.g. "0 1 * * *" for 01:00 every day.
+	Cron string `json:"cron"`
+	// Duration of each window, e.g. "3h".
+	Duration string `json:"duration"`
+	// TimeZone of the cron schedule, e.g. "Asia/Shanghai". Defaults to UTC.
+	// +optional
+	TimeZone string `json:"timeZone,omitempty"`
+}
+
+// Temporary reports whether the rule expires.
+func (r SecurityGroupRule) Temporary() bool {
+	return r.ExpiresAt != "" || r.TTL != ""
+}
+
+func (r SecurityGroupRule) String() string {
+	protocol, ports, cidr := r.Protocol, r.Ports, r.CIDR
+	if protocol == "" {
+		protocol = "any"
+	}
+	if ports == "" {
+		ports = "all"
+	}
+	if r.AddressGroup != "" {
+		cidr = "group:" + r.AddressGroup
+	} else if cidr == "" {
+		cidr = "any"
+		if r.Ethertype == EthertypeIPv6 {
+			cidr = "any6"
+		}
+	}
+	s := fmt.Sprintf("%s %s %s %s", r.Direction, protocol, ports, cidr)
+	if r.Service != "" {
+		s = fmt.Sprintf("%s service:%s %s", r.Direction, r.Service, cidr)
+	}
+	if r.Action == ActionDeny {
+		s += " deny"
+	}
+	if r.Priority != 0 {
+		s += fmt.Sprintf(" priority %d", r.Priority)
+	}
+	if r.Stateless {
+		s += " stateless"
+	}
+	return s
 }
 
 const (
@@ -53,6 +244,15 @@ const (
 	// TypeSynced resources are believed to be in sync with the
 	// Kubernetes resources that manage their lifecycle.
 	TypeSynced string = "Synced"
+
+	// TypePaused resources are not reconciled with DCS.
+	TypePaused string = "Paused"
+
+	// TypeCompliant resources follow every SecurityGroupPolicy that applies to them.
+	TypeCompliant string = "Compliant"
+
+	// TypeApproved resources have their current spec approved by a SecurityGroupChangeRequest.
+	TypeApproved string = "Approved"
 )
 
 // SecurityGroupStatus defines the observed state of SecurityGroup
@@ -61,6 +261,140 @@ type SecurityGroupStatus struct {
 	// +optional
 	Conditions []SecurityGroupCondition `json:"conditions,omitempty"`
 	Id         string                   `json:"id,omitempty"`
+	// Plan is the last set of changes made to the security group in DCS.
+	// +optional
+	Plan *SecurityGroupPlan `json:"plan,omitempty"`
+	// ApprovedSpecHash identifies the last approved spec of a SecurityGroup that requires approval.
+	// +optional
+	ApprovedSpecHash string `json:"approvedSpecHash,omitempty"`
+	// Template is the result of rendering the template of the spec.
+	// +optional
+	Template *RenderedTemplate `json:"template,omitempty"`
+	// TemporaryRules tracks the rules with expiresAt or ttl.
+	// +optional
+	TemporaryRules []TemporaryRule `json:"temporaryRules,omitempty"`
+	// ScheduledRules tracks the rules with a schedule.
+	// +optional
+	ScheduledRules []ScheduledRule `json:"scheduledRules,omitempty"`
+	// Lint lists the rules that have no effect or open too much.
+	// +optional
+	Lint []LintFinding `json:"lint,omitempty"`
+}
+
+// LintFinding is a problem with a rule found by the rule analyzer.
+type LintFinding struct {
+	// Type of the finding, one of Redundant, Shadowed, Permissive.
+	Type string `json:"type"`
+	// Rule the finding is about, e.g. "ingress tcp 22 0.0.0.0/0".
+	Rule string `json:"rule"`
+	// Message explains the finding.
+	Message string `json:"message"`
+}
+
+// ScheduledRule is the state of a rule with a schedule.
+type ScheduledRule struct {
+	// Rule is the traffic of the rule, e.g. "ingress tcp 22 10.0.0.0/8".
+	Rule string `json:"rule"`
+	// Active is true while a window is open and the rule is in DCS.
+	// +optional
+	Active bool `json:"active,omitempty"`
+	// NextTransitionTime is when the window opens or closes next.
+	// +optional
+	NextTransitionTime string `json:"nextTransitionTime,omitempty"`
+}
+
+// GetScheduledRule returns the state of the scheduled rule, or false if it is not tracked.
+func (s *SecurityGroupStatus) GetScheduledRule(rule string) (ScheduledRule, bool) {
+	for _, sr := range s.ScheduledRules {
+		if sr.Rule == rule {
+			return sr, true
+		}
+	}
+	return ScheduledRule{}, false
+}
+
+// TemporaryRule is the lifecycle of a rule with expiresAt or ttl.
+type TemporaryRule struct {
+	// Rule is the traffic of the rule, e.g. "ingress tcp 22 10.0.0.0/8".
+	Rule string `json:"rule"`
+	// AppliedAt is when the rule was first applied to DCS. It is empty until then, and
+	// the ttl of the rule only starts counting once it is set.
+	// +optional
+	AppliedAt string `json:"appliedAt,omitempty"`
+	// ExpiresAt is when the rule is removed from DCS. It is empty for a rule with a ttl
+	// until the rule is applied.
+	// +optional
+	ExpiresAt string `json:"expiresAt,omitempty"`
+	// Expired is true once the rule is removed from DCS.
+	// +optional
+	Expired bool `json:"expired,omitempty"`
+}
+
+// GetTemporaryRule returns the lifecycle of the rule, or false if it is not tracked.
+func (s *SecurityGroupStatus) GetTemporaryRule(rule string) (TemporaryRule, bool) {
+	for _, t := range s.TemporaryRules {
+		if t.Rule == rule {
+			return t, true
+		}
+	}
+	return TemporaryRule{}, false
+}
+
+// SetTemporaryRule replaces the lifecycle of the rule, if it is tracked.
+func (s *SecurityGroupStatus) SetTemporaryRule(t TemporaryRule) {
+	for i := range s.TemporaryRules {
+		if s.TemporaryRules[i].Rule == t.Rule {
+			s.TemporaryRules[i] = t
+		}
+	}
+}
+
+// Planned actions.
+const (
+	PlanActionCreateSecurityGroup string = "CreateSecurityGroup"
+	PlanActionUpdateSecurityGroup string = "UpdateSecurityGroup"
+	PlanActionDeleteSecurityGroup string = "DeleteSecurityGroup"
+	PlanActionCreateRule          string = "CreateRule"
+	PlanActionDeleteRule          string = "DeleteRule"
+)
+
+// SecurityGroupPlan is an ordered list of calls to DCS.
+type SecurityGroupPlan struct {
+	// Changes in the order they are made.
+	Changes []PlannedChange `json:"changes,omitempty"`
+	// Applied is true if the changes were made in DCS.
+	Applied bool `json:"applied"`
+	// The time the plan was computed.
+	Time string `json:"time"`
+}
+
+// PlannedChange is a single call to DCS.
+type PlannedChange struct {
+	// Action is the kind of call, e.g. UpdateSecurityGroup or CreateRule.
+	Action string `json:"action"`
+	// Rule the call creates or deletes.
+	// +optional
+	Rule *SecurityGroupRule `json:"rule,omitempty"`
+	// RuleId is the DCS id of the rule to delete.
+	// +optional
+	RuleId string `json:"ruleId,omitempty"`
+	// Detail describes the call, e.g. the fields a security group update changes.
+	// +optional
+	Detail string `json:"detail,omitempty"`
+}
+
+func (c PlannedChange) String() string {
+	s := c.Action
+	if c.Rule != nil {
+		s += " " + c.Rule.String()
+	}
+	if c.RuleId != "" {
+		s += " (" + c.RuleId + ")"
+	}
+	if c.Detail != "" {
+		s += ": " + c.Detail
+	}
+	return s
 }
 
 // SecurityCondition describes the state of a deployment at a certain point.
@@ -177,6 +511,7 @@ func NewCondition(conditionType, status, reason string) SecurityGroupCondition {
 const (
 	ReasonReconcileSuccess string = "ReconcileSuccess"
 	ReasonReconcileError   string = "ReconcileError"
+	ReasonDrifted          string = "Drifted"
 )
 
 // Reasons a resource is or is not ready.
@@ -188,6 +523,25 @@ const (
 	ReasonDSpecificationChanging string = "Updating"
 )
 
+// Reasons a resource is or is not paused.
+const (
+	ReasonPaused  string = "Paused"
+	ReasonResumed string = "Resumed"
+)
+
+// Reasons a change to a resource is or is not approved.
+const (
+	ReasonApproved         string = "Approved"
+	ReasonAwaitingApproval string = "AwaitingApproval"
+	ReasonRejected         string = "Rejected"
+)
+
+// Reasons a resource does or does not follow the policies.
+const (
+	ReasonCompliant       string = "Compliant"
+	ReasonPolicyViolation string = "PolicyViolation"
+)
+
 // Creating returns a condition that indicates the resource is currently
 // being created.
 func Creating() SecurityGroupCondition {
@@ -256,6 +610,18 @@ func ReconcileSuccess() SecurityGroupCondition {
 	}
 }
 
+// Drifted returns a condition indicating that the resource differs from its spec and the
+// controller does not change it, with the differences as message.
+func Drifted(msg string) SecurityGroupCondition {
+	return SecurityGroupCondition{
+		Type:               TypeSynced,
+		Status:             ConditionFalse,
+		LastTransitionTime: time.Now().Format(time.RFC3339),
+		Reason:             ReasonDrifted,
+		Message:            msg,
+	}
+}
+
 // ReconcileError returns a condition indicating that Crossplane encountered an
 // error while reconciling the resource. This could mean Crossplane was
 // unable to update the resource to reflect its desired state, or that
@@ -270,8 +636,66 @@ func ReconcileError(err error) SecurityGroupCondition {
 	}
 }
 
+// Paused returns a condition indicating that reconciliation of the resource
+// is paused and nothing is changed in DCS.
+func Paused() SecurityGroupCondition {
+	return SecurityGroupCondition{
+		Type:               TypePaused,
+		Status:             ConditionTrue,
+		LastTransitionTime: time.Now().Format(time.RFC3339),
+		Reason:             ReasonPaused,
+	}
+}
+
+// Resumed returns a condition indicating that reconciliation of the resource
+// is no longer paused.
+func Resumed() SecurityGroupCondition {
+	return SecurityGroupCondition{
+		Type:               TypePaused,
+		Status:             ConditionFalse,
+		LastTransitionTime: time.Now().Format(time.RFC3339),
+		Reason:             ReasonResumed,
+	}
+}
+
+// Compliant returns a condition indicating that the resource follows every
+// SecurityGroupPolicy that applies to it.
+func Compliant() SecurityGroupCondition {
+	return SecurityGroupCondition{
+		Type:               TypeCompliant,
+		Status:             ConditionTrue,
+		LastTransitionTime: time.Now().Format(time.RFC3339),
+		Reason:             ReasonCompliant,
+	}
+}
+
+// PolicyViolation returns a condition indicating that the resource violates
+// a SecurityGroupPolicy and is not changed in DCS.
+func PolicyViolation(msg string) SecurityGroupCondition {
+	return SecurityGroupCondition{
+		Type:               TypeCompliant,
+		Status:             ConditionFalse,
+		LastTransitionTime: time.Now().Format(time.RFC3339),
+		Reason:             ReasonPolicyViolation,
+		Message:            msg,
+	}
+}
+
+// Approval returns a condition indicating whether the current spec of the resource
+// is approved, with the reason and the name of the change request as message.
+func Approval(status, reason, changeRequest string) SecurityGroupCondition {
+	return SecurityGroupCondition{
+		Type:               TypeApproved,
+		Status:             status,
+		LastTransitionTime: time.Now().Format(time.RFC3339),
+		Reason:             reason,
+		Message:            changeRequest,
+	}
+}
+
 // +kubebuilder:object:root=true
 // +kubebuilder:resource:shortName=sg
+// +kubebuilder:subresource:status
 
 // SecurityGroup is the Schema for the securitygroups API
 type SecurityGroup struct {
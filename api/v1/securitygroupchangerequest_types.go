@@ -0,0 +1,97 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Decisions on a change request.
+const (
+	DecisionApproved string = "Approved"
+	DecisionRejected string = "Rejected"
+)
+
+// Phases of a change request.
+const (
+	ChangeRequestPending    string = "Pending"
+	ChangeRequestApproved   string = "Approved"
+	ChangeRequestRejected   string = "Rejected"
+	ChangeRequestSuperseded string = "Superseded"
+)
+
+// SecurityGroupChangeRequestSpec defines a change to the spec of a protected SecurityGroup
+type SecurityGroupChangeRequestSpec struct {
+	// SecurityGroup is the name of the changed SecurityGroup in the same namespace.
+	SecurityGroup string `json:"securityGroup"`
+	// SpecHash identifies the changed spec. Only this exact spec is applied when approved.
+	SpecHash string `json:"specHash"`
+	// RequestedBy is the user who last changed the spec.
+	// +optional
+	RequestedBy string `json:"requestedBy,omitempty"`
+	// Changes are the calls to DCS the change makes, computed when it was requested.
+	// +optional
+	Changes []PlannedChange `json:"changes,omitempty"`
+}
+
+// SecurityGroupChangeRequestStatus defines the decision on a SecurityGroupChangeRequest and
+// its observed state. Approvers decide through the status subresource.
+type SecurityGroupChangeRequestStatus struct {
+	// Decision on the change, one of Approved, Rejected. Set by an approver.
+	// +kubebuilder:validation:Enum=Approved;Rejected
+	// +optional
+	Decision string `json:"decision,omitempty"`
+	// DecidedBy is the user who made the decision. It must be set to the approver's own name.
+	// +optional
+	DecidedBy string `json:"decidedBy,omitempty"`
+	// Phase is one of Pending, Approved, Rejected, Superseded.
+	// +optional
+	Phase string `json:"phase,omitempty"`
+	// Time of the last phase change.
+	// +optional
+	Time string `json:"time,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:shortName=sgcr
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="SecurityGroup",type=string,JSONPath=`.spec.securityGroup`
+// +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+// +kubebuilder:printcolumn:name="RequestedBy",type=string,JSONPath=`.spec.requestedBy`
+// +kubebuilder:printcolumn:name="DecidedBy",type=string,JSONPath=`.status.decidedBy`
+
+// SecurityGroupChangeRequest is the Schema for the securitygroupchangerequests API
+type SecurityGroupChangeRequest struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   SecurityGroupChangeRequestSpec   `json:"spec,omitempty"`
+	Status SecurityGroupChangeRequestStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// SecurityGroupChangeRequestList contains a list of SecurityGroupChangeRequest
+type SecurityGroupChangeRequestList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []SecurityGroupChangeRequest `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&SecurityGroupChangeRequest{}, &SecurityGroupChangeRequestList{})
+}
@@ -0,0 +1,103 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// SecurityGroupPolicySpec defines the rules SecurityGroups must follow
+type SecurityGroupPolicySpec struct {
+	// Namespaces the policy applies to. Empty means all namespaces.
+	// +optional
+	Namespaces []string `json:"namespaces,omitempty"`
+	// Deny matches rules that SecurityGroups must not contain.
+	// +optional
+	Deny []PolicyRule `json:"deny,omitempty"`
+	// Require lists rules that SecurityGroups must contain, either literally
+	// or as part of a broader rule.
+	// +optional
+	Require []SecurityGroupRule `json:"require,omitempty"`
+}
+
+// PolicyRule matches rules of SecurityGroups. A rule is matched if it matches all of
+// the fields that are set.
+type PolicyRule struct {
+	// Direction of the rules to match, one of ingress, egress. Empty matches both.
+	// +kubebuilder:validation:Enum=ingress;egress
+	// +optional
+	Direction string `json:"direction,omitempty"`
+	// Ethertype of the rules to match, one of IPv4, IPv6. Empty matches both.
+	// +kubebuilder:validation:Enum=IPv4;IPv6
+	// +optional
+	Ethertype string `json:"ethertype,omitempty"`
+	// Protocols of the rules to match. Rules for any protocol match every protocol,
+	// and icmp also matches icmpv6 rules. Empty matches all rules.
+	// +optional
+	Protocols []string `json:"protocols,omitempty"`
+	// Ports matches rules that allow any port of this port or range, e.g. "22" or "6000-6100".
+	// Empty matches all rules.
+	// +optional
+	Ports string `json:"ports,omitempty"`
+	// CIDRs matches rules that allow any address of one of these networks, so that a
+	// network cannot be opened by splitting it into smaller rules, e.g. "0.0.0.0/0"
+	// matches all IPv4 rules and "192.0.2.0/24" matches rules for 192.0.2.128/25 and
+	// 0.0.0.0/0. Only networks of the family of a rule are compared with it. Empty
+	// matches all rules.
+	// +optional
+	CIDRs []string `json:"cidrs,omitempty"`
+	// Description explains the policy rule in violation messages.
+	// +optional
+	Description string `json:"description,omitempty"`
+}
+
+// AppliesTo reports whether the policy applies to SecurityGroups in the namespace.
+func (p *SecurityGroupPolicy) AppliesTo(namespace string) bool {
+	if len(p.Spec.Namespaces) == 0 {
+		return true
+	}
+	for _, ns := range p.Spec.Namespaces {
+		if ns == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster,shortName=sgp
+
+// SecurityGroupPolicy is the Schema for the securitygrouppolicies API
+type SecurityGroupPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec SecurityGroupPolicySpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// SecurityGroupPolicyList contains a list of SecurityGroupPolicy
+type SecurityGroupPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []SecurityGroupPolicy `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&SecurityGroupPolicy{}, &SecurityGroupPolicyList{})
+}
@@ -0,0 +1,138 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Kinds of templates a SecurityGroup can reference.
+const (
+	KindSecurityGroupTemplate        string = "SecurityGroupTemplate"
+	KindClusterSecurityGroupTemplate string = "ClusterSecurityGroupTemplate"
+)
+
+// SecurityGroupTemplateSpec defines parameterized rules and description for SecurityGroups.
+// The description and the string fields of the rules are Go templates, e.g.
+// "{{ .port }}", rendered with the parameters.
+type SecurityGroupTemplateSpec struct {
+	// Parameters of the template.
+	// +optional
+	Parameters []TemplateParameter `json:"parameters,omitempty"`
+	// Description of the security groups.
+	// +optional
+	Description string `json:"description,omitempty"`
+	// Rules of the security groups.
+	// +optional
+	Rules []SecurityGroupRule `json:"rules,omitempty"`
+}
+
+// TemplateParameter is a parameter of a template.
+type TemplateParameter struct {
+	Name string `json:"name"`
+	// Default value of the parameter.
+	// +optional
+	Default string `json:"default,omitempty"`
+	// Required parameters must be set by every SecurityGroup using the template.
+	// +optional
+	Required bool `json:"required,omitempty"`
+	// +optional
+	Description string `json:"description,omitempty"`
+}
+
+// TemplateReference references the template a SecurityGroup is rendered from.
+type TemplateReference struct {
+	// Kind of the template, SecurityGroupTemplate in the same namespace or ClusterSecurityGroupTemplate.
+	// +kubebuilder:validation:Enum=SecurityGroupTemplate;ClusterSecurityGroupTemplate
+	// +optional
+	Kind string `json:"kind,omitempty"`
+	// Name of the template.
+	Name string `json:"name"`
+	// Parameters override the defaults of the template.
+	// +optional
+	Parameters map[string]string `json:"parameters,omitempty"`
+}
+
+// Key identifies the referenced template within the namespace of the SecurityGroup,
+// e.g. "SecurityGroupTemplate/web".
+func (t *TemplateReference) Key() string {
+	kind := t.Kind
+	if kind == "" {
+		kind = KindSecurityGroupTemplate
+	}
+	return kind + "/" + t.Name
+}
+
+// RenderedTemplate is the result of rendering the template of a SecurityGroup.
+type RenderedTemplate struct {
+	// Template is the kind and name of the template, e.g. "SecurityGroupTemplate/web".
+	Template string `json:"template"`
+	// ResourceVersion of the template that was rendered.
+	// +optional
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+	// Description rendered from the template.
+	// +optional
+	Description string `json:"description,omitempty"`
+	// Rules rendered from the template.
+	// +optional
+	Rules []SecurityGroupRule `json:"rules,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:shortName=sgt
+
+// SecurityGroupTemplate is the Schema for the securitygrouptemplates API
+type SecurityGroupTemplate struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec SecurityGroupTemplateSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// SecurityGroupTemplateList contains a list of SecurityGroupTemplate
+type SecurityGroupTemplateList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []SecurityGroupTemplate `json:"items"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster,shortName=csgt
+
+// ClusterSecurityGroupTemplate is the Schema for the clustersecuritygrouptemplates API
+type ClusterSecurityGroupTemplate struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec SecurityGroupTemplateSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// ClusterSecurityGroupTemplateList contains a list of ClusterSecurityGroupTemplate
+type ClusterSecurityGroupTemplateList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterSecurityGroupTemplate `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&SecurityGroupTemplate{}, &SecurityGroupTemplateList{})
+	SchemeBuilder.Register(&ClusterSecurityGroupTemplate{}, &ClusterSecurityGroupTemplateList{})
+}
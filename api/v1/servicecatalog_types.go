@@ -0,0 +1,72 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ServiceCatalogSpec defines named services that rules can reference
+type ServiceCatalogSpec struct {
+	// Services of the catalog. A service overrides the built-in service of the same name.
+	// +optional
+	Services []NamedService `json:"services,omitempty"`
+}
+
+// NamedService is a named set of protocols and ports.
+type NamedService struct {
+	Name string `json:"name"`
+	// Ports of the service.
+	// +kubebuilder:validation:MinItems=1
+	Ports []ServicePort `json:"ports"`
+	// +optional
+	Description string `json:"description,omitempty"`
+}
+
+// ServicePort is a protocol and port range of a service.
+type ServicePort struct {
+	// Protocol, e.g. tcp, udp, icmp.
+	Protocol string `json:"protocol"`
+	// Ports is a single port such as "5432" or an inclusive range such as "2379-2380".
+	// Empty means all ports.
+	// +optional
+	Ports string `json:"ports,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster,shortName=svccat
+
+// ServiceCatalog is the Schema for the servicecatalogs API
+type ServiceCatalog struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec ServiceCatalogSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// ServiceCatalogList contains a list of ServiceCatalog
+type ServiceCatalogList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ServiceCatalog `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ServiceCatalog{}, &ServiceCatalogList{})
+}
@@ -0,0 +1,81 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	paasv1 "security-group/api/v1"
+)
+
+// pause sets the paused annotation of SecurityGroups.
+func pause(args []string) error {
+	return annotate("pause", args, "paused", func(annotations map[string]string) {
+		annotations[paasv1.PausedAnnotation] = "true"
+	})
+}
+
+// resume removes the paused annotation of SecurityGroups.
+func resume(args []string) error {
+	return annotate("resume", args, "resumed", func(annotations map[string]string) {
+		delete(annotations, paasv1.PausedAnnotation)
+	})
+}
+
+// resync sets the resync annotation of SecurityGroups to the current time.
+func resync(args []string) error {
+	now := time.Now().Format(time.RFC3339)
+	return annotate("resync", args, "resync requested", func(annotations map[string]string) {
+		annotations[paasv1.ResyncAnnotation] = now
+	})
+}
+
+// annotate changes the annotations of the named SecurityGroups with a merge patch.
+func annotate(name string, args []string, done string, change func(annotations map[string]string)) error {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	var o options
+	names := o.parse(name, args, fs)
+	if len(names) == 0 {
+		return fmt.Errorf("expected the names of SecurityGroups")
+	}
+	c, namespace, err := o.connect()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	for _, name := range names {
+		sg := &paasv1.SecurityGroup{}
+		if err := c.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, sg); err != nil {
+			return err
+		}
+		patch := client.MergeFrom(sg.DeepCopy())
+		if sg.Annotations == nil {
+			sg.Annotations = map[string]string{}
+		}
+		change(sg.Annotations)
+		if err := c.Patch(ctx, sg, patch); err != nil {
+			return err
+		}
+		fmt.Printf("securitygroup.paas.unicom.cn/%s %s\n", sg.Name, done)
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	paasv1 "security-group/api/v1"
+	"security-group/rules"
+)
+
+// deps prints the objects the rules of a SecurityGroup are built from, and the bindings
+// and change requests that reference the SecurityGroup. Referenced objects that do not
+// exist are marked, since the controller cannot reconcile the SecurityGroup without them.
+func deps(args []string) error {
+	fs := flag.NewFlagSet("deps", flag.ExitOnError)
+	var o options
+	name, err := one(o.parse("deps", args, fs))
+	if err != nil {
+		return err
+	}
+	c, namespace, err := o.connect()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	sg := &paasv1.SecurityGroup{}
+	if err := c.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, sg); err != nil {
+		return err
+	}
+	id := sg.Status.Id
+	if id == "" {
+		id = "<none>"
+	}
+	fmt.Printf("SecurityGroup %s/%s (DCS id %s)\n", sg.Namespace, sg.Name, id)
+
+	specRules := sg.Spec.Rules
+	if ref := sg.Spec.Template; ref != nil {
+		key := client.ObjectKey{Namespace: sg.Namespace, Name: ref.Name}
+		var obj runtime.Object = &paasv1.SecurityGroupTemplate{}
+		if ref.Kind == paasv1.KindClusterSecurityGroupTemplate {
+			key.Namespace = ""
+			obj = &paasv1.ClusterSecurityGroupTemplate{}
+		}
+		fmt.Printf("  uses %s%s\n", ref.Key(), exists(c.Get(ctx, key, obj)))
+		if sg.Status.Template != nil {
+			specRules = append(append([]paasv1.SecurityGroupRule{}, sg.Status.Template.Rules...), specRules...)
+		}
+	}
+
+	for _, group := range rules.AddressGroups(specRules) {
+		ag := &paasv1.AddressGroup{}
+		err := c.Get(ctx, client.ObjectKey{Namespace: sg.Namespace, Name: group}, ag)
+		fmt.Printf("  uses AddressGroup/%s%s\n", group, exists(err))
+		if err == nil && ag.Spec.ConfigMapRef != nil {
+			err := c.Get(ctx, client.ObjectKey{Namespace: sg.Namespace, Name: ag.Spec.ConfigMapRef.Name}, &corev1.ConfigMap{})
+			fmt.Printf("    uses ConfigMap/%s%s\n", ag.Spec.ConfigMapRef.Name, exists(err))
+		}
+	}
+
+	catalogs := &paasv1.ServiceCatalogList{}
+	if err := c.List(ctx, catalogs); err != nil {
+		return err
+	}
+	for _, service := range services(specRules) {
+		fmt.Printf("  uses service %s from %s\n", service, serviceSource(service, catalogs.Items))
+	}
+
+	bindings := &paasv1.NodeSecurityGroupBindingList{}
+	if err := c.List(ctx, bindings, client.InNamespace(sg.Namespace)); err != nil {
+		return err
+	}
+	for _, b := range bindings.Items {
+		for _, bound := range b.Spec.SecurityGroups {
+			if bound == sg.Name {
+				fmt.Printf("  used by NodeSecurityGroupBinding/%s (%d nodes)\n", b.Name, len(b.Status.Nodes))
+				break
+			}
+		}
+	}
+
+	requests := &paasv1.SecurityGroupChangeRequestList{}
+	if err := c.List(ctx, requests, client.InNamespace(sg.Namespace)); err != nil {
+		return err
+	}
+	for _, cr := range requests.Items {
+		if cr.Spec.SecurityGroup == sg.Name {
+			fmt.Printf("  used by SecurityGroupChangeRequest/%s (%s)\n", cr.Name, cr.Status.Phase)
+		}
+	}
+	return nil
+}
+
+// exists describes the result of getting a referenced object.
+func exists(err error) string {
+	if err == nil {
+		return ""
+	}
+	if apierrors.IsNotFound(err) {
+		return " (not found)"
+	}
+	return fmt.Sprintf(" (%v)", err)
+}
+
+// services returns the services the rules reference, in the order they are first referenced.
+func services(specRules []paasv1.SecurityGroupRule) []string {
+	var names []string
+	seen := map[string]bool{}
+	for _, rule := range specRules {
+		if rule.Service != "" && !seen[rule.Service] {
+			seen[rule.Service] = true
+			names = append(names, rule.Service)
+		}
+	}
+	return names
+}
+
+// serviceSource returns the ServiceCatalogs that define the service, or whether it is a
+// built-in service.
+func serviceSource(service string, catalogs []paasv1.ServiceCatalog) string {
+	var definedBy []string
+	for _, c := range catalogs {
+		for _, s := range c.Spec.Services {
+			if s.Name == service {
+				definedBy = append(definedBy, "ServiceCatalog/"+c.Name)
+			}
+		}
+	}
+	if len(definedBy) > 0 {
+		return strings.Join(definedBy, ", ")
+	}
+	if _, ok := rules.BuiltinServices[service]; ok {
+		return "the built-in catalog"
+	}
+	return "nowhere (not found)"
+}
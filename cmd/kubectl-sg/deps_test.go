@@ -0,0 +1,51 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	paasv1 "security-group/api/v1"
+)
+
+func TestServiceSource(t *testing.T) {
+	catalog := func(name string, services ...string) paasv1.ServiceCatalog {
+		c := paasv1.ServiceCatalog{ObjectMeta: metav1.ObjectMeta{Name: name}}
+		for _, s := range services {
+			c.Spec.Services = append(c.Spec.Services, paasv1.NamedService{Name: s})
+		}
+		return c
+	}
+	catalogs := []paasv1.ServiceCatalog{catalog("infra", "ldap", "ssh"), catalog("team", "ldap")}
+
+	tests := []struct {
+		service string
+		want    string
+	}{
+		{service: "ldap", want: "ServiceCatalog/infra, ServiceCatalog/team"},
+		{service: "ssh", want: "ServiceCatalog/infra"},
+		{service: "dns", want: "the built-in catalog"},
+		{service: "gopher", want: "nowhere (not found)"},
+	}
+	for _, tt := range tests {
+		if got := serviceSource(tt.service, catalogs); got != tt.want {
+			t.Errorf("serviceSource(%q) = %q, want %q", tt.service, got, tt.want)
+		}
+	}
+}
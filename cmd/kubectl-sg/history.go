@@ -0,0 +1,86 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	paasv1 "security-group/api/v1"
+)
+
+// history prints the conditions of a SecurityGroup and the events recorded for it, oldest
+// first. The API server keeps events for an hour by default.
+func history(args []string) error {
+	fs := flag.NewFlagSet("history", flag.ExitOnError)
+	var o options
+	name, err := one(o.parse("history", args, fs))
+	if err != nil {
+		return err
+	}
+	c, namespace, err := o.connect()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	sg := &paasv1.SecurityGroup{}
+	if err := c.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, sg); err != nil {
+		return err
+	}
+	events := &corev1.EventList{}
+	if err := c.List(ctx, events, client.InNamespace(namespace), client.MatchingFields{"involvedObject.uid": string(sg.UID)}); err != nil {
+		return err
+	}
+	sort.SliceStable(events.Items, func(i, j int) bool {
+		return eventTime(&events.Items[i]).Before(eventTime(&events.Items[j]))
+	})
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "CONDITION\tSTATUS\tREASON\tLAST TRANSITION\tMESSAGE")
+	for _, cond := range sg.Status.Conditions {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", cond.Type, cond.Status, cond.Reason, cond.LastTransitionTime, cond.Message)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "TIME\tTYPE\tREASON\tCOUNT\tMESSAGE")
+	for i := range events.Items {
+		e := &events.Items[i]
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\n", eventTime(e).Format("2006-01-02T15:04:05Z07:00"), e.Type, e.Reason, e.Count, e.Message)
+	}
+	if len(events.Items) == 0 {
+		fmt.Fprintln(w, "<no events>")
+	}
+	return w.Flush()
+}
+
+// eventTime returns when the event last occurred.
+func eventTime(e *corev1.Event) time.Time {
+	if !e.LastTimestamp.IsZero() {
+		return e.LastTimestamp.Time
+	}
+	if !e.EventTime.IsZero() {
+		return e.EventTime.Time
+	}
+	return e.CreationTimestamp.Time
+}
@@ -0,0 +1,153 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Command kubectl-sg is a kubectl plugin for SecurityGroups. Installed on the PATH it is run
+// as 'kubectl sg'.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	paasv1 "security-group/api/v1"
+)
+
+var scheme = runtime.NewScheme()
+
+func init() {
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = paasv1.AddToScheme(scheme)
+}
+
+// command is a subcommand of kubectl-sg.
+type command struct {
+	run     func(args []string) error
+	usage   string
+	summary string
+}
+
+// commands is filled in by init, since the usage of the commands refers to it.
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"deps":    {deps, "NAME", "Show the objects a SecurityGroup references and the objects that reference it"},
+		"history": {history, "NAME", "Show the conditions and events of a SecurityGroup"},
+		"pause":   {pause, "NAME...", "Stop the controller from changing the security groups in DCS"},
+		"resume":  {resume, "NAME...", "Let the controller change the security groups in DCS again"},
+		"resync":  {resync, "NAME...", "Make the controller reconcile SecurityGroups with DCS right away"},
+		"rules":   {rulesCommand, "NAME", "Show the rules of a SecurityGroup as a table"},
+	}
+}
+
+func main() {
+	if len(os.Args) < 2 || os.Args[1] == "-h" || os.Args[1] == "--help" || os.Args[1] == "help" {
+		usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "kubectl sg: unknown command %q\n\n", os.Args[1])
+		usage()
+		os.Exit(2)
+	}
+	if err := cmd.run(os.Args[2:]); err != nil {
+		fmt.Fprintf(os.Stderr, "kubectl sg %s: %v\n", os.Args[1], err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintf(os.Stderr, "Usage: kubectl sg <command> [flags]\n\nCommands:\n")
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", name, commands[name].summary)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun 'kubectl sg <command> -h' for the flags of a command.\n")
+}
+
+// options are the kubectl flags every command accepts.
+type options struct {
+	kubeconfig string
+	context    string
+	namespace  string
+}
+
+// parse parses the flags of a command, which unlike the flag package may follow the names
+// of the objects as they may for kubectl, and returns the names.
+func (o *options) parse(name string, args []string, fs *flag.FlagSet) []string {
+	fs.StringVar(&o.kubeconfig, "kubeconfig", "", "Path to the kubeconfig file.")
+	fs.StringVar(&o.context, "context", "", "Name of the kubeconfig context to use.")
+	fs.StringVar(&o.namespace, "namespace", "", "Namespace of the SecurityGroups. Defaults to the namespace of the context.")
+	fs.StringVar(&o.namespace, "n", "", "Shorthand for --namespace.")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: kubectl sg %s %s [flags]\n\n%s.\n\nFlags:\n", name, commands[name].usage, commands[name].summary)
+		fs.PrintDefaults()
+	}
+	var names []string
+	for {
+		fs.Parse(args)
+		args = fs.Args()
+		if len(args) == 0 {
+			return names
+		}
+		names = append(names, args[0])
+		args = args[1:]
+	}
+}
+
+// connect returns a client of the cluster and the namespace of the SecurityGroups, which
+// is the namespace of the kubeconfig context unless a namespace flag is given.
+func (o *options) connect() (client.Client, string, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = o.kubeconfig
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: o.context}
+	overrides.Context.Namespace = o.namespace
+	config := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides)
+	namespace, _, err := config.Namespace()
+	if err != nil {
+		return nil, "", err
+	}
+	cfg, err := config.ClientConfig()
+	if err != nil {
+		return nil, "", err
+	}
+	c, err := client.New(cfg, client.Options{Scheme: scheme})
+	if err != nil {
+		return nil, "", err
+	}
+	return c, namespace, nil
+}
+
+// one returns the only name, or an error if there is not exactly one.
+func one(names []string) (string, error) {
+	if len(names) != 1 {
+		return "", fmt.Errorf("expected the name of one SecurityGroup, got %d names", len(names))
+	}
+	return names[0], nil
+}
@@ -0,0 +1,60 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"flag"
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		args      []string
+		names     []string
+		namespace string
+		context   string
+	}{
+		{args: []string{"web"}, names: []string{"web"}},
+		{args: []string{"-n", "tenant", "web", "db"}, names: []string{"web", "db"}, namespace: "tenant"},
+		{args: []string{"web", "-n", "tenant"}, names: []string{"web"}, namespace: "tenant"},
+		{args: []string{"web", "--namespace=tenant", "db", "--context", "prod"}, names: []string{"web", "db"}, namespace: "tenant", context: "prod"},
+		{args: []string{"web", "--", "-n"}, names: []string{"web", "-n"}},
+		{args: nil},
+	}
+	for _, tt := range tests {
+		var o options
+		names := o.parse("pause", tt.args, flag.NewFlagSet("pause", flag.ContinueOnError))
+		if !reflect.DeepEqual(names, tt.names) {
+			t.Errorf("parse(%q) = %q, want %q", tt.args, names, tt.names)
+		}
+		if o.namespace != tt.namespace || o.context != tt.context {
+			t.Errorf("parse(%q) options = %+v", tt.args, o)
+		}
+	}
+}
+
+func TestOne(t *testing.T) {
+	if name, err := one([]string{"web"}); err != nil || name != "web" {
+		t.Errorf("one() = %q, %v", name, err)
+	}
+	for _, names := range [][]string{nil, {"web", "db"}} {
+		if _, err := one(names); err == nil {
+			t.Errorf("one(%q) succeeded", names)
+		}
+	}
+}
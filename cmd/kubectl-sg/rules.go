@@ -0,0 +1,129 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	paasv1 "security-group/api/v1"
+)
+
+// rulesCommand prints the rules of a SecurityGroup, those rendered from its template first,
+// with the state the controller tracks for temporary and scheduled rules.
+func rulesCommand(args []string) error {
+	fs := flag.NewFlagSet("rules", flag.ExitOnError)
+	var o options
+	name, err := one(o.parse("rules", args, fs))
+	if err != nil {
+		return err
+	}
+	c, namespace, err := o.connect()
+	if err != nil {
+		return err
+	}
+	sg := &paasv1.SecurityGroup{}
+	if err := c.Get(context.Background(), client.ObjectKey{Namespace: namespace, Name: name}, sg); err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "SOURCE\tDIRECTION\tETHERTYPE\tPROTOCOL\tPORTS\tREMOTE\tACTION\tPRIORITY\tSTATE\tDESCRIPTION")
+	if sg.Spec.Template != nil && sg.Status.Template != nil {
+		for _, rule := range sg.Status.Template.Rules {
+			printRule(w, "template", rule, &sg.Status)
+		}
+	}
+	for _, rule := range sg.Spec.Rules {
+		printRule(w, "spec", rule, &sg.Status)
+	}
+	return w.Flush()
+}
+
+func printRule(w *tabwriter.Writer, source string, rule paasv1.SecurityGroupRule, status *paasv1.SecurityGroupStatus) {
+	ethertype := rule.Ethertype
+	if ethertype == "" {
+		ethertype = paasv1.EthertypeIPv4
+		if strings.Contains(rule.CIDR, ":") {
+			ethertype = paasv1.EthertypeIPv6
+		}
+	}
+	protocol, ports := rule.Protocol, rule.Ports
+	if rule.Service != "" {
+		protocol, ports = "service:"+rule.Service, "-"
+	}
+	if protocol == "" {
+		protocol = "any"
+	}
+	if ports == "" {
+		ports = "all"
+	}
+	remote := rule.CIDR
+	if rule.AddressGroup != "" {
+		remote = "group:" + rule.AddressGroup
+	} else if remote == "" {
+		remote = "any"
+	}
+	action := rule.Action
+	if action == "" {
+		action = paasv1.ActionAllow
+	}
+	priority := "-"
+	if rule.Priority != 0 {
+		priority = strconv.Itoa(int(rule.Priority))
+	}
+	if rule.Stateless {
+		action += ",stateless"
+	}
+	fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+		source, rule.Direction, ethertype, protocol, ports, remote, action, priority, ruleState(rule, status), rule.Description)
+}
+
+// ruleState describes whether a temporary or scheduled rule is in DCS.
+func ruleState(rule paasv1.SecurityGroupRule, status *paasv1.SecurityGroupStatus) string {
+	if t, ok := status.GetTemporaryRule(rule.String()); ok {
+		if t.Expired {
+			return "expired"
+		}
+		return "expires " + t.ExpiresAt
+	}
+	if rule.ExpiresAt != "" {
+		if expiresAt, err := time.Parse(time.RFC3339, rule.ExpiresAt); err == nil && !time.Now().Before(expiresAt) {
+			return "expired"
+		}
+		return "expires " + rule.ExpiresAt
+	}
+	if s, ok := status.GetScheduledRule(rule.String()); ok {
+		state := "inactive"
+		if s.Active {
+			state = "active"
+		}
+		if s.NextTransitionTime != "" {
+			state += " until " + s.NextTransitionTime
+		}
+		return state
+	}
+	return "active"
+}
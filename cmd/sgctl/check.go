@@ -0,0 +1,80 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"security-group/planner"
+	"security-group/reachability"
+	"security-group/rules"
+)
+
+// check evaluates a flow against SecurityGroups, as if they were all attached to the same
+// instance. It exits with status 1 if the flow is denied.
+func check(args []string) error {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	var src source
+	src.addFlags(fs)
+	direction := fs.String("direction", "ingress", "Direction of the flow, ingress into or egress out of the instance.")
+	protocol := fs.String("protocol", "tcp", "Protocol of the flow, e.g. tcp, udp, icmp.")
+	port := fs.String("port", "", "Destination port of the flow. Required for tcp, udp and sctp.")
+	address := fs.String("address", "", "Remote address of the flow, the source of ingress or the destination of egress traffic.")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: sgctl check [flags] [securitygroup...]\n\n"+
+			"Evaluates a flow against the named SecurityGroups, or all SecurityGroups of the namespace,\n"+
+			"and explains which rule decided it. Exits with status 1 if the flow is denied.\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	flow, err := reachability.ParseFlow(*direction, *protocol, *port, *address)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	c, err := src.connect()
+	if err != nil {
+		return err
+	}
+	sgs, err := src.securityGroups(ctx, c, fs.Args())
+	if err != nil {
+		return err
+	}
+	groups := make([]reachability.Group, 0, len(sgs))
+	for i := range sgs {
+		expanded, err := planner.ExpandActive(ctx, c, &sgs[i])
+		if err != nil {
+			return fmt.Errorf("SecurityGroup %s: %v", sgs[i].Name, err)
+		}
+		desired, err := rules.Normalize(expanded)
+		if err != nil {
+			return fmt.Errorf("SecurityGroup %s: %v", sgs[i].Name, err)
+		}
+		groups = append(groups, reachability.Group{Name: sgs[i].Namespace + "/" + sgs[i].Name, Rules: desired})
+	}
+
+	result := reachability.Evaluate(flow, groups)
+	fmt.Println(result.Explain())
+	if !result.Allowed {
+		return errFailed
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	paasv1 "security-group/api/v1"
+	"security-group/dcs"
+	"security-group/planner"
+)
+
+// diff prints the calls the controller would make to bring the security groups in DCS in
+// line with their SecurityGroups. It exits with status 1 if there are differences.
+func diff(args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	var src source
+	src.addFlags(fs)
+	dcsURL := fs.String("dcs-url", dcs.DefaultBasePath, "Address of the DCS API.")
+	cluster := fs.String("cluster-name", "", "Name of the cluster, as given to the controller.")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: sgctl diff [flags] [securitygroup...]\n\n"+
+			"Compares the named SecurityGroups, or all SecurityGroups of the namespace, with their\n"+
+			"security groups in DCS and prints the calls that would make DCS match. Rules the controller\n"+
+			"generates for Services are not known to sgctl and show up as rules to delete.\n"+
+			"Exits with status 1 if there are differences.\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	ctx := context.Background()
+	c, err := src.connect()
+	if err != nil {
+		return err
+	}
+	sgs, err := src.securityGroups(ctx, c, fs.Args())
+	if err != nil {
+		return err
+	}
+	api := dcs.New(*dcsURL)
+	differs := false
+	for i := range sgs {
+		sg := &sgs[i]
+		changes, err := remoteChanges(ctx, api, c, sg, *cluster)
+		if err != nil {
+			return fmt.Errorf("SecurityGroup %s: %v", sg.Name, err)
+		}
+		if len(changes) == 0 {
+			continue
+		}
+		differs = true
+		fmt.Printf("%s/%s (DCS id %q):\n", sg.Namespace, sg.Name, sg.Status.Id)
+		for _, change := range changes {
+			fmt.Printf("  %s\n", change)
+		}
+	}
+	if differs {
+		return errFailed
+	}
+	return nil
+}
+
+// remoteChanges returns the calls that make the security group in DCS match the SecurityGroup.
+func remoteChanges(ctx context.Context, api dcs.Client, c client.Reader, sg *paasv1.SecurityGroup, cluster string) ([]paasv1.PlannedChange, error) {
+	expanded, err := planner.ExpandActive(ctx, c, sg)
+	if err != nil {
+		return nil, err
+	}
+	desired, err := planner.Desired(expanded)
+	if err != nil {
+		return nil, err
+	}
+	return planner.Changes(ctx, api, sg, desired, cluster)
+}
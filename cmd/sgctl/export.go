@@ -0,0 +1,106 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+
+	paasv1 "security-group/api/v1"
+)
+
+// lastAppliedAnnotation is the annotation kubectl apply records the applied object in.
+const lastAppliedAnnotation string = "kubectl.kubernetes.io/last-applied-configuration"
+
+// export prints SecurityGroups as a list that can be imported into another cluster. The
+// status and the metadata set by the API server are left out.
+func export(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	var src source
+	src.addFlags(fs)
+	output := fs.String("o", "yaml", "Output format, yaml or json.")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: sgctl export [flags] [securitygroup...]\n\n"+
+			"Prints the named SecurityGroups, or all SecurityGroups of the namespace, without their\n"+
+			"status, for 'sgctl import' or 'kubectl apply'.\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *output != "yaml" && *output != "json" {
+		return fmt.Errorf("unknown output format %q, must be yaml or json", *output)
+	}
+
+	ctx := context.Background()
+	c, err := src.connect()
+	if err != nil {
+		return err
+	}
+	sgs, err := src.securityGroups(ctx, c, fs.Args())
+	if err != nil {
+		return err
+	}
+	list := &paasv1.SecurityGroupList{
+		TypeMeta: metav1.TypeMeta{APIVersion: paasv1.GroupVersion.String(), Kind: "SecurityGroupList"},
+		Items:    make([]paasv1.SecurityGroup, 0, len(sgs)),
+	}
+	for i := range sgs {
+		list.Items = append(list.Items, exported(&sgs[i]))
+	}
+
+	var out []byte
+	if *output == "json" {
+		out, err = json.MarshalIndent(list, "", "  ")
+		out = append(out, '\n')
+	} else {
+		out, err = yaml.Marshal(list)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(out)
+	return err
+}
+
+// exported returns the SecurityGroup with only its name, namespace, labels, annotations
+// and spec.
+func exported(sg *paasv1.SecurityGroup) paasv1.SecurityGroup {
+	annotations := map[string]string{}
+	for k, v := range sg.Annotations {
+		if k != lastAppliedAnnotation {
+			annotations[k] = v
+		}
+	}
+	if len(annotations) == 0 {
+		annotations = nil
+	}
+	return paasv1.SecurityGroup{
+		TypeMeta: metav1.TypeMeta{APIVersion: paasv1.GroupVersion.String(), Kind: "SecurityGroup"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        sg.Name,
+			Namespace:   sg.Namespace,
+			Labels:      sg.Labels,
+			Annotations: annotations,
+		},
+		Spec: sg.Spec,
+	}
+}
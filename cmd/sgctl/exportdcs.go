@@ -0,0 +1,78 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"sigs.k8s.io/yaml"
+
+	"security-group/dcs"
+)
+
+// exportDCS writes a manifest for each security group of a DCS account, so that existing
+// security groups can be put under version control and adopted by the controller.
+func exportDCS(args []string) error {
+	fs := flag.NewFlagSet("export-dcs", flag.ExitOnError)
+	dcsURL := fs.String("dcs-url", dcs.DefaultBasePath, "Address of the DCS API.")
+	accountId := fs.String("account", "", "DCS account whose security groups are exported.")
+	userId := fs.String("user", "", "DCS user the security groups are listed as.")
+	namespace := fs.String("n", "default", "Namespace of the SecurityGroups.")
+	dir := fs.String("o", ".", "Directory the manifests are written to, one <name>.yaml per security group, or - for standard output.")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: sgctl export-dcs -account ID -user ID [flags]\n\n"+
+			"Converts all security groups of a DCS account, including their rules, into SecurityGroups\n"+
+			"with the %s annotation, which makes the controller adopt the existing security\n"+
+			"groups instead of creating new ones. Rules that cannot be expressed in a SecurityGroup\n"+
+			"are reported and left out, and such SecurityGroups set manageRules to false so that\n"+
+			"the controller keeps the rules.\n\nFlags:\n", dcs.AdoptAnnotation)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *accountId == "" || *userId == "" {
+		return fmt.Errorf("-account and -user are required")
+	}
+
+	exported, err := dcs.Export(context.Background(), dcs.New(*dcsURL), dcs.Account{AccountId: *accountId, UserId: *userId}, *namespace)
+	if err != nil {
+		return err
+	}
+	for _, e := range exported {
+		for _, skipped := range e.Skipped {
+			fmt.Fprintf(os.Stderr, "security group %s: skipped rule %s\n", e.SecurityGroup.Annotations[dcs.AdoptAnnotation], skipped)
+		}
+		out, err := yaml.Marshal(&e.SecurityGroup)
+		if err != nil {
+			return err
+		}
+		if *dir == "-" {
+			fmt.Printf("---\n%s", out)
+			continue
+		}
+		name := filepath.Join(*dir, e.SecurityGroup.Name+".yaml")
+		if err := ioutil.WriteFile(name, out, 0644); err != nil {
+			return err
+		}
+		fmt.Println(name)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	paasv1 "security-group/api/v1"
+)
+
+// importCommand creates the SecurityGroups of the files in the cluster, or updates the spec,
+// labels and annotations of the ones that exist. Other objects of the files are skipped.
+func importCommand(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	var src source
+	src.addFlags(fs)
+	dryRun := fs.Bool("dry-run", false, "Only print what would be created and updated.")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: sgctl import -f FILE [flags]\n\n"+
+			"Creates or updates the SecurityGroups of the files, e.g. the output of 'sgctl export', in\n"+
+			"the cluster. The status of the SecurityGroups in the files is ignored.\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if len(src.files) == 0 {
+		return fmt.Errorf("no files given, use -f")
+	}
+
+	var imports []paasv1.SecurityGroup
+	for _, name := range src.files {
+		objs, err := src.readFile(name)
+		if err != nil {
+			return err
+		}
+		for _, obj := range objs {
+			if sg, ok := obj.(*paasv1.SecurityGroup); ok {
+				imports = append(imports, exported(sg))
+			}
+		}
+	}
+	if len(imports) == 0 {
+		return fmt.Errorf("no SecurityGroups found in the files")
+	}
+
+	ctx := context.Background()
+	c, err := src.cluster()
+	if err != nil {
+		return err
+	}
+	var opts []client.CreateOption
+	var updateOpts []client.UpdateOption
+	suffix := ""
+	if *dryRun {
+		opts = append(opts, client.DryRunAll)
+		updateOpts = append(updateOpts, client.DryRunAll)
+		suffix = " (dry run)"
+	}
+	for i := range imports {
+		sg := &imports[i]
+		existing := &paasv1.SecurityGroup{}
+		err := c.Get(ctx, client.ObjectKey{Namespace: sg.Namespace, Name: sg.Name}, existing)
+		if apierrors.IsNotFound(err) {
+			if err := c.Create(ctx, sg, opts...); err != nil {
+				return fmt.Errorf("SecurityGroup %s/%s: %v", sg.Namespace, sg.Name, err)
+			}
+			fmt.Printf("securitygroup %s/%s created%s\n", sg.Namespace, sg.Name, suffix)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if reflect.DeepEqual(existing.Spec, sg.Spec) && subset(sg.Labels, existing.Labels) && subset(sg.Annotations, existing.Annotations) {
+			fmt.Printf("securitygroup %s/%s unchanged\n", sg.Namespace, sg.Name)
+			continue
+		}
+		existing.Spec = sg.Spec
+		existing.Labels = merge(existing.Labels, sg.Labels)
+		existing.Annotations = merge(existing.Annotations, sg.Annotations)
+		if err := c.Update(ctx, existing, updateOpts...); err != nil {
+			return fmt.Errorf("SecurityGroup %s/%s: %v", sg.Namespace, sg.Name, err)
+		}
+		fmt.Printf("securitygroup %s/%s updated%s\n", sg.Namespace, sg.Name, suffix)
+	}
+	return nil
+}
+
+// subset reports whether all entries of a are in b.
+func subset(a, b map[string]string) bool {
+	for k, v := range a {
+		if w, ok := b[k]; !ok || w != v {
+			return false
+		}
+	}
+	return true
+}
+
+// merge returns the entries of a overridden and extended by the entries of b.
+func merge(a, b map[string]string) map[string]string {
+	if len(b) == 0 {
+		return a
+	}
+	merged := map[string]string{}
+	for k, v := range a {
+		merged[k] = v
+	}
+	for k, v := range b {
+		merged[k] = v
+	}
+	return merged
+}
@@ -0,0 +1,71 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"security-group/lint"
+	"security-group/planner"
+)
+
+// lintCommand prints the findings of the rule analyzer for SecurityGroups. It exits with
+// status 1 if there are findings.
+func lintCommand(args []string) error {
+	fs := flag.NewFlagSet("lint", flag.ExitOnError)
+	var src source
+	src.addFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: sgctl lint [flags] [securitygroup...]\n\n"+
+			"Finds redundant, shadowed and overly permissive rules of the named SecurityGroups, or all\n"+
+			"SecurityGroups of the namespace. Exits with status 1 if there are findings.\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	ctx := context.Background()
+	c, err := src.connect()
+	if err != nil {
+		return err
+	}
+	sgs, err := src.securityGroups(ctx, c, fs.Args())
+	if err != nil {
+		return err
+	}
+	found := false
+	for i := range sgs {
+		expanded, err := planner.ExpandActive(ctx, c, &sgs[i])
+		if err != nil {
+			return fmt.Errorf("SecurityGroup %s: %v", sgs[i].Name, err)
+		}
+		findings, err := lint.Analyze(expanded)
+		if err != nil {
+			return fmt.Errorf("SecurityGroup %s: %v", sgs[i].Name, err)
+		}
+		for _, f := range findings {
+			fmt.Printf("%s/%s: %s\n", sgs[i].Namespace, sgs[i].Name, f)
+			found = true
+		}
+	}
+	if found {
+		return errFailed
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	paasv1 "security-group/api/v1"
+)
+
+// list prints SecurityGroups with their Ready and Synced conditions and DCS ids.
+func list(args []string) error {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	var src source
+	src.addFlags(fs)
+	allNamespaces := fs.Bool("A", false, "List the SecurityGroups of all namespaces.")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: sgctl list [flags]\n\n"+
+			"Lists the SecurityGroups of the namespace with their state and DCS ids.\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	c, err := src.connect()
+	if err != nil {
+		return err
+	}
+	var opts []client.ListOption
+	if !*allNamespaces {
+		opts = append(opts, client.InNamespace(src.namespace))
+	}
+	sgs := &paasv1.SecurityGroupList{}
+	if err := c.List(context.Background(), sgs, opts...); err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAMESPACE\tNAME\tDCS NAME\tDCS ID\tREADY\tSYNCED\tREASON")
+	for _, sg := range sgs.Items {
+		ready := sg.Status.GetCondition(paasv1.TypeReady)
+		synced := sg.Status.GetCondition(paasv1.TypeSynced)
+		reason := synced.Reason
+		if synced.Status == paasv1.ConditionTrue {
+			reason = ready.Reason
+		}
+		id := sg.Status.Id
+		if id == "" {
+			id = "<none>"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", sg.Namespace, sg.Name, sg.Spec.Name, id, ready.Status, synced.Status, reason)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,80 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Command sgctl inspects SecurityGroups from the command line, reading them from the
+// cluster or from YAML and JSON files.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// command is a subcommand of sgctl.
+type command struct {
+	run     func(args []string) error
+	summary string
+}
+
+var commands = map[string]command{
+	"check":      {check, "Check whether a flow is allowed by SecurityGroups and explain which rule decided it"},
+	"diff":       {diff, "Show how the security groups in DCS differ from their SecurityGroups"},
+	"export":     {export, "Print SecurityGroups without their status, for import into another cluster"},
+	"export-dcs": {exportDCS, "Write a SecurityGroup manifest adopting each security group of a DCS account"},
+	"import":     {importCommand, "Create or update SecurityGroups from YAML or JSON files"},
+	"lint":       {lintCommand, "Find redundant, shadowed and overly permissive rules of SecurityGroups"},
+	"list":       {list, "List SecurityGroups with their state and DCS ids"},
+	"resync":     {resync, "Make the controller reconcile SecurityGroups with DCS right away"},
+}
+
+// errFailed makes sgctl exit with status 1 without printing an error, after the command
+// printed why it failed.
+var errFailed = errors.New("failed")
+
+func main() {
+	if len(os.Args) < 2 || os.Args[1] == "-h" || os.Args[1] == "--help" || os.Args[1] == "help" {
+		usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "sgctl: unknown command %q\n\n", os.Args[1])
+		usage()
+		os.Exit(2)
+	}
+	if err := cmd.run(os.Args[2:]); err != nil {
+		if err != errFailed {
+			fmt.Fprintf(os.Stderr, "sgctl %s: %v\n", os.Args[1], err)
+			os.Exit(2)
+		}
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintf(os.Stderr, "Usage: sgctl <command> [flags]\n\nCommands:\n")
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", name, commands[name].summary)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun 'sgctl <command> -h' for the flags of a command.\n")
+}
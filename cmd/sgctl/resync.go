@@ -0,0 +1,71 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	paasv1 "security-group/api/v1"
+)
+
+// resync sets the resync annotation of SecurityGroups to the current time, which makes the
+// controller compare them with DCS right away.
+func resync(args []string) error {
+	fs := flag.NewFlagSet("resync", flag.ExitOnError)
+	var src source
+	src.addFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: sgctl resync [flags] [securitygroup...]\n\n"+
+			"Makes the controller reconcile the named SecurityGroups, or all SecurityGroups of the\n"+
+			"namespace, with DCS right away by setting the %s annotation.\n\nFlags:\n", paasv1.ResyncAnnotation)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if len(src.files) > 0 {
+		return fmt.Errorf("-f cannot be used, resync changes SecurityGroups in the cluster")
+	}
+
+	ctx := context.Background()
+	c, err := src.cluster()
+	if err != nil {
+		return err
+	}
+	sgs, err := src.securityGroups(ctx, c, fs.Args())
+	if err != nil {
+		return err
+	}
+	now := time.Now().Format(time.RFC3339)
+	for i := range sgs {
+		sg := &sgs[i]
+		patch := client.MergeFrom(sg.DeepCopy())
+		if sg.Annotations == nil {
+			sg.Annotations = map[string]string{}
+		}
+		sg.Annotations[paasv1.ResyncAnnotation] = now
+		if err := c.Patch(ctx, sg, patch); err != nil {
+			return err
+		}
+		fmt.Printf("securitygroup %s/%s resync requested\n", sg.Namespace, sg.Name)
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
+	"k8s.io/client-go/tools/clientcmd"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	paasv1 "security-group/api/v1"
+)
+
+var scheme = runtime.NewScheme()
+
+func init() {
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = paasv1.AddToScheme(scheme)
+}
+
+// clusterScoped are the kinds that are read from files without a namespace.
+var clusterScoped = map[string]bool{
+	"ClusterSecurityGroupTemplate": true,
+	"SecurityGroupPolicy":          true,
+	"ServiceCatalog":               true,
+	"Namespace":                    true,
+	"Node":                         true,
+}
+
+// stringList is a flag that can be repeated.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+// source is where sgctl reads SecurityGroups and the objects they reference from.
+type source struct {
+	kubeconfig string
+	namespace  string
+	files      stringList
+}
+
+func (s *source) addFlags(fs *flag.FlagSet) {
+	fs.StringVar(&s.kubeconfig, "kubeconfig", "", "Path to the kubeconfig file. Defaults to $KUBECONFIG or ~/.kube/config.")
+	fs.StringVar(&s.namespace, "n", "default", "Namespace of the SecurityGroups.")
+	fs.Var(&s.files, "f", "Read SecurityGroups, AddressGroups, ConfigMaps and ServiceCatalogs from this YAML or JSON file "+
+		"instead of the cluster, e.g. the output of 'kubectl get -o yaml'. Can be repeated.")
+}
+
+// connect returns a client serving the objects of the files, or a client of the cluster
+// if no files are given.
+func (s *source) connect() (client.Client, error) {
+	if len(s.files) > 0 {
+		var objs []runtime.Object
+		for _, name := range s.files {
+			fileObjs, err := s.readFile(name)
+			if err != nil {
+				return nil, err
+			}
+			objs = append(objs, fileObjs...)
+		}
+		return fake.NewFakeClientWithScheme(scheme, objs...), nil
+	}
+	return s.cluster()
+}
+
+// cluster returns a client of the cluster, even if files are given.
+func (s *source) cluster() (client.Client, error) {
+	cfg, err := ctrl.GetConfig()
+	if s.kubeconfig != "" {
+		cfg, err = clientcmd.BuildConfigFromFlags("", s.kubeconfig)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return client.New(cfg, client.Options{Scheme: scheme})
+}
+
+// readFile decodes the objects of a YAML or JSON file. Lists are flattened and namespaced
+// objects without a namespace are put into the namespace of the source.
+func (s *source) readFile(name string) ([]runtime.Object, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	decoder := serializer.NewCodecFactory(scheme).UniversalDeserializer()
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(f))
+	var objs []runtime.Object
+	for {
+		doc, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		if strings.TrimSpace(string(doc)) == "" {
+			continue
+		}
+		obj, _, err := decoder.Decode(doc, nil, nil)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		items, err := s.flatten(decoder, obj)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		objs = append(objs, items...)
+	}
+	return objs, nil
+}
+
+func (s *source) flatten(decoder runtime.Decoder, obj runtime.Object) ([]runtime.Object, error) {
+	if !meta.IsListType(obj) {
+		accessor, err := meta.Accessor(obj)
+		if err != nil {
+			return nil, err
+		}
+		if accessor.GetNamespace() == "" && !clusterScoped[obj.GetObjectKind().GroupVersionKind().Kind] {
+			accessor.SetNamespace(s.namespace)
+		}
+		return []runtime.Object{obj}, nil
+	}
+	items, err := meta.ExtractList(obj)
+	if err != nil {
+		return nil, err
+	}
+	var objs []runtime.Object
+	for _, item := range items {
+		// kubectl 输出的 List 中的对象未解码
+		if u, ok := item.(*runtime.Unknown); ok {
+			if item, _, err = decoder.Decode(u.Raw, nil, nil); err != nil {
+				return nil, err
+			}
+		}
+		flat, err := s.flatten(decoder, item)
+		if err != nil {
+			return nil, err
+		}
+		objs = append(objs, flat...)
+	}
+	return objs, nil
+}
+
+// securityGroups returns the named SecurityGroups of the namespace, or all of them if no
+// names are given.
+func (s *source) securityGroups(ctx context.Context, c client.Reader, names []string) ([]paasv1.SecurityGroup, error) {
+	if len(names) == 0 {
+		sgs := &paasv1.SecurityGroupList{}
+		if err := c.List(ctx, sgs, client.InNamespace(s.namespace)); err != nil {
+			return nil, err
+		}
+		if len(sgs.Items) == 0 {
+			return nil, fmt.Errorf("no SecurityGroups found in namespace %s", s.namespace)
+		}
+		return sgs.Items, nil
+	}
+	sgs := make([]paasv1.SecurityGroup, 0, len(names))
+	for _, name := range names {
+		sg := paasv1.SecurityGroup{}
+		if err := c.Get(ctx, client.ObjectKey{Namespace: s.namespace, Name: name}, &sg); err != nil {
+			return nil, err
+		}
+		sgs = append(sgs, sg)
+	}
+	return sgs, nil
+}
@@ -0,0 +1,374 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"security-group/dcs"
+	"security-group/util"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	paasv1 "security-group/api/v1"
+)
+
+// NodeSecurityGroupBindingReconciler reconciles a NodeSecurityGroupBinding object
+type NodeSecurityGroupBindingReconciler struct {
+	client.Client
+	Log    logr.Logger
+	Scheme *runtime.Scheme
+}
+
+// +kubebuilder:rbac:groups=paas.unicom.cn,resources=nodesecuritygroupbindings,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=paas.unicom.cn,resources=nodesecuritygroupbindings/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups="",resources=nodes,verbs=get;list;watch
+
+const (
+	NodeSecurityGroupBindingFinalizer string = "nodesecuritygroupbinding.finalizers.paas.unicom.cn"
+
+	// bindingRequeueAfter is how long to wait for a referenced SecurityGroup to be created in DCS.
+	bindingRequeueAfter = 30 * time.Second
+)
+
+func (r *NodeSecurityGroupBindingReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	ctx := context.Background()
+	log := r.Log.WithValues("nodesecuritygroupbinding", req.NamespacedName)
+
+	binding := &paasv1.NodeSecurityGroupBinding{}
+	if err := r.Get(ctx, req.NamespacedName, binding); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	if !binding.ObjectMeta.DeletionTimestamp.IsZero() {
+		log.Info("进入删除 NodeSecurityGroupBinding CR 的逻辑")
+		if util.ContainsString(binding.ObjectMeta.Finalizers, NodeSecurityGroupBindingFinalizer) {
+			// 解绑所有已绑定节点上的安全组
+			for _, node := range binding.Status.Nodes {
+				if err := r.detachNode(ctx, binding, node, node.SecurityGroups); err != nil {
+					log.Error(err, "解绑节点安全组失败", "node", node.NodeName)
+					return ctrl.Result{}, err
+				}
+			}
+		}
+		binding.ObjectMeta.Finalizers = util.RemoveString(binding.ObjectMeta.Finalizers, NodeSecurityGroupBindingFinalizer)
+		return ctrl.Result{}, r.Update(ctx, binding)
+	}
+
+	if !util.ContainsString(binding.ObjectMeta.Finalizers, NodeSecurityGroupBindingFinalizer) {
+		log.Info("给 NodeSecurityGroupBinding CR 添加 finalizer")
+		binding.ObjectMeta.Finalizers = append(binding.ObjectMeta.Finalizers, NodeSecurityGroupBindingFinalizer)
+		if err := r.Update(ctx, binding); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	// 获取需要绑定的安全组，尚未在 DCS 中创建的安全组稍后重试
+	groups, pending, err := r.boundSecurityGroups(ctx, binding)
+	if err != nil {
+		binding.Status.SetConditions(paasv1.ReconcileError(err))
+		r.Status().Update(ctx, binding)
+		return ctrl.Result{}, err
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(&binding.Spec.NodeSelector)
+	if err != nil {
+		binding.Status.SetConditions(paasv1.ReconcileError(err))
+		r.Status().Update(ctx, binding)
+		return ctrl.Result{}, nil
+	}
+	nodes := &corev1.NodeList{}
+	if err := r.List(ctx, nodes, client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// 计算期望绑定的节点
+	desired := map[string]paasv1.BoundNode{}
+	for _, node := range nodes.Items {
+		if !node.DeletionTimestamp.IsZero() {
+			continue
+		}
+		instanceId := instanceIdFromProviderID(node.Spec.ProviderID)
+		if instanceId == "" {
+			log.Info("节点没有 providerID，跳过", "node", node.Name)
+			continue
+		}
+		desired[node.Name] = paasv1.BoundNode{NodeName: node.Name, InstanceId: instanceId, SecurityGroups: groups}
+	}
+
+	var errs []string
+	var bound []paasv1.BoundNode
+	// 解绑失败的安全组仍记录在 status 中，等待下次调谐
+	failed := map[string][]paasv1.BoundSecurityGroup{}
+	// 解绑已离开的节点和不再需要的安全组
+	for _, node := range binding.Status.Nodes {
+		want, ok := desired[node.NodeName]
+		if !ok || want.InstanceId != node.InstanceId {
+			log.Info("节点已离开，解绑安全组", "node", node.NodeName)
+			if err := r.detachNode(ctx, binding, node, node.SecurityGroups); err != nil {
+				errs = append(errs, err.Error())
+				bound = append(bound, node)
+			}
+			continue
+		}
+		for _, g := range node.SecurityGroups {
+			if containsBoundSecurityGroup(want.SecurityGroups, g) || util.ContainsString(pending, g.Name) {
+				continue
+			}
+			if err := r.detachNode(ctx, binding, node, []paasv1.BoundSecurityGroup{g}); err != nil {
+				errs = append(errs, err.Error())
+				failed[node.NodeName] = append(failed[node.NodeName], g)
+			}
+		}
+	}
+
+	// 给新加入的节点绑定安全组
+	for _, name := range sortedKeys(desired) {
+		want := desired[name]
+		current := paasv1.BoundNode{NodeName: want.NodeName, InstanceId: want.InstanceId}
+		if existing := binding.Status.GetNode(name); existing != nil && existing.InstanceId == want.InstanceId {
+			current.SecurityGroups = existing.SecurityGroups
+		}
+		for _, g := range want.SecurityGroups {
+			if containsBoundSecurityGroup(current.SecurityGroups, g) {
+				continue
+			}
+			if err := r.attachSecurityGroup(ctx, binding, g, want.InstanceId); err != nil {
+				errs = append(errs, err.Error())
+				continue
+			}
+			log.Info("节点绑定安全组成功", "node", name, "securitygroup", g.Name)
+			current.SecurityGroups = append(current.SecurityGroups, g)
+		}
+		// 记录期望的安全组及其账号，并保留暂不可用的安全组，等待下次调谐
+		var kept []paasv1.BoundSecurityGroup
+		for _, g := range want.SecurityGroups {
+			if containsBoundSecurityGroup(current.SecurityGroups, g) {
+				kept = append(kept, g)
+			}
+		}
+		for _, g := range current.SecurityGroups {
+			if !containsBoundSecurityGroup(want.SecurityGroups, g) &&
+				(util.ContainsString(pending, g.Name) || containsBoundSecurityGroup(failed[name], g)) {
+				kept = append(kept, g)
+			}
+		}
+		current.SecurityGroups = kept
+		bound = append(bound, current)
+	}
+	binding.Status.Nodes = bound
+
+	if len(errs) > 0 {
+		err := fmt.Errorf("%s", strings.Join(errs, "; "))
+		binding.Status.SetConditions(paasv1.Unavailable().WithMessage(err.Error()), paasv1.ReconcileError(err))
+		r.Status().Update(ctx, binding)
+		return ctrl.Result{}, err
+	}
+	binding.Status.SetConditions(paasv1.Available(), paasv1.ReconcileSuccess())
+	if err := r.Status().Update(ctx, binding); err != nil {
+		return ctrl.Result{}, err
+	}
+	if len(pending) > 0 {
+		log.Info("等待安全组创建完成", "securitygroups", pending)
+		return ctrl.Result{RequeueAfter: bindingRequeueAfter}, nil
+	}
+	return ctrl.Result{}, nil
+}
+
+// boundSecurityGroups returns the referenced security groups that exist in DCS and the
+// names of the ones that are not created yet. Security groups whose SecurityGroup is being
+// deleted are neither, so that they are detached before the SecurityGroup deletes them.
+func (r *NodeSecurityGroupBindingReconciler) boundSecurityGroups(ctx context.Context, binding *paasv1.NodeSecurityGroupBinding) ([]paasv1.BoundSecurityGroup, []string, error) {
+	var groups []paasv1.BoundSecurityGroup
+	var pending []string
+	for _, name := range binding.Spec.SecurityGroups {
+		sg := &paasv1.SecurityGroup{}
+		if err := r.Get(ctx, types.NamespacedName{Namespace: binding.Namespace, Name: name}, sg); err != nil {
+			if client.IgnoreNotFound(err) != nil {
+				return nil, nil, err
+			}
+			pending = append(pending, name)
+			continue
+		}
+		if !sg.DeletionTimestamp.IsZero() {
+			continue
+		}
+		if sg.Status.Id == "" {
+			pending = append(pending, name)
+			continue
+		}
+		groups = append(groups, paasv1.BoundSecurityGroup{Name: name, Id: sg.Status.Id, AccountId: sg.Spec.AccountId, UserId: sg.Spec.UserId})
+	}
+	return groups, pending, nil
+}
+
+// detachNode detaches the given security groups from the node's instance. Paused
+// SecurityGroups are not detached. The security groups of deleted SecurityGroups are
+// detached with the account recorded in the status, unless they are gone from DCS.
+func (r *NodeSecurityGroupBindingReconciler) detachNode(ctx context.Context, binding *paasv1.NodeSecurityGroupBinding, node paasv1.BoundNode, groups []paasv1.BoundSecurityGroup) error {
+	for _, g := range groups {
+		account := dcs.Account{AccountId: g.AccountId, UserId: g.UserId}
+		sg := &paasv1.SecurityGroup{}
+		err := r.Get(ctx, types.NamespacedName{Namespace: binding.Namespace, Name: g.Name}, sg)
+		switch {
+		case err == nil:
+			if sg.Annotations[paasv1.PausedAnnotation] == "true" {
+				return pausedError(g.Name)
+			}
+			account = dcs.AccountOf(sg)
+		case client.IgnoreNotFound(err) != nil:
+			return err
+		case account.AccountId == "":
+			// 早期版本的 status 没有记录账号，无法解绑
+			r.Log.Info("SecurityGroup 已删除且 status 中没有账号，跳过解绑", "securitygroup", g.Name, "id", g.Id, "node", node.NodeName)
+			continue
+		default:
+			// SecurityGroup CR 已删除，DCS 中的安全组可能仍然存在（如 CreateOnly），按 status 中的 id 解绑
+			remote, err := dcsClient.GetSecurityGroup(ctx, account, g.Id)
+			if err != nil {
+				return err
+			}
+			if remote == nil {
+				continue
+			}
+		}
+		if err := dcsClient.DetachInstance(ctx, account, g.Id, node.InstanceId); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// attachSecurityGroup attaches the security group to the instance, unless its SecurityGroup
+// is paused.
+func (r *NodeSecurityGroupBindingReconciler) attachSecurityGroup(ctx context.Context, binding *paasv1.NodeSecurityGroupBinding, g paasv1.BoundSecurityGroup, instanceId string) error {
+	sg := &paasv1.SecurityGroup{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: binding.Namespace, Name: g.Name}, sg); err != nil {
+		return err
+	}
+	if sg.Annotations[paasv1.PausedAnnotation] == "true" {
+		return pausedError(g.Name)
+	}
+	return dcsClient.AttachInstance(ctx, dcs.AccountOf(sg), g.Id, instanceId)
+}
+
+// pausedError reports that a security group is not attached or detached because its
+// SecurityGroup is paused. The binding keeps its state until the SecurityGroup is resumed.
+func pausedError(name string) error {
+	return fmt.Errorf("SecurityGroup %s is paused", name)
+}
+
+// instanceIdFromProviderID returns the DCS instance id from a node's providerID,
+// e.g. "dcs://i-123456" or "dcs:///region/i-123456". It returns "" for providerIDs without
+// a scheme or an instance id.
+func instanceIdFromProviderID(providerID string) string {
+	i := strings.Index(providerID, "://")
+	if i <= 0 {
+		return ""
+	}
+	path := providerID[i+len("://"):]
+	return strings.TrimSpace(path[strings.LastIndex(path, "/")+1:])
+}
+
+func containsBoundSecurityGroup(groups []paasv1.BoundSecurityGroup, g paasv1.BoundSecurityGroup) bool {
+	for _, item := range groups {
+		if item.Name == g.Name && item.Id == g.Id {
+			return true
+		}
+	}
+	return false
+}
+
+// containsSecurityGroup reports whether a security group of the SecurityGroup is bound.
+func containsSecurityGroup(groups []paasv1.BoundSecurityGroup, name string) bool {
+	for _, item := range groups {
+		if item.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys(m map[string]paasv1.BoundNode) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// bindingsInNamespace enqueues every binding in the namespace.
+func (r *NodeSecurityGroupBindingReconciler) bindingsInNamespace(ns string) []reconcile.Request {
+	bindings := &paasv1.NodeSecurityGroupBindingList{}
+	if err := r.List(context.Background(), bindings, client.InNamespace(ns)); err != nil {
+		r.Log.Error(err, "获取 NodeSecurityGroupBinding 列表失败")
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(bindings.Items))
+	for _, b := range bindings.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: b.Namespace, Name: b.Name}})
+	}
+	return requests
+}
+
+// bindingsForNode enqueues the bindings whose selector matches the node, and the bindings
+// the node is bound by, which detach it once it no longer matches.
+func (r *NodeSecurityGroupBindingReconciler) bindingsForNode(a handler.MapObject) []reconcile.Request {
+	bindings := &paasv1.NodeSecurityGroupBindingList{}
+	if err := r.List(context.Background(), bindings); err != nil {
+		r.Log.Error(err, "获取 NodeSecurityGroupBinding 列表失败")
+		return nil
+	}
+	var requests []reconcile.Request
+	for _, b := range bindings.Items {
+		selector, err := metav1.LabelSelectorAsSelector(&b.Spec.NodeSelector)
+		if (err == nil && selector.Matches(labels.Set(a.Meta.GetLabels()))) || b.Status.GetNode(a.Meta.GetName()) != nil {
+			requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: b.Namespace, Name: b.Name}})
+		}
+	}
+	return requests
+}
+
+func (r *NodeSecurityGroupBindingReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&paasv1.NodeSecurityGroupBinding{}).
+		// 节点加入、离开或标签变化时，重新调谐选中它或已绑定它的 binding
+		Watches(&source.Kind{Type: &corev1.Node{}}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: handler.ToRequestsFunc(r.bindingsForNode),
+		}).
+		// 安全组创建完成后，重新调谐同命名空间的 binding
+		Watches(&source.Kind{Type: &paasv1.SecurityGroup{}}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: handler.ToRequestsFunc(func(a handler.MapObject) []reconcile.Request {
+				return r.bindingsInNamespace(a.Meta.GetNamespace())
+			}),
+		}).
+		Complete(r)
+}
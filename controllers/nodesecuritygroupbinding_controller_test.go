@@ -0,0 +1,185 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	paasv1 "security-group/api/v1"
+	"security-group/dcs"
+	dcsfake "security-group/dcs/fake"
+)
+
+func TestInstanceIdFromProviderID(t *testing.T) {
+	tests := []struct {
+		providerID string
+		want       string
+	}{
+		{providerID: "dcs://i-123456", want: "i-123456"},
+		{providerID: "dcs:///region/i-123456", want: "i-123456"},
+		{providerID: "dcs:///region/zone/i-123456", want: "i-123456"},
+		{providerID: "", want: ""},
+		{providerID: "i-123456", want: ""},
+		{providerID: "://i-123456", want: ""},
+		{providerID: "dcs://", want: ""},
+		{providerID: "dcs:///", want: ""},
+		{providerID: "dcs:///region/", want: ""},
+	}
+	for _, tt := range tests {
+		if got := instanceIdFromProviderID(tt.providerID); got != tt.want {
+			t.Errorf("instanceIdFromProviderID(%q) = %q, want %q", tt.providerID, got, tt.want)
+		}
+	}
+}
+
+func newTestBinding(status ...paasv1.BoundNode) *paasv1.NodeSecurityGroupBinding {
+	return &paasv1.NodeSecurityGroupBinding{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "web", Finalizers: []string{NodeSecurityGroupBindingFinalizer}},
+		Spec: paasv1.NodeSecurityGroupBindingSpec{
+			NodeSelector:   metav1.LabelSelector{MatchLabels: map[string]string{"role": "web"}},
+			SecurityGroups: []string{"web"},
+		},
+		Status: paasv1.NodeSecurityGroupBindingStatus{Nodes: status},
+	}
+}
+
+func newTestNode(name string, labels map[string]string) *corev1.Node {
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels},
+		Spec:       corev1.NodeSpec{ProviderID: "dcs://i-" + name},
+	}
+}
+
+func TestBindingAttachDetach(t *testing.T) {
+	api := &dcsfake.Client{}
+	defer func(c dcs.Client) { dcsClient = c }(dcsClient)
+	dcsClient = api
+	sg := &paasv1.SecurityGroup{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "web"},
+		Spec:       paasv1.SecurityGroupSpec{AccountId: "acc", UserId: "user"},
+		Status:     paasv1.SecurityGroupStatus{Id: "1"},
+	}
+	node := newTestNode("a", map[string]string{"role": "web"})
+	r := &NodeSecurityGroupBindingReconciler{
+		Client: fake.NewFakeClientWithScheme(newTestScheme(t), sg, node, newTestBinding()),
+		Log:    logf.Log,
+	}
+	ctx := context.Background()
+	key := types.NamespacedName{Namespace: "ns", Name: "web"}
+	if _, err := r.Reconcile(ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatal(err)
+	}
+	binding := &paasv1.NodeSecurityGroupBinding{}
+	if err := r.Get(ctx, key, binding); err != nil {
+		t.Fatal(err)
+	}
+	want := []paasv1.BoundNode{{NodeName: "a", InstanceId: "i-a", SecurityGroups: []paasv1.BoundSecurityGroup{
+		{Name: "web", Id: "1", AccountId: "acc", UserId: "user"},
+	}}}
+	if !reflect.DeepEqual(binding.Status.Nodes, want) {
+		t.Errorf("status nodes = %+v, want %+v", binding.Status.Nodes, want)
+	}
+
+	// 节点不再匹配后解绑
+	node.Labels = nil
+	if err := r.Update(ctx, node); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"attach 1 i-a", "detach 1 i-a"}; !reflect.DeepEqual(api.Calls, want) {
+		t.Errorf("calls = %v, want %v", api.Calls, want)
+	}
+}
+
+func TestBindingDetachDeletedSecurityGroup(t *testing.T) {
+	bound := func(id string) paasv1.BoundNode {
+		return paasv1.BoundNode{NodeName: "a", InstanceId: "i-a", SecurityGroups: []paasv1.BoundSecurityGroup{
+			{Name: "web", Id: id, AccountId: "acc", UserId: "user"},
+		}}
+	}
+	tests := []struct {
+		name  string
+		node  paasv1.BoundNode
+		calls []string
+	}{
+		{name: "security group kept in DCS", node: bound("1"), calls: []string{"detach 1 i-a"}},
+		{name: "security group deleted from DCS", node: bound("2")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := &dcsfake.Client{Groups: []dcs.SecurityGroup{{Id: "1"}}}
+			defer func(c dcs.Client) { dcsClient = c }(dcsClient)
+			dcsClient = api
+			// SecurityGroup CR 已删除，按 status 中记录的 id 和账号解绑
+			binding := newTestBinding(tt.node)
+			now := metav1.Now()
+			binding.DeletionTimestamp = &now
+			r := &NodeSecurityGroupBindingReconciler{
+				Client: fake.NewFakeClientWithScheme(newTestScheme(t), binding),
+				Log:    logf.Log,
+			}
+			if _, err := r.Reconcile(ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "ns", Name: "web"}}); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(api.Calls, tt.calls) {
+				t.Errorf("calls = %v, want %v", api.Calls, tt.calls)
+			}
+		})
+	}
+}
+
+func TestBindingsForNode(t *testing.T) {
+	other := newTestBinding()
+	other.Name = "db"
+	other.Spec.NodeSelector = metav1.LabelSelector{MatchLabels: map[string]string{"role": "db"}}
+	bound := newTestBinding(paasv1.BoundNode{NodeName: "b", InstanceId: "i-b"})
+	bound.Name = "bound"
+	bound.Spec.NodeSelector = other.Spec.NodeSelector
+	r := &NodeSecurityGroupBindingReconciler{
+		Client: fake.NewFakeClientWithScheme(newTestScheme(t), newTestBinding(), other, bound),
+		Log:    logf.Log,
+	}
+	tests := []struct {
+		node *corev1.Node
+		want []string
+	}{
+		{node: newTestNode("a", map[string]string{"role": "web"}), want: []string{"web"}},
+		{node: newTestNode("b", nil), want: []string{"bound"}},
+		{node: newTestNode("c", map[string]string{"role": "cache"})},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, req := range r.bindingsForNode(handler.MapObject{Meta: tt.node, Object: tt.node}) {
+			got = append(got, req.Name)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("bindingsForNode(%s) = %v, want %v", tt.node.Name, got, tt.want)
+		}
+	}
+}
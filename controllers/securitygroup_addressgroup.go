@@ -0,0 +1,137 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	toolscache "k8s.io/client-go/tools/cache"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	paasv1 "security-group/api/v1"
+	"security-group/planner"
+	"security-group/rules"
+)
+
+// +kubebuilder:rbac:groups=paas.unicom.cn,resources=addressgroups,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch
+
+// addressGroupIndex indexes SecurityGroups by the address groups their rules reference.
+const addressGroupIndex string = ".spec.rules.addressGroup"
+
+// indexAddressGroups returns the address groups the rules of a SecurityGroup and its
+// template reference.
+func indexAddressGroups(obj runtime.Object) []string {
+	return rules.AddressGroups(planner.SpecRules(obj.(*paasv1.SecurityGroup)))
+}
+
+// securityGroupsForAddressGroup enqueues the SecurityGroups that reference the address group.
+func (r *SecurityGroupReconciler) securityGroupsForAddressGroup(namespace, name string) []reconcile.Request {
+	sgs := &paasv1.SecurityGroupList{}
+	if err := r.List(context.Background(), sgs, client.InNamespace(namespace), client.MatchingFields{addressGroupIndex: name}); err != nil {
+		r.Log.Error(err, "获取引用地址组的 SecurityGroup 列表失败", "addressgroup", name)
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(sgs.Items))
+	for _, sg := range sgs.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: sg.Namespace, Name: sg.Name}})
+	}
+	return requests
+}
+
+// securityGroupsForConfigMap enqueues the SecurityGroups that reference an address group
+// sourced from the ConfigMap.
+func (r *SecurityGroupReconciler) securityGroupsForConfigMap(namespace, name string) []reconcile.Request {
+	ags := &paasv1.AddressGroupList{}
+	if err := r.List(context.Background(), ags, client.InNamespace(namespace)); err != nil {
+		r.Log.Error(err, "获取 AddressGroup 列表失败")
+		return nil
+	}
+	var requests []reconcile.Request
+	for _, ag := range ags.Items {
+		if ag.Spec.ConfigMapRef != nil && ag.Spec.ConfigMapRef.Name == name {
+			requests = append(requests, r.securityGroupsForAddressGroup(namespace, ag.Name)...)
+		}
+	}
+	return requests
+}
+
+// configMapInformer returns an informer of the ConfigMaps labeled for address groups, run
+// by the manager, so that the other ConfigMaps of the cluster are not cached.
+func configMapInformer(mgr ctrl.Manager) (toolscache.SharedIndexInformer, error) {
+	clientset, err := kubernetes.NewForConfig(mgr.GetConfig())
+	if err != nil {
+		return nil, err
+	}
+	factory := informers.NewSharedInformerFactoryWithOptions(clientset, 0, informers.WithTweakListOptions(func(o *metav1.ListOptions) {
+		o.LabelSelector = paasv1.AddressGroupConfigMapLabel
+	}))
+	informer := factory.Core().V1().ConfigMaps().Informer()
+	return informer, mgr.Add(manager.RunnableFunc(func(stop <-chan struct{}) error {
+		factory.Start(stop)
+		<-stop
+		return nil
+	}))
+}
+
+// NewClient creates the client of the manager. It reads ConfigMaps from the API server, as
+// the cache would watch every ConfigMap of the cluster, and everything else from the cache.
+func NewClient(c cache.Cache, config *rest.Config, options client.Options) (client.Client, error) {
+	apiClient, err := client.New(config, options)
+	if err != nil {
+		return nil, err
+	}
+	return &client.DelegatingClient{
+		Reader: &configMapReader{
+			Reader:     &client.DelegatingReader{CacheReader: c, ClientReader: apiClient},
+			configMaps: apiClient,
+		},
+		Writer:       apiClient,
+		StatusClient: apiClient,
+	}, nil
+}
+
+// configMapReader reads ConfigMaps with a reader of its own.
+type configMapReader struct {
+	client.Reader
+	configMaps client.Reader
+}
+
+func (r *configMapReader) Get(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+	if _, ok := obj.(*corev1.ConfigMap); ok {
+		return r.configMaps.Get(ctx, key, obj)
+	}
+	return r.Reader.Get(ctx, key, obj)
+}
+
+func (r *configMapReader) List(ctx context.Context, list runtime.Object, opts ...client.ListOption) error {
+	if _, ok := list.(*corev1.ConfigMapList); ok {
+		return r.configMaps.List(ctx, list, opts...)
+	}
+	return r.Reader.List(ctx, list, opts...)
+}
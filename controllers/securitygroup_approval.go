@@ -0,0 +1,250 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	paasv1 "security-group/api/v1"
+	"security-group/planner"
+	"security-group/rules"
+)
+
+// +kubebuilder:rbac:groups=paas.unicom.cn,resources=securitygroupchangerequests,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=paas.unicom.cn,resources=securitygroupchangerequests/status,verbs=get;update;patch
+
+const (
+	ReasonChangeRequested string = "ChangeRequested"
+	ReasonChangeApproved  string = "ChangeApproved"
+	ReasonChangeRejected  string = "ChangeRejected"
+)
+
+// requiresApproval reports whether changes to the spec must be approved, either because
+// the spec requires it or because the last approved spec did.
+func requiresApproval(sg *paasv1.SecurityGroup) bool {
+	return sg.Spec.RequireApproval || sg.Status.ApprovedSpecHash != ""
+}
+
+// errApprovalsDisabled is the error of SecurityGroups that require approval when the
+// webhooks are not served, as anyone could then approve their changes.
+var errApprovalsDisabled = errors.New("changes that require approval can only be approved with the webhooks enabled")
+
+// SecurityGroupsRequiringApproval returns the namespaced names of the SecurityGroups whose
+// changes must be approved.
+func SecurityGroupsRequiringApproval(ctx context.Context, c client.Reader) ([]string, error) {
+	sgs := &paasv1.SecurityGroupList{}
+	if err := c.List(ctx, sgs); err != nil {
+		return nil, err
+	}
+	var names []string
+	for i := range sgs.Items {
+		if requiresApproval(&sgs.Items[i]) {
+			names = append(names, sgs.Items[i].Namespace+"/"+sgs.Items[i].Name)
+		}
+	}
+	return names, nil
+}
+
+// checkApproval reports whether the current spec of a SecurityGroup that requires approval
+// is approved. A spec that is not approved gets a SecurityGroupChangeRequest with the
+// changes it makes to DCS, and is applied once the change request is approved.
+func (r *SecurityGroupReconciler) checkApproval(ctx context.Context, sg *paasv1.SecurityGroup) (bool, error) {
+	if !r.Approvals {
+		return false, r.ruleError(ctx, sg, errApprovalsDisabled)
+	}
+	hash, err := r.specHash(ctx, sg)
+	if err != nil {
+		return false, r.ruleError(ctx, sg, err)
+	}
+	if hash == sg.Status.ApprovedSpecHash {
+		return true, nil
+	}
+
+	name := sg.Name + "-" + hash[:10]
+	cr := &paasv1.SecurityGroupChangeRequest{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: sg.Namespace, Name: name}, cr); err != nil {
+		if apierrors.IsNotFound(err) {
+			return false, r.requestChange(ctx, sg, name, hash)
+		}
+		return false, err
+	}
+
+	// 只信任控制器为当前 spec 创建的变更请求
+	if cr.Spec.SpecHash != hash || !metav1.IsControlledBy(cr, sg) {
+		return false, r.ruleError(ctx, sg, fmt.Errorf("change request %s was not requested by the controller for the current spec", name))
+	}
+
+	switch cr.Status.Decision {
+	case paasv1.DecisionApproved:
+		// 关闭审批的变更通过后，不再需要审批
+		if sg.Spec.RequireApproval {
+			sg.Status.ApprovedSpecHash = hash
+		} else {
+			sg.Status.ApprovedSpecHash = ""
+		}
+		sg.Status.SetConditions(paasv1.Approval(paasv1.ConditionTrue, paasv1.ReasonApproved, name))
+		r.Recorder.Eventf(sg, corev1.EventTypeNormal, ReasonChangeApproved, "Change request %s was approved by %s", name, cr.Status.DecidedBy)
+		if err := r.Status().Update(ctx, sg); err != nil {
+			return false, err
+		}
+		return true, r.setChangeRequestPhase(ctx, cr, paasv1.ChangeRequestApproved)
+	case paasv1.DecisionRejected:
+		if cr.Status.Phase != paasv1.ChangeRequestRejected {
+			sg.Status.SetConditions(paasv1.Approval(paasv1.ConditionFalse, paasv1.ReasonRejected, name))
+			r.Recorder.Eventf(sg, corev1.EventTypeWarning, ReasonChangeRejected, "Change request %s was rejected by %s", name, cr.Status.DecidedBy)
+			if err := r.Status().Update(ctx, sg); err != nil {
+				return false, err
+			}
+		}
+		return false, r.setChangeRequestPhase(ctx, cr, paasv1.ChangeRequestRejected)
+	default:
+		// spec 改回了一个被取代的变更，重新等待审批
+		if cr.Status.Phase != paasv1.ChangeRequestPending {
+			if err := r.setChangeRequestPhase(ctx, cr, paasv1.ChangeRequestPending); err != nil {
+				return false, err
+			}
+			if err := r.supersedeChangeRequests(ctx, sg, name); err != nil {
+				return false, err
+			}
+			sg.Status.SetConditions(paasv1.Approval(paasv1.ConditionFalse, paasv1.ReasonAwaitingApproval, name))
+			return false, r.Status().Update(ctx, sg)
+		}
+		return false, nil
+	}
+}
+
+// requestChange creates a change request for the current spec of the SecurityGroup and
+// supersedes the pending change requests for its previous specs.
+func (r *SecurityGroupReconciler) requestChange(ctx context.Context, sg *paasv1.SecurityGroup, name, hash string) error {
+	// 没有记录修改者的变更无法判断审批人是否为申请人
+	if sg.Annotations[paasv1.ChangedByAnnotation] == "" {
+		return r.ruleError(ctx, sg, fmt.Errorf("the %s annotation is not set, change the spec again with the webhooks enabled", paasv1.ChangedByAnnotation))
+	}
+	changes, err := r.plannedChanges(ctx, sg)
+	if err != nil {
+		return r.ruleError(ctx, sg, err)
+	}
+	cr := &paasv1.SecurityGroupChangeRequest{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: sg.Namespace},
+		Spec: paasv1.SecurityGroupChangeRequestSpec{
+			SecurityGroup: sg.Name,
+			SpecHash:      hash,
+			RequestedBy:   sg.Annotations[paasv1.ChangedByAnnotation],
+			Changes:       changes,
+		},
+		Status: paasv1.SecurityGroupChangeRequestStatus{
+			Phase: paasv1.ChangeRequestPending,
+			Time:  time.Now().Format(time.RFC3339),
+		},
+	}
+	if err := controllerutil.SetControllerReference(sg, cr, r.Scheme); err != nil {
+		return err
+	}
+	status := cr.Status
+	if err := r.Create(ctx, cr); err != nil {
+		return err
+	}
+	// 创建时忽略 status，需通过 status 子资源写入
+	cr.Status = status
+	if err := r.Status().Update(ctx, cr); err != nil {
+		return err
+	}
+	if err := r.supersedeChangeRequests(ctx, sg, name); err != nil {
+		return err
+	}
+	sg.Status.SetConditions(paasv1.Approval(paasv1.ConditionFalse, paasv1.ReasonAwaitingApproval, name))
+	r.Recorder.Eventf(sg, corev1.EventTypeNormal, ReasonChangeRequested, "Change request %s waits for approval: %s", name, planner.Summary(changes))
+	return r.Status().Update(ctx, sg)
+}
+
+// supersedeChangeRequests marks the pending change requests of the SecurityGroup other than
+// current as superseded, so that they can no longer be approved.
+func (r *SecurityGroupReconciler) supersedeChangeRequests(ctx context.Context, sg *paasv1.SecurityGroup, current string) error {
+	crs := &paasv1.SecurityGroupChangeRequestList{}
+	if err := r.List(ctx, crs, client.InNamespace(sg.Namespace)); err != nil {
+		return err
+	}
+	for i := range crs.Items {
+		cr := &crs.Items[i]
+		if cr.Spec.SecurityGroup != sg.Name || cr.Name == current || cr.Status.Phase != paasv1.ChangeRequestPending {
+			continue
+		}
+		if err := r.setChangeRequestPhase(ctx, cr, paasv1.ChangeRequestSuperseded); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *SecurityGroupReconciler) setChangeRequestPhase(ctx context.Context, cr *paasv1.SecurityGroupChangeRequest, phase string) error {
+	if cr.Status.Phase == phase {
+		return nil
+	}
+	cr.Status.Phase = phase
+	cr.Status.Time = time.Now().Format(time.RFC3339)
+	return r.Status().Update(ctx, cr)
+}
+
+// specHash identifies what an approval approves: the spec of a SecurityGroup, what was
+// rendered from its template, and the normalized rules it can send to DCS with the address
+// groups, services and Service rules expanded, so that a change to any of them must be
+// approved as well. The rules include the scheduled and temporary rules whatever their
+// window, which opens and closes without a new approval.
+func (r *SecurityGroupReconciler) specHash(ctx context.Context, sg *paasv1.SecurityGroup) (string, error) {
+	expanded, err := planner.Expand(ctx, r, sg.Namespace, planner.SpecRules(sg), false)
+	if err != nil {
+		return "", err
+	}
+	if r.ServiceRules {
+		generated, err := r.serviceRules(ctx, sg)
+		if err != nil {
+			return "", err
+		}
+		expanded = append(expanded, generated...)
+	}
+	normalized, err := rules.Normalize(expanded)
+	if err != nil {
+		return "", err
+	}
+	specRules := make([]paasv1.SecurityGroupRule, 0, len(normalized))
+	for _, rule := range normalized {
+		specRules = append(specRules, rule.Spec())
+	}
+	b, err := json.Marshal(struct {
+		Spec     paasv1.SecurityGroupSpec
+		Template *paasv1.RenderedTemplate
+		Rules    []paasv1.SecurityGroupRule
+	}{sg.Spec, renderedOnly(sg.Status.Template), specRules})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
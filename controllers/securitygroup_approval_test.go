@@ -0,0 +1,99 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	paasv1 "security-group/api/v1"
+)
+
+func TestCheckApprovalForgedRequest(t *testing.T) {
+	sg := &paasv1.SecurityGroup{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "web", UID: "uid-web"},
+		Spec:       paasv1.SecurityGroupSpec{RequireApproval: true},
+	}
+	hash, err := (&SecurityGroupReconciler{Client: fake.NewFakeClientWithScheme(newTestScheme(t))}).specHash(context.Background(), sg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	approved := paasv1.SecurityGroupChangeRequestStatus{Phase: paasv1.ChangeRequestPending, Decision: paasv1.DecisionApproved, DecidedBy: "mallory"}
+	isController := true
+	owner := []metav1.OwnerReference{{APIVersion: paasv1.GroupVersion.String(), Kind: "SecurityGroup", Name: "web", UID: "uid-web", Controller: &isController}}
+	tests := []struct {
+		name string
+		cr   *paasv1.SecurityGroupChangeRequest
+	}{
+		{name: "not controlled by the SecurityGroup", cr: &paasv1.SecurityGroupChangeRequest{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "web-" + hash[:10]},
+			Spec:       paasv1.SecurityGroupChangeRequestSpec{SecurityGroup: "web", SpecHash: hash},
+			Status:     approved,
+		}},
+		{name: "other spec hash", cr: &paasv1.SecurityGroupChangeRequest{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "web-" + hash[:10], OwnerReferences: owner},
+			Spec:       paasv1.SecurityGroupChangeRequestSpec{SecurityGroup: "web", SpecHash: hash[:10]},
+			Status:     approved,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &SecurityGroupReconciler{
+				Client:    fake.NewFakeClientWithScheme(newTestScheme(t), sg.DeepCopy(), tt.cr),
+				Log:       logf.Log,
+				Approvals: true,
+			}
+			ok, err := r.checkApproval(context.Background(), sg.DeepCopy())
+			if ok || err == nil {
+				t.Errorf("checkApproval() = %v, %v, want not approved with an error", ok, err)
+			}
+		})
+	}
+}
+
+func TestSpecHashCoversExpandedRules(t *testing.T) {
+	sg := &paasv1.SecurityGroup{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "web"},
+		Spec: paasv1.SecurityGroupSpec{RequireApproval: true, Rules: []paasv1.SecurityGroupRule{
+			{Direction: "ingress", Protocol: "tcp", Ports: "443", AddressGroup: "partners"},
+		}},
+	}
+	ag := &paasv1.AddressGroup{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "partners"},
+		Spec:       paasv1.AddressGroupSpec{CIDRs: []string{"192.0.2.0/24"}},
+	}
+	r := &SecurityGroupReconciler{Client: fake.NewFakeClientWithScheme(newTestScheme(t), ag)}
+	before, err := r.specHash(context.Background(), sg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ag.Spec.CIDRs = append(ag.Spec.CIDRs, "198.51.100.0/24")
+	if err := r.Update(context.Background(), ag); err != nil {
+		t.Fatal(err)
+	}
+	after, err := r.specHash(context.Background(), sg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if before == after {
+		t.Error("specHash did not change with the address group")
+	}
+}
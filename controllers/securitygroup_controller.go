@@ -19,16 +19,20 @@ package controllers
 import (
 	"context"
 	"fmt"
-	"github.com/antihax/optional"
 	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
-	"paas.unicom.cn/dcs-sdk/dcsapi"
-	"paas.unicom.cn/dcs-sdk/dcsapi/model/securitygroup"
+	"k8s.io/client-go/tools/record"
 	"reflect"
+	"security-group/dcs"
+	"security-group/planner"
 	"security-group/util"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
-	"strconv"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+	"strings"
 
 	paasv1 "security-group/api/v1"
 )
@@ -36,8 +40,18 @@ import (
 // SecurityGroupReconciler reconciles a SecurityGroup object
 type SecurityGroupReconciler struct {
 	client.Client
-	Log    logr.Logger
-	Scheme *runtime.Scheme
+	Log      logr.Logger
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+	// ReconcileMode is the mode of every SecurityGroup, either apply or plan.
+	ReconcileMode string
+	// ServiceRules enables rules generated from annotated NodePort and LoadBalancer Services.
+	ServiceRules bool
+	// ClusterName is the value of the cluster tag of the security groups in DCS.
+	ClusterName string
+	// Approvals is true if the webhooks that enforce who decides on change requests are
+	// served. SecurityGroups that require approval are not reconciled without them.
+	Approvals bool
 }
 
 type SecurityGroup struct {
@@ -47,13 +61,15 @@ type SecurityGroup struct {
 
 // +kubebuilder:rbac:groups=paas.unicom.cn,resources=securitygroups,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=paas.unicom.cn,resources=securitygroups/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+// +kubebuilder:rbac:groups=paas.unicom.cn,resources=servicecatalogs,verbs=get;list;watch
 
 const (
 	SecurityGroupFinalizer string = "securitygroup.finalizers.paas.unicom.cn"
 )
 
-var config = dcsapi.NewConfigurationWithBasePath("http://172.31.248.3:30086")
-var c = dcsapi.NewAPIClient(config)
+// dcsClient makes the calls to DCS.
+var dcsClient = dcs.New(dcs.DefaultBasePath)
 
 func (r *SecurityGroupReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	ctx := context.Background()
@@ -70,6 +86,27 @@ func (r *SecurityGroupReconciler) Reconcile(req ctrl.Request) (ctrl.Result, erro
 		}
 	}
 
+	// 暂停时不对 DCS 做任何修改，包括删除
+	if sg.Annotations[paasv1.PausedAnnotation] == "true" {
+		log.Info("SecurityGroup CR 已暂停，跳过调谐")
+		sg.Status.SetConditions(paasv1.Paused())
+		if err := r.Status().Update(ctx, sg); err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, nil
+	}
+	if sg.Status.GetCondition(paasv1.TypePaused).Status == paasv1.ConditionTrue {
+		log.Info("SecurityGroup CR 恢复调谐")
+		sg.Status.SetConditions(paasv1.Resumed())
+		if err := r.Status().Update(ctx, sg); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	if resync := sg.Annotations[paasv1.ResyncAnnotation]; resync != "" {
+		log.Info("SecurityGroup CR 请求重新同步", "resync", resync)
+	}
+
 	if sg.ObjectMeta.DeletionTimestamp.IsZero() {
 		log.Info("进入 apply SecurityGroup CR 逻辑")
 		// 确保 resource 的 finalizers 里有控制器指定的 finalizer
@@ -80,13 +117,95 @@ func (r *SecurityGroupReconciler) Reconcile(req ctrl.Request) (ctrl.Result, erro
 				return ctrl.Result{}, err
 			}
 		}
+		// 渲染引用的模板，模板错误时不修改 DCS
+		if err := r.renderTemplate(ctx, sg); err != nil {
+			log.Error(err, "渲染 SecurityGroup 模板失败")
+			return ctrl.Result{}, nil
+		}
+		// 临时规则到期时重新调谐，从 DCS 中删除
+		requeueAfter, err := r.trackTemporaryRules(ctx, sg)
+		if err != nil {
+			log.Error(err, "记录 SecurityGroup 临时规则失败")
+			return ctrl.Result{}, nil
+		}
+		// 定时规则的窗口开启或关闭时重新调谐
+		windowAfter, err := r.trackScheduledRules(ctx, sg)
+		if err != nil {
+			log.Error(err, "记录 SecurityGroup 定时规则失败")
+			return ctrl.Result{}, nil
+		}
+		result := ctrl.Result{RequeueAfter: earliest(requeueAfter, windowAfter)}
+		// 违反安全策略时不修改 DCS，只观察的安全组不修改 DCS，仍刷新状态
+		if err := r.checkPolicies(ctx, sg); err != nil {
+			log.Error(err, "SecurityGroup 违反安全策略")
+			if !planner.Observed(sg) {
+				return result, nil
+			}
+		}
+		// 分析冗余、被遮蔽和过于宽松的规则，只记录不阻止
+		if err := r.lintRules(ctx, sg); err != nil {
+			log.Error(err, "分析 SecurityGroup 规则失败")
+		}
+		if planner.Observed(sg) {
+			log.Info("管理策略不允许修改 DCS 中的安全组，只刷新状态", "managementPolicy", sg.Spec.ManagementPolicy)
+			if err := r.observeSecurityGroup(ctx, sg); err != nil {
+				log.Error(err, "观察 SecurityGroup 失败")
+			}
+			return result, nil
+		}
+		if r.planMode(sg) {
+			log.Info("plan 模式，只计算对 DCS 的变更，不执行")
+			if err := r.planSecurityGroup(ctx, sg); err != nil {
+				log.Error(err, "计算 SecurityGroup 变更计划失败")
+			}
+			return result, nil
+		}
+		// 需要审批的安全组，只有 spec 的变更被批准后才修改 DCS
+		if requiresApproval(sg) {
+			approved, err := r.checkApproval(ctx, sg)
+			if err != nil {
+				log.Error(err, "检查 SecurityGroup 变更审批失败")
+				return result, nil
+			}
+			if !approved {
+				log.Info("SecurityGroup 变更等待审批")
+				return result, nil
+			}
+		}
 		if _, err := r.applySecurityGroup(ctx, req, sg); err != nil {
 			log.Error(err, "apply SecurityGroup CR 失败")
-			return ctrl.Result{}, nil
+			return result, nil
+		}
+		if err := r.applySecurityGroupRules(ctx, sg); err != nil {
+			log.Error(err, "apply SecurityGroup rules 失败")
+			return result, nil
 		}
+		// 临时规则从首次写入 DCS 时开始计时
+		if err := r.startTemporaryRules(ctx, sg); err != nil {
+			log.Error(err, "记录 SecurityGroup 临时规则失败")
+		}
+		return result, nil
 	} else {
 		log.Info("进入删除 SecurityGroup CR 的逻辑")
 		if util.ContainsString(sg.ObjectMeta.Finalizers, SecurityGroupFinalizer) {
+			// plan 模式下保留 finalizer，直到切换回 apply 模式后再删除 DCS 中的安全组
+			if r.planMode(sg) {
+				log.Info("plan 模式，不删除 DCS 中的安全组")
+				if err := r.planCleanSecurityGroup(ctx, sg); err != nil {
+					log.Error(err, "计算 SecurityGroup 删除计划失败")
+				}
+				return ctrl.Result{}, nil
+			}
+			// 节点仍绑定该安全组时，等待 NodeSecurityGroupBinding 先解绑
+			if bindings, err := r.attachingBindings(ctx, sg); err != nil || len(bindings) > 0 {
+				if err == nil {
+					err = fmt.Errorf("security group is still attached to nodes by NodeSecurityGroupBindings %s", strings.Join(bindings, ", "))
+				}
+				log.Info("等待节点解绑安全组", "reason", err.Error())
+				sg.Status.SetConditions(paasv1.ReconcileError(err))
+				r.Status().Update(ctx, sg)
+				return ctrl.Result{RequeueAfter: bindingRequeueAfter}, nil
+			}
 			// 如果 finalizers 被清空，则该 SecurityGroup CR 就已经不存在了，所以必须在次之前删除 SecurityGroup
 			log.Info("用sdk删除 SecurityGroup")
 			if err := r.cleanSecurityGroup(ctx, req, sg); err != nil {
@@ -110,138 +229,288 @@ func (r *SecurityGroupReconciler) applySecurityGroup(ctx context.Context, req ct
 	// 生成新安全组
 	newSecurityGroup := &SecurityGroup{
 		Name:        sg.Spec.Name,
-		Description: sg.Spec.Description}
+		Description: planner.Description(sg)}
+	if err := dcs.ValidateTags(sg.Spec.Tags); err != nil {
+		sg.Status.SetConditions(paasv1.ReconcileError(err))
+		r.Status().Update(ctx, sg)
+		return nil, err
+	}
+	newTags := dcs.DesiredTags(r.ClusterName, sg)
+
+	// 采纳 DCS 中已有的安全组，不再创建新的安全组
+	if sg.Status.Id == "" && sg.Annotations[dcs.AdoptAnnotation] != "" {
+		if err := r.adoptSecurityGroup(ctx, sg); err != nil {
+			sg.Status.SetConditions(paasv1.ReconcileError(err))
+			r.Status().Update(ctx, sg)
+			return nil, err
+		}
+	}
 
 	// 安全组存在，更新安全组
 	if sg.Status.Id != "" {
 		// fmt.Println("------安全组id存在，更新安全组")
 		condition_update := paasv1.SpecificationChanging()
 		sg.Status.SetConditions(condition_update)
-		getSecuritygroupsResponse, _, err := c.SecuritygroupApi.V2SecurityGroupsGet(nil, &dcsapi.SecuritygroupApiV2SecurityGroupsGetOpts{
-			XAccountID: optional.NewString(sg.Spec.AccountId),
-			XUserID:    optional.NewString(sg.Spec.UserId),
-			SearchById: optional.NewString(sg.Status.Id)})
+		current, err := dcsClient.GetSecurityGroup(ctx, dcs.AccountOf(sg), sg.Status.Id)
+		if err == nil && current == nil {
+			err = fmt.Errorf("security group %s does not exist in DCS", sg.Status.Id)
+		}
 		// 获取安全组失败
-		if getSecuritygroupsResponse.Code != 200 {
-			// fmt.Println("------安全组id存在,获取安全组失败")
-			err := fmt.Errorf("failed to get Securitygroup when updating: %v, %v", getSecuritygroupsResponse.Message, err)
+		if err != nil {
+			err := fmt.Errorf("failed to get Securitygroup when updating: %v", err)
 			reconcile_update := paasv1.ReconcileError(err)
 			sg.Status.SetConditions(reconcile_update)
-			r.Update(ctx, sg)
+			r.Status().Update(ctx, sg)
 			return nil, err
 		}
-		oldSecurityGroup.Name = getSecuritygroupsResponse.Result.List[0].Name
-		oldSecurityGroup.Description = getSecuritygroupsResponse.Result.List[0].Description
+		oldSecurityGroup.Name = current.Name
+		oldSecurityGroup.Description = current.Description
+		owned := current.Owned
+		oldTags := current.Tags
+
+		// 管理策略不允许更新时，保留 DCS 中的名称和描述
+		if !planner.MayUpdate(sg) {
+			return oldSecurityGroup, nil
+		}
 
 		// 对比安全组
-		if reflect.DeepEqual(oldSecurityGroup, newSecurityGroup) {
+		// 没有所有者标记的安全组（如采纳的安全组）更新后加上标记
+		if reflect.DeepEqual(oldSecurityGroup, newSecurityGroup) && owned && reflect.DeepEqual(oldTags, newTags) {
 			// fmt.Println("------安全组期望状态与实际状态一致，无需更新")
 			return oldSecurityGroup, nil
 		}
 
 		// 更新安全组
 		// 更新状态为修改中
-		r.Update(ctx, sg)
-		updateSecuritygroupsResponse, _, e := c.SecuritygroupApi.V2SecurityGroupsIdPut(nil, sg.Status.Id, &dcsapi.SecuritygroupApiV2SecurityGroupsIdPutOpts{
-			XAccountID: optional.NewString(sg.Spec.AccountId),
-			XUserID:    optional.NewString(sg.Spec.UserId),
-			Root:       &securitygroup.UpdateSecuritygroupRequest{Name: newSecurityGroup.Name, Description: newSecurityGroup.Description}})
-		if updateSecuritygroupsResponse.Code != 200 {
+		r.Status().Update(ctx, sg)
+		if err := dcsClient.UpdateSecurityGroup(ctx, dcs.AccountOf(sg), sg.Status.Id, newSecurityGroup.Name, newSecurityGroup.Description, newTags); err != nil {
 			// 更新安全组失败，更新状态
-			// fmt.Printf("------更新安全组失败: %+v\n", updateSecuritygroupsResponse)
-			err := fmt.Errorf("failed to update Securitygroup: %+v, %+v", updateSecuritygroupsResponse.Message, e)
 			reconcile_update := paasv1.ReconcileError(err)
 			sg.Status.SetConditions(reconcile_update)
-			r.Update(ctx, sg)
+			r.Status().Update(ctx, sg)
 			return oldSecurityGroup, err
 		}
 		// 更新安全组成功，更新状态为avialable
-		// fmt.Printf("------更新安全组成功: %+v\n", updateSecuritygroupsResponse)
 		condition_update = paasv1.Available()
-		condition_update = condition_update.WithMessage(updateSecuritygroupsResponse.Message)
 		reconcile_update := paasv1.ReconcileSuccess()
 		sg.Status.SetConditions(condition_update, reconcile_update)
-		r.Update(ctx, sg)
+		r.Status().Update(ctx, sg)
 		return newSecurityGroup, nil
 	}
 	// 安全组不存在，创建安全组
 	// fmt.Println("------安全组id不存在，创建安全组")
+	if !planner.MayCreate(sg) {
+		err := fmt.Errorf("%s SecurityGroup has no security group in DCS", sg.Spec.ManagementPolicy)
+		sg.Status.SetConditions(paasv1.ReconcileError(err))
+		r.Status().Update(ctx, sg)
+		return nil, err
+	}
+	// 之前创建成功但未记录 id 的安全组带有本 SecurityGroup 的 UID 标签，采纳而不重复创建
+	created, err := r.findCreatedSecurityGroup(ctx, sg)
+	if err != nil {
+		sg.Status.SetConditions(paasv1.ReconcileError(err))
+		r.Status().Update(ctx, sg)
+		return nil, err
+	}
+	if created != nil {
+		r.Log.Info("采纳之前创建的安全组", "securitygroup", sg.Namespace+"/"+sg.Name, "id", created.Id)
+		sg.Status.Id = created.Id
+		if err := r.Status().Update(ctx, sg); err != nil {
+			return nil, err
+		}
+		return r.applySecurityGroup(ctx, req, sg)
+	}
 	// 更新状态为创建中
 	condition_create := paasv1.Creating()
 	sg.Status.SetConditions(condition_create)
-	r.Update(ctx, sg)
-	createSecuritygroupResponse, _, e := c.SecuritygroupApi.V2SecurityGroupsPost(nil, &dcsapi.SecuritygroupApiV2SecurityGroupsPostOpts{
-		XAccountID: optional.NewString(sg.Spec.AccountId),
-		XUserID:    optional.NewString(sg.Spec.UserId),
-		Root:       &securitygroup.CreateSecuritygroupRequest{Name: newSecurityGroup.Name, Description: newSecurityGroup.Description}})
-	if createSecuritygroupResponse.Code != 200 {
+	r.Status().Update(ctx, sg)
+	id, err := dcsClient.CreateSecurityGroup(ctx, dcs.AccountOf(sg), newSecurityGroup.Name, newSecurityGroup.Description, newTags)
+	if err != nil {
 		// 创建安全组失败，更新状态
-		// fmt.Printf("------创建安全组失败: %+v\n", createSecuritygroupResponse)
-		err := fmt.Errorf("failed to create Securitygroup: %+v, %+v", createSecuritygroupResponse.Message, e)
 		reconcile_create := paasv1.ReconcileError(err)
 		sg.Status.SetConditions(reconcile_create)
-		r.Update(ctx, sg)
+		r.Status().Update(ctx, sg)
 		return nil, err
 	}
 	//创建成功，更新状态为avialable
-	// fmt.Printf("------创建安全组成功: %+v\n", createSecuritygroupResponse.Result)
 	condition_create = paasv1.Available()
-	condition_create = condition_create.WithMessage(createSecuritygroupResponse.Message)
 	reconcile_create := paasv1.ReconcileSuccess()
 	sg.Status.SetConditions(condition_create, reconcile_create)
-	r.Update(ctx, sg)
-	sg.Status.Id = strconv.FormatInt(createSecuritygroupResponse.Result.Id, 10)
-	r.Update(ctx, sg)
+	sg.Status.Id = id
+	r.Status().Update(ctx, sg)
 	return newSecurityGroup, nil
 }
 
+// adoptSecurityGroup records the security group named by the adopt annotation as the
+// security group of the SecurityGroup, after checking that it exists in DCS and that no
+// other SecurityGroup owns it. A security group the SecurityGroup would update must not be
+// owned by the controller of another cluster either.
+func (r *SecurityGroupReconciler) adoptSecurityGroup(ctx context.Context, sg *paasv1.SecurityGroup) error {
+	id := sg.Annotations[dcs.AdoptAnnotation]
+	current, err := dcsClient.GetSecurityGroup(ctx, dcs.AccountOf(sg), id)
+	if err != nil {
+		return err
+	}
+	if current == nil {
+		return fmt.Errorf("security group %s to adopt does not exist in DCS", id)
+	}
+	if cluster, ok := current.Tags[dcs.TagCluster]; ok && cluster != r.ClusterName && planner.MayUpdate(sg) {
+		return fmt.Errorf("security group %s to adopt is owned by cluster %q", id, cluster)
+	}
+	if namespace, name, uid, ok := current.Owner(); ok && uid != string(sg.UID) && current.OwnedBy(r.ClusterName) {
+		owner := &paasv1.SecurityGroup{}
+		err := r.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, owner)
+		if err == nil && string(owner.UID) == uid {
+			return fmt.Errorf("security group %s to adopt is owned by SecurityGroup %s/%s", id, namespace, name)
+		}
+		if client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	}
+	r.Log.Info("采纳 DCS 中已有的安全组", "securitygroup", sg.Namespace+"/"+sg.Name, "id", id)
+	sg.Status.Id = id
+	return r.Status().Update(ctx, sg)
+}
+
+// findCreatedSecurityGroup returns the security group in DCS tagged with the UID of the
+// SecurityGroup, or nil if there is none.
+func (r *SecurityGroupReconciler) findCreatedSecurityGroup(ctx context.Context, sg *paasv1.SecurityGroup) (*dcs.SecurityGroup, error) {
+	groups, err := dcsClient.ListSecurityGroups(ctx, dcs.AccountOf(sg))
+	if err != nil {
+		return nil, err
+	}
+	for i := range groups {
+		if _, _, uid, ok := groups[i].Owner(); ok && uid == string(sg.UID) && groups[i].OwnedBy(r.ClusterName) {
+			return &groups[i], nil
+		}
+	}
+	return nil, nil
+}
+
 func (r *SecurityGroupReconciler) cleanSecurityGroup(ctx context.Context, req ctrl.Request, sg *paasv1.SecurityGroup) error {
 	// 安全组不存在，直接返回
 	if sg.Status.Id == "" {
 		// fmt.Println("------安全组id不存在，直接返回")
 		return nil
 	}
+	// 管理策略不允许删除时保留安全组，去掉所有者标记和控制器的标签，避免被垃圾回收删除
+	if !planner.MayUpdate(sg) {
+		return r.releaseSecurityGroup(ctx, sg)
+	}
 	// 更新状态为删除中
 	condition_delete := paasv1.Deleting()
 	sg.Status.SetConditions(condition_delete)
-	r.Update(ctx, sg)
-	getSecuritygroupsResponse, _, e := c.SecuritygroupApi.V2SecurityGroupsGet(nil, &dcsapi.SecuritygroupApiV2SecurityGroupsGetOpts{
-		XAccountID: optional.NewString(sg.Spec.AccountId),
-		XUserID:    optional.NewString(sg.Spec.UserId),
-		SearchById: optional.NewString(sg.Status.Id)})
+	r.Status().Update(ctx, sg)
+	current, err := dcsClient.GetSecurityGroup(ctx, dcs.AccountOf(sg), sg.Status.Id)
 	// 获取安全组失败
-	if getSecuritygroupsResponse.Code != 200 {
-		// fmt.Println("------删除安全组时获取安全组失败，返回err")
+	if err != nil {
 		// 更新删除时状态的message
-		err := fmt.Errorf("failed to get Securitygroup when deleting:%+v, %+v", getSecuritygroupsResponse.Message, e)
+		err := fmt.Errorf("failed to get Securitygroup when deleting: %v", err)
 		reconcile_delete := paasv1.ReconcileError(err)
 		sg.Status.SetConditions(reconcile_delete)
-		r.Update(ctx, sg)
+		r.Status().Update(ctx, sg)
 		return err
 	}
 	// 安全组不存在，直接返回
-	if len(getSecuritygroupsResponse.Result.List) == 0 {
-		// fmt.Println("------删除安全组时获取安全组不存在，直接返回")
+	if current == nil {
 		return nil
 	}
 	// 删除安全组
-	deleteSecuritygroupResponse, _, e := c.SecuritygroupApi.V2SecurityGroupsIdDelete(nil, sg.Status.Id, &dcsapi.SecuritygroupApiV2SecurityGroupsIdDeleteOpts{
-		XAccountID: optional.NewString(sg.Spec.AccountId),
-		XUserID:    optional.NewString(sg.Spec.UserId)})
-	if deleteSecuritygroupResponse.Code != 200 {
-		// fmt.Printf("------删除安全组失败: %+v\n", deleteSecuritygroupResponse)
-		err := fmt.Errorf("failed to delete Securitygroup: %+v, %+v", deleteSecuritygroupResponse.Message, e)
+	if err := dcsClient.DeleteSecurityGroup(ctx, dcs.AccountOf(sg), sg.Status.Id); err != nil {
 		// 更新状态
 		reconcile_delete := paasv1.ReconcileError(err)
 		sg.Status.SetConditions(reconcile_delete)
-		r.Update(ctx, sg)
+		r.Status().Update(ctx, sg)
 		return err
 	}
 	return nil
 }
 
+// releaseSecurityGroup leaves the security group of a SecurityGroup that may not delete it
+// to the users of DCS, if the controller owns it.
+func (r *SecurityGroupReconciler) releaseSecurityGroup(ctx context.Context, sg *paasv1.SecurityGroup) error {
+	account := dcs.AccountOf(sg)
+	current, err := dcsClient.GetSecurityGroup(ctx, account, sg.Status.Id)
+	if err != nil {
+		return err
+	}
+	if current == nil || !current.OwnedBy(r.ClusterName) {
+		return nil
+	}
+	r.Log.Info("保留 DCS 中的安全组，去掉所有者标记", "securitygroup", sg.Namespace+"/"+sg.Name, "id", sg.Status.Id)
+	return dcsClient.ReleaseSecurityGroup(ctx, account, sg.Status.Id)
+}
+
+// attachingBindings returns the names of the NodeSecurityGroupBindings of the namespace
+// that have the security group attached to nodes.
+func (r *SecurityGroupReconciler) attachingBindings(ctx context.Context, sg *paasv1.SecurityGroup) ([]string, error) {
+	bindings := &paasv1.NodeSecurityGroupBindingList{}
+	if err := r.List(ctx, bindings, client.InNamespace(sg.Namespace)); err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, b := range bindings.Items {
+		for _, node := range b.Status.Nodes {
+			if containsSecurityGroup(node.SecurityGroups, sg.Name) {
+				names = append(names, b.Name)
+				break
+			}
+		}
+	}
+	return names, nil
+}
+
 func (r *SecurityGroupReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
+	if err := mgr.GetFieldIndexer().IndexField(&paasv1.SecurityGroup{}, templateIndex, indexTemplate); err != nil {
+		return err
+	}
+	if err := mgr.GetFieldIndexer().IndexField(&paasv1.SecurityGroup{}, addressGroupIndex, indexAddressGroups); err != nil {
+		return err
+	}
+	configMaps, err := configMapInformer(mgr)
+	if err != nil {
+		return err
+	}
+	b := ctrl.NewControllerManagedBy(mgr).
 		For(&paasv1.SecurityGroup{}).
-		Complete(r)
+		Owns(&paasv1.SecurityGroupChangeRequest{}).
+		// 模板变化时，重新渲染引用它的安全组
+		Watches(&source.Kind{Type: &paasv1.SecurityGroupTemplate{}}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: handler.ToRequestsFunc(func(a handler.MapObject) []reconcile.Request {
+				return r.securityGroupsForTemplate(paasv1.KindSecurityGroupTemplate, a.Meta.GetNamespace(), a.Meta.GetName())
+			}),
+		}).
+		Watches(&source.Kind{Type: &paasv1.ClusterSecurityGroupTemplate{}}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: handler.ToRequestsFunc(func(a handler.MapObject) []reconcile.Request {
+				return r.securityGroupsForTemplate(paasv1.KindClusterSecurityGroupTemplate, "", a.Meta.GetName())
+			}),
+		}).
+		// 服务目录变化时，重新调谐所有安全组
+		Watches(&source.Kind{Type: &paasv1.ServiceCatalog{}}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: handler.ToRequestsFunc(func(a handler.MapObject) []reconcile.Request {
+				return r.allSecurityGroups()
+			}),
+		}).
+		// 地址组或其 ConfigMap 变化时，重新调谐引用它的安全组
+		Watches(&source.Kind{Type: &paasv1.AddressGroup{}}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: handler.ToRequestsFunc(func(a handler.MapObject) []reconcile.Request {
+				return r.securityGroupsForAddressGroup(a.Meta.GetNamespace(), a.Meta.GetName())
+			}),
+		}).
+		Watches(&source.Informer{Informer: configMaps}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: handler.ToRequestsFunc(func(a handler.MapObject) []reconcile.Request {
+				return r.securityGroupsForConfigMap(a.Meta.GetNamespace(), a.Meta.GetName())
+			}),
+		}).
+		// 安全策略变化时，重新检查所有安全组
+		Watches(&source.Kind{Type: &paasv1.SecurityGroupPolicy{}}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: handler.ToRequestsFunc(func(a handler.MapObject) []reconcile.Request {
+				return r.allSecurityGroups()
+			}),
+		})
+	if r.ServiceRules {
+		// Service 变化或删除时，重新调谐其指定的安全组
+		b = b.Watches(&source.Kind{Type: &corev1.Service{}}, &handler.EnqueueRequestsFromMapFunc{ToRequests: securityGroupForService})
+	}
+	return b.Complete(r)
 }
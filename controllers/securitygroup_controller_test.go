@@ -0,0 +1,98 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	paasv1 "security-group/api/v1"
+	"security-group/dcs"
+	dcsfake "security-group/dcs/fake"
+)
+
+func TestApplySecurityGroup(t *testing.T) {
+	newSG := func(id string) *paasv1.SecurityGroup {
+		return &paasv1.SecurityGroup{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "web", UID: "uid-web"},
+			Spec:       paasv1.SecurityGroupSpec{Name: "web", Description: "web servers", AccountId: "acc", UserId: "user"},
+			Status:     paasv1.SecurityGroupStatus{Id: id},
+		}
+	}
+	synced := dcs.SecurityGroup{Id: "1", Name: "web", Description: "web servers", Owned: true, Tags: dcs.DesiredTags("prod", newSG("1"))}
+	renamed := synced
+	renamed.Name = "old"
+	tests := []struct {
+		name    string
+		id      string
+		groups  []dcs.SecurityGroup
+		calls   []string
+		wantId  string
+		wantErr bool
+	}{
+		{name: "created", calls: []string{"create web"}, wantId: "new-1"},
+		{name: "updated", id: "1", groups: []dcs.SecurityGroup{renamed}, calls: []string{"update 1"}, wantId: "1"},
+		{name: "unchanged", id: "1", groups: []dcs.SecurityGroup{synced}, wantId: "1"},
+		{name: "gone from DCS", id: "2", groups: []dcs.SecurityGroup{synced}, wantId: "2", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := &dcsfake.Client{Groups: tt.groups}
+			defer func(c dcs.Client) { dcsClient = c }(dcsClient)
+			dcsClient = api
+			sg := newSG(tt.id)
+			r := &SecurityGroupReconciler{
+				Client:      fake.NewFakeClientWithScheme(newTestScheme(t), sg.DeepCopy()),
+				Log:         logf.Log,
+				ClusterName: "prod",
+			}
+			_, err := r.applySecurityGroup(context.Background(), ctrl.Request{}, sg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("applySecurityGroup() error = %v, want error %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(api.Calls, tt.calls) {
+				t.Errorf("calls = %v, want %v", api.Calls, tt.calls)
+			}
+			if sg.Status.Id != tt.wantId {
+				t.Errorf("status id = %q, want %q", sg.Status.Id, tt.wantId)
+			}
+		})
+	}
+}
+
+func TestCleanSecurityGroup(t *testing.T) {
+	api := &dcsfake.Client{Groups: []dcs.SecurityGroup{{Id: "1", Owned: true}}}
+	defer func(c dcs.Client) { dcsClient = c }(dcsClient)
+	dcsClient = api
+	for _, id := range []string{"1", "2", ""} {
+		sg := &paasv1.SecurityGroup{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "web"}, Status: paasv1.SecurityGroupStatus{Id: id}}
+		r := &SecurityGroupReconciler{Client: fake.NewFakeClientWithScheme(newTestScheme(t), sg.DeepCopy()), Log: logf.Log}
+		if err := r.cleanSecurityGroup(context.Background(), ctrl.Request{}, sg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 只删除 DCS 中存在的安全组
+	if want := []string{"delete 1"}; !reflect.DeepEqual(api.Calls, want) {
+		t.Errorf("calls = %v, want %v", api.Calls, want)
+	}
+}
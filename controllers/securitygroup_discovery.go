@@ -0,0 +1,210 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	paasv1 "security-group/api/v1"
+	"security-group/dcs"
+	"security-group/planner"
+)
+
+// DiscoveredLabel marks the ObserveOnly SecurityGroups the discovery created for security
+// groups in DCS that no SecurityGroup manages.
+const DiscoveredLabel string = "paas.unicom.cn/discovered"
+
+// DiscoveryAccount is a DCS account whose security groups are discovered into a namespace.
+type DiscoveryAccount struct {
+	dcs.Account
+	Namespace string
+}
+
+// ParseDiscoveryAccounts parses a comma-separated list of accounts in the form
+// accountId:userId:namespace.
+func ParseDiscoveryAccounts(s string) ([]DiscoveryAccount, error) {
+	var accounts []DiscoveryAccount
+	for _, a := range strings.Split(s, ",") {
+		if a = strings.TrimSpace(a); a == "" {
+			continue
+		}
+		parts := strings.Split(a, ":")
+		if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+			return nil, fmt.Errorf("invalid discovery account %q, must be accountId:userId:namespace", a)
+		}
+		accounts = append(accounts, DiscoveryAccount{Account: dcs.Account{AccountId: parts[0], UserId: parts[1]}, Namespace: parts[2]})
+	}
+	return accounts, nil
+}
+
+// SecurityGroupDiscovery periodically lists the security groups of the accounts in DCS and
+// creates an ObserveOnly SecurityGroup for each security group that no SecurityGroup
+// manages and that the controller did not create. The discovered SecurityGroups follow the
+// security groups in DCS: their spec is updated when a security group changes, and they
+// are deleted when it is deleted. Changing the management policy of a discovered
+// SecurityGroup makes the controller manage the security group, and the discovery leaves it
+// alone from then on.
+//
+// The rules of a security group are read when it is discovered. Afterwards they are only
+// read again once the controller has found the SecurityGroup drifted from them, or if its
+// rules are not managed, which keeps the calls per interval to one list per account.
+type SecurityGroupDiscovery struct {
+	client.Client
+	Log      logr.Logger
+	Accounts []DiscoveryAccount
+	Interval time.Duration
+	// ClusterName is the value of the cluster tag of the security groups the controller owns.
+	ClusterName string
+	// DCS is the client of the DCS API, the client of the controllers if nil.
+	DCS dcs.Client
+}
+
+// Start discovers security groups every interval until stop is closed.
+func (d *SecurityGroupDiscovery) Start(stop <-chan struct{}) error {
+	ticker := time.NewTicker(d.Interval)
+	defer ticker.Stop()
+	for {
+		for _, account := range d.Accounts {
+			if err := d.discover(context.Background(), account); err != nil {
+				d.Log.Error(err, "发现 DCS 安全组失败", "account", account.AccountId)
+			}
+		}
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// SetupWithManager runs the discovery with the manager, on the leader only.
+func (d *SecurityGroupDiscovery) SetupWithManager(mgr ctrl.Manager) error {
+	if d.DCS == nil {
+		d.DCS = dcsClient
+	}
+	return mgr.Add(d)
+}
+
+// discover creates, updates and deletes the discovered SecurityGroups of the account.
+func (d *SecurityGroupDiscovery) discover(ctx context.Context, account DiscoveryAccount) error {
+	log := d.Log.WithValues("account", account.AccountId, "namespace", account.Namespace)
+	groups, err := d.DCS.ListSecurityGroups(ctx, account.Account)
+	if err != nil {
+		return err
+	}
+	sgs := &paasv1.SecurityGroupList{}
+	if err := d.List(ctx, sgs); err != nil {
+		return err
+	}
+	managed := map[string]bool{}
+	discovered := map[string]*paasv1.SecurityGroup{}
+	for i := range sgs.Items {
+		sg := &sgs.Items[i]
+		id := sg.Status.Id
+		if id == "" {
+			id = sg.Annotations[dcs.AdoptAnnotation]
+		}
+		if id == "" {
+			continue
+		}
+		if sg.Labels[DiscoveredLabel] == "true" && sg.Spec.ManagementPolicy == paasv1.ManagementPolicyObserveOnly && sg.Namespace == account.Namespace && sg.Spec.AccountId == account.AccountId {
+			discovered[id] = sg
+		} else {
+			managed[id] = true
+		}
+	}
+	exists := map[string]bool{}
+	var undiscovered []dcs.SecurityGroup
+	for _, g := range groups {
+		exists[g.Id] = true
+		// 控制器创建的安全组没有 SecurityGroup 时由垃圾回收处理
+		if managed[g.Id] || g.OwnedBy(d.ClusterName) {
+			continue
+		}
+		if sg, ok := discovered[g.Id]; ok {
+			if err := d.refresh(ctx, account, sg, g); err != nil {
+				return err
+			}
+			continue
+		}
+		undiscovered = append(undiscovered, g)
+	}
+	exported, err := dcs.ExportGroups(ctx, d.DCS, account.Account, account.Namespace, undiscovered)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range exported {
+		id := e.SecurityGroup.Annotations[dcs.AdoptAnnotation]
+		sg := &e.SecurityGroup
+		sg.Labels = map[string]string{DiscoveredLabel: "true"}
+		sg.Spec.ManagementPolicy = paasv1.ManagementPolicyObserveOnly
+		if err := d.Get(ctx, client.ObjectKey{Namespace: sg.Namespace, Name: sg.Name}, &paasv1.SecurityGroup{}); err == nil {
+			sg.Name = sg.Name + "-" + id
+		} else if !apierrors.IsNotFound(err) {
+			return err
+		}
+		if err := d.Create(ctx, sg); err != nil {
+			return err
+		}
+		log.Info("发现未管理的 DCS 安全组，创建只观察的 SecurityGroup", "id", id, "securitygroup", sg.Name)
+	}
+
+	// DCS 中已删除的安全组，删除对应的 SecurityGroup，只观察的安全组删除时不修改 DCS
+	for id, sg := range discovered {
+		if exists[id] {
+			continue
+		}
+		if err := d.Delete(ctx, sg); err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+		log.Info("DCS 中的安全组已删除，删除只观察的 SecurityGroup", "id", id, "securitygroup", sg.Name)
+	}
+	return nil
+}
+
+// refresh updates the spec of a discovered SecurityGroup to the security group in DCS. The
+// rules are only read again if the controller found them drifted or does not manage them.
+func (d *SecurityGroupDiscovery) refresh(ctx context.Context, account DiscoveryAccount, sg *paasv1.SecurityGroup, g dcs.SecurityGroup) error {
+	remote := &paasv1.SecurityGroup{Spec: *sg.Spec.DeepCopy()}
+	remote.Spec.Name = g.Name
+	remote.Spec.Description = g.Description
+	remote.Spec.Tags = dcs.UserTags(g.Tags)
+	if sg.Status.GetCondition(paasv1.TypeSynced).Reason == paasv1.ReasonDrifted || !planner.ManagesRules(sg) {
+		exported, err := dcs.ExportGroups(ctx, d.DCS, account.Account, account.Namespace, []dcs.SecurityGroup{g})
+		if err != nil {
+			return err
+		}
+		remote.Spec.Rules = exported[0].SecurityGroup.Spec.Rules
+		remote.Spec.ManageRules = exported[0].SecurityGroup.Spec.ManageRules
+	}
+	if reflect.DeepEqual(sg.Spec, remote.Spec) {
+		return nil
+	}
+	sg.Spec = remote.Spec
+	d.Log.Info("DCS 中的安全组已变化，更新只观察的 SecurityGroup", "securitygroup", sg.Namespace+"/"+sg.Name)
+	return d.Update(ctx, sg)
+}
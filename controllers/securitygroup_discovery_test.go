@@ -0,0 +1,178 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	paasv1 "security-group/api/v1"
+	"security-group/dcs"
+	dcsfake "security-group/dcs/fake"
+	"security-group/rules"
+)
+
+var discoveryAccount = DiscoveryAccount{Account: dcs.Account{AccountId: "acc", UserId: "user"}, Namespace: "ns"}
+
+func ssh(t *testing.T) rules.Rule {
+	r, err := rules.Parse(paasv1.SecurityGroupRule{Direction: "ingress", Protocol: "tcp", Ports: "22", CIDR: "10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func newTestDiscovery(t *testing.T, api *dcsfake.Client, objs ...runtime.Object) *SecurityGroupDiscovery {
+	return &SecurityGroupDiscovery{
+		Client:      fake.NewFakeClientWithScheme(newTestScheme(t), objs...),
+		Log:         logf.Log,
+		Accounts:    []DiscoveryAccount{discoveryAccount},
+		ClusterName: "prod",
+		DCS:         api,
+	}
+}
+
+// discoveredSecurityGroup returns a SecurityGroup the discovery created for the security group.
+func discoveredSecurityGroup(name, id string, spec paasv1.SecurityGroupSpec) *paasv1.SecurityGroup {
+	spec.AccountId, spec.UserId = "acc", "user"
+	spec.ManagementPolicy = paasv1.ManagementPolicyObserveOnly
+	return &paasv1.SecurityGroup{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: name, Labels: map[string]string{DiscoveredLabel: "true"}},
+		Spec:       spec,
+		Status:     paasv1.SecurityGroupStatus{Id: id},
+	}
+}
+
+func getSecurityGroup(t *testing.T, c client.Client, name string) *paasv1.SecurityGroup {
+	sg := &paasv1.SecurityGroup{}
+	if err := c.Get(context.Background(), client.ObjectKey{Namespace: "ns", Name: name}, sg); err != nil {
+		t.Fatalf("get %s: %v", name, err)
+	}
+	return sg
+}
+
+func TestDiscoverCreate(t *testing.T) {
+	rule := ssh(t)
+	api := &dcsfake.Client{
+		Groups: []dcs.SecurityGroup{
+			{Id: "1", Name: "web", Tags: map[string]string{"team": "a"}},
+			{Id: "2", Name: "web"},
+			{Id: "3", Name: "owned", Owned: true, Tags: map[string]string{dcs.TagCluster: "prod"}},
+			{Id: "4", Name: "managed"},
+		},
+		Rules: map[string][]rules.RemoteRule{"1": {{Rule: rule, Id: "11"}}},
+	}
+	d := newTestDiscovery(t, api,
+		&paasv1.SecurityGroup{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "db"}, Status: paasv1.SecurityGroupStatus{Id: "4"}},
+		// 与发现的安全组同名的 SecurityGroup
+		&paasv1.SecurityGroup{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "web-2"}, Status: paasv1.SecurityGroupStatus{Id: "9"}},
+	)
+
+	if err := d.discover(context.Background(), discoveryAccount); err != nil {
+		t.Fatal(err)
+	}
+	sg := getSecurityGroup(t, d, "web")
+	if sg.Spec.ManagementPolicy != paasv1.ManagementPolicyObserveOnly || sg.Labels[DiscoveredLabel] != "true" ||
+		sg.Annotations[dcs.AdoptAnnotation] != "1" || sg.Spec.Tags["team"] != "a" ||
+		len(sg.Spec.Rules) != 1 || sg.Spec.Rules[0] != rule.Spec() {
+		t.Errorf("discovered web = %+v", sg)
+	}
+	// 导出的名称 web-2 已被占用，加上安全组 id
+	if sg := getSecurityGroup(t, d, "web-2-2"); sg.Annotations[dcs.AdoptAnnotation] != "2" {
+		t.Errorf("discovered web-2-2 adopts %q, want 2", sg.Annotations[dcs.AdoptAnnotation])
+	}
+	list := &paasv1.SecurityGroupList{}
+	if err := d.List(context.Background(), list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Items) != 4 {
+		t.Errorf("got %d SecurityGroups, want the owned and managed groups not discovered", len(list.Items))
+	}
+	if api.ListRulesCalls != 2 {
+		t.Errorf("ListRules called %d times, want once per discovered group", api.ListRulesCalls)
+	}
+}
+
+func TestDiscoverRefresh(t *testing.T) {
+	rule := ssh(t)
+	api := &dcsfake.Client{
+		Groups: []dcs.SecurityGroup{{Id: "1", Name: "web-prod", Description: "web", Tags: map[string]string{"team": "b"}}},
+		Rules:  map[string][]rules.RemoteRule{"1": {{Rule: rule, Id: "11"}}},
+	}
+	d := newTestDiscovery(t, api, discoveredSecurityGroup("web", "1", paasv1.SecurityGroupSpec{
+		Name:  "web",
+		Tags:  map[string]string{"team": "a"},
+		Rules: []paasv1.SecurityGroupRule{rule.Spec()},
+	}))
+
+	// 名称、描述和标签随安全组列表更新，不读取规则
+	if err := d.discover(context.Background(), discoveryAccount); err != nil {
+		t.Fatal(err)
+	}
+	sg := getSecurityGroup(t, d, "web")
+	if sg.Spec.Name != "web-prod" || sg.Spec.Description != "web" || sg.Spec.Tags["team"] != "b" {
+		t.Errorf("refreshed spec = %+v", sg.Spec)
+	}
+	if api.ListRulesCalls != 0 {
+		t.Errorf("ListRules called %d times, want none without drift", api.ListRulesCalls)
+	}
+
+	// 控制器发现规则漂移后重新读取规则
+	api.Rules["1"] = nil
+	sg.Status.SetConditions(paasv1.Drifted("rules changed"))
+	if err := d.Update(context.Background(), sg); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.discover(context.Background(), discoveryAccount); err != nil {
+		t.Fatal(err)
+	}
+	if sg := getSecurityGroup(t, d, "web"); len(sg.Spec.Rules) != 0 {
+		t.Errorf("refreshed rules = %v, want none", sg.Spec.Rules)
+	}
+	if api.ListRulesCalls != 1 {
+		t.Errorf("ListRules called %d times, want once for the drifted group", api.ListRulesCalls)
+	}
+}
+
+func TestDiscoverDelete(t *testing.T) {
+	api := &dcsfake.Client{Groups: []dcs.SecurityGroup{
+		{Id: "1", Name: "web"},
+		{Id: "3", Name: "db", Owned: true, Tags: map[string]string{dcs.TagCluster: "prod"}},
+	}}
+	d := newTestDiscovery(t, api,
+		discoveredSecurityGroup("web", "1", paasv1.SecurityGroupSpec{Name: "web"}),
+		discoveredSecurityGroup("gone", "2", paasv1.SecurityGroupSpec{Name: "gone"}),
+		discoveredSecurityGroup("db", "3", paasv1.SecurityGroupSpec{Name: "db"}),
+	)
+
+	if err := d.discover(context.Background(), discoveryAccount); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Get(context.Background(), client.ObjectKey{Namespace: "ns", Name: "gone"}, &paasv1.SecurityGroup{}); !apierrors.IsNotFound(err) {
+		t.Errorf("get gone = %v, want not found", err)
+	}
+	// 仍在 DCS 中的安全组即使不再是未管理的，也保留其 SecurityGroup
+	getSecurityGroup(t, d, "web")
+	getSecurityGroup(t, d, "db")
+}
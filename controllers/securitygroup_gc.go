@@ -0,0 +1,264 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	paasv1 "security-group/api/v1"
+	"security-group/dcs"
+)
+
+// +kubebuilder:rbac:groups="",resources=configmaps,verbs=create;update
+
+// Garbage collection modes.
+const (
+	// GCModeReport only reports the orphaned security groups.
+	GCModeReport string = "report"
+	// GCModeDelete deletes the orphaned security groups after the grace period.
+	GCModeDelete string = "delete"
+)
+
+// ParseAccounts parses a comma-separated list of accounts in the form accountId:userId.
+func ParseAccounts(s string) ([]dcs.Account, error) {
+	var accounts []dcs.Account
+	for _, a := range strings.Split(s, ",") {
+		if a = strings.TrimSpace(a); a == "" {
+			continue
+		}
+		parts := strings.Split(a, ":")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid account %q, must be accountId:userId", a)
+		}
+		accounts = append(accounts, dcs.Account{AccountId: parts[0], UserId: parts[1]})
+	}
+	return accounts, nil
+}
+
+// SecurityGroupCollector periodically finds the security groups in DCS that the controller
+// created, as told by their cluster tag or owner marker, but that no SecurityGroup has as
+// its status id or adopt annotation, e.g. because a SecurityGroup created a security group
+// twice. Security groups tagged with the UID of a SecurityGroup without a status id are
+// left for the SecurityGroup to adopt. Such orphans are reported, and in delete mode
+// deleted once they have been orphaned for the grace period, which protects security groups
+// whose SecurityGroup has not recorded their id yet. The report of the last run is written
+// to a ConfigMap, together with when each orphan was first found, so that the grace period
+// survives restarts of the controller.
+//
+// The accounts of all SecurityGroups are searched, and the additional accounts. Deleting a
+// SecurityGroup whose management policy does not allow deleting its security group releases
+// the security group, which the collector then leaves alone.
+type SecurityGroupCollector struct {
+	client.Client
+	Log         logr.Logger
+	Mode        string
+	Accounts    []dcs.Account
+	Interval    time.Duration
+	GracePeriod time.Duration
+	// ClusterName is the value of the cluster tag of the security groups the controller owns.
+	ClusterName string
+	// Report is the ConfigMap the report is written to.
+	Report client.ObjectKey
+	// DCS is the client of the DCS API, the client of the controllers if nil.
+	DCS dcs.Client
+
+	// orphanedSince is when each orphan was first found, read from the report if nil.
+	orphanedSince map[string]time.Time
+}
+
+// reportOrphanedSince is the key of the report ConfigMap that holds when each orphan was
+// first found.
+const reportOrphanedSince = "orphanedSince"
+
+// orphan is a security group found by the collector.
+type orphan struct {
+	account dcs.Account
+	group   dcs.SecurityGroup
+	since   time.Time
+	state   string
+}
+
+// Start collects garbage every interval until stop is closed.
+func (g *SecurityGroupCollector) Start(stop <-chan struct{}) error {
+	ticker := time.NewTicker(g.Interval)
+	defer ticker.Stop()
+	for {
+		if err := g.collect(context.Background()); err != nil {
+			g.Log.Error(err, "回收孤立的 DCS 安全组失败")
+		}
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// SetupWithManager runs the collector with the manager, on the leader only.
+func (g *SecurityGroupCollector) SetupWithManager(mgr ctrl.Manager) error {
+	if g.Mode != GCModeReport && g.Mode != GCModeDelete {
+		return fmt.Errorf("invalid garbage collection mode %q", g.Mode)
+	}
+	// 没有集群名时无法区分共用 DCS 账号的集群创建的安全组
+	if g.Mode == GCModeDelete && g.ClusterName == "" {
+		return fmt.Errorf("garbage collection mode %q requires the name of the cluster", g.Mode)
+	}
+	if g.DCS == nil {
+		g.DCS = dcsClient
+	}
+	return mgr.Add(g)
+}
+
+// collect finds, reports and deletes the orphans.
+func (g *SecurityGroupCollector) collect(ctx context.Context) error {
+	now := time.Now()
+	if g.orphanedSince == nil {
+		since, err := g.readOrphanedSince(ctx)
+		if err != nil {
+			return err
+		}
+		g.orphanedSince = since
+	}
+	sgs := &paasv1.SecurityGroupList{}
+	if err := g.List(ctx, sgs); err != nil {
+		return err
+	}
+	accounts := map[dcs.Account]bool{}
+	for _, a := range g.Accounts {
+		accounts[a] = true
+	}
+	for i := range sgs.Items {
+		accounts[dcs.AccountOf(&sgs.Items[i])] = true
+	}
+
+	remote := map[dcs.Account][]dcs.SecurityGroup{}
+	for account := range accounts {
+		groups, err := g.DCS.ListSecurityGroups(ctx, account)
+		if err != nil {
+			return fmt.Errorf("account %s: %v", account.AccountId, err)
+		}
+		remote[account] = groups
+	}
+	// 先列出 DCS 中的安全组，再列出 SecurityGroup，刚创建的安全组才能找到其 SecurityGroup
+	if err := g.List(ctx, sgs); err != nil {
+		return err
+	}
+	used := map[string]bool{}
+	adopting := map[string]bool{}
+	for _, sg := range sgs.Items {
+		used[sg.Status.Id] = true
+		used[sg.Annotations[dcs.AdoptAnnotation]] = true
+		if sg.Status.Id == "" {
+			adopting[string(sg.UID)] = true
+		}
+	}
+
+	var orphans []orphan
+	orphaned := map[string]time.Time{}
+	for account, groups := range remote {
+		for _, group := range groups {
+			if !group.OwnedBy(g.ClusterName) || used[group.Id] {
+				continue
+			}
+			if _, _, uid, ok := group.Owner(); ok && adopting[uid] {
+				continue
+			}
+			since, ok := g.orphanedSince[group.Id]
+			if !ok {
+				since = now
+			}
+			orphaned[group.Id] = since
+			o := orphan{account: account, group: group, since: since, state: "orphaned"}
+			if g.Mode == GCModeDelete && now.Sub(since) >= g.GracePeriod {
+				if err := g.DCS.DeleteSecurityGroup(ctx, account, group.Id); err != nil {
+					o.state = "delete failed: " + err.Error()
+				} else {
+					o.state = "deleted"
+					delete(orphaned, group.Id)
+				}
+			}
+			g.Log.Info("发现孤立的 DCS 安全组", "account", account.AccountId, "id", group.Id, "name", group.Name, "state", o.state)
+			orphans = append(orphans, o)
+		}
+	}
+	g.orphanedSince = orphaned
+	return g.writeReport(ctx, now, orphans)
+}
+
+// writeReport writes the orphans into the report ConfigMap.
+func (g *SecurityGroupCollector) writeReport(ctx context.Context, now time.Time, orphans []orphan) error {
+	sort.Slice(orphans, func(i, j int) bool {
+		if orphans[i].account.AccountId != orphans[j].account.AccountId {
+			return orphans[i].account.AccountId < orphans[j].account.AccountId
+		}
+		return orphans[i].group.Id < orphans[j].group.Id
+	})
+	var b strings.Builder
+	fmt.Fprintf(&b, "mode: %s, grace period: %s, orphans: %d\n", g.Mode, g.GracePeriod, len(orphans))
+	for _, o := range orphans {
+		fmt.Fprintf(&b, "account %s id %s name %q orphaned since %s: %s\n",
+			o.account.AccountId, o.group.Id, o.group.Name, o.since.Format(time.RFC3339), o.state)
+	}
+	since, err := json.Marshal(g.orphanedSince)
+	if err != nil {
+		return err
+	}
+	data := map[string]string{"time": now.Format(time.RFC3339), "report": b.String(), reportOrphanedSince: string(since)}
+
+	cm := &corev1.ConfigMap{}
+	err = g.Get(ctx, g.Report, cm)
+	if apierrors.IsNotFound(err) {
+		cm = &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: g.Report.Namespace, Name: g.Report.Name}, Data: data}
+		return g.Create(ctx, cm)
+	}
+	if err != nil {
+		return err
+	}
+	cm.Data = data
+	return g.Update(ctx, cm)
+}
+
+// readOrphanedSince reads when each orphan was first found from the report ConfigMap.
+func (g *SecurityGroupCollector) readOrphanedSince(ctx context.Context) (map[string]time.Time, error) {
+	since := map[string]time.Time{}
+	cm := &corev1.ConfigMap{}
+	if err := g.Get(ctx, g.Report, cm); apierrors.IsNotFound(err) {
+		return since, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if data := cm.Data[reportOrphanedSince]; data != "" {
+		// 报告损坏时重新计算宽限期，不会提前删除
+		if err := json.Unmarshal([]byte(data), &since); err != nil {
+			g.Log.Error(err, "读取孤立安全组的发现时间失败", "configmap", g.Report)
+			return map[string]time.Time{}, nil
+		}
+	}
+	return since, nil
+}
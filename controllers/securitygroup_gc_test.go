@@ -0,0 +1,262 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	paasv1 "security-group/api/v1"
+	"security-group/dcs"
+	dcsfake "security-group/dcs/fake"
+)
+
+func newTestScheme(t *testing.T) *runtime.Scheme {
+	s := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := paasv1.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func newTestCollector(t *testing.T, api *dcsfake.Client, objs ...runtime.Object) *SecurityGroupCollector {
+	return &SecurityGroupCollector{
+		Client:        fake.NewFakeClientWithScheme(newTestScheme(t), objs...),
+		Log:           logf.Log,
+		Mode:          GCModeReport,
+		Accounts:      []dcs.Account{{AccountId: "acc", UserId: "user"}},
+		GracePeriod:   time.Hour,
+		ClusterName:   "prod",
+		Report:        client.ObjectKey{Namespace: "security-group-system", Name: "gc-report"},
+		DCS:           api,
+		orphanedSince: map[string]time.Time{},
+	}
+}
+
+// owned returns a security group the controller of the prod cluster created for the UID.
+func owned(id, uid string) dcs.SecurityGroup {
+	return dcs.SecurityGroup{Id: id, Name: "sg-" + id, Owned: true, Tags: map[string]string{dcs.TagCluster: "prod", dcs.TagUID: uid}}
+}
+
+func report(t *testing.T, g *SecurityGroupCollector) string {
+	cm := &corev1.ConfigMap{}
+	if err := g.Get(context.Background(), g.Report, cm); err != nil {
+		t.Fatal(err)
+	}
+	return cm.Data["report"]
+}
+
+func TestCollect(t *testing.T) {
+	api := &dcsfake.Client{Groups: []dcs.SecurityGroup{
+		owned("1", "uid-a"),
+		owned("2", "uid-b"),
+		owned("3", "uid-c"),
+		owned("4", "uid-d"),
+		{Id: "5", Owned: true, Tags: map[string]string{dcs.TagCluster: "test", dcs.TagUID: "uid-e"}},
+		{Id: "6", Owned: true},
+		{Id: "7", Tags: map[string]string{"team": "a"}},
+	}}
+	spec := paasv1.SecurityGroupSpec{AccountId: "acc", UserId: "user"}
+	g := newTestCollector(t, api,
+		&paasv1.SecurityGroup{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "a", UID: "uid-a"}, Spec: spec, Status: paasv1.SecurityGroupStatus{Id: "1"}},
+		&paasv1.SecurityGroup{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "b", Annotations: map[string]string{dcs.AdoptAnnotation: "2"}}, Spec: spec},
+		&paasv1.SecurityGroup{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "c", UID: "uid-c"}, Spec: spec},
+	)
+
+	if err := g.collect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// 只有本集群创建、没有 SecurityGroup 且不在采纳中的安全组是孤立的
+	if got := g.orphanedSince; len(got) != 1 || got["4"].IsZero() {
+		t.Errorf("orphanedSince = %v, want only 4", got)
+	}
+	if got := report(t, g); !strings.Contains(got, "orphans: 1\n") || !strings.Contains(got, `id 4 name "sg-4"`) {
+		t.Errorf("report = %q, want orphan 4", got)
+	}
+	if api.Calls != nil {
+		t.Errorf("calls = %v, want none in report mode", api.Calls)
+	}
+}
+
+func TestCollectGracePeriod(t *testing.T) {
+	api := &dcsfake.Client{Groups: []dcs.SecurityGroup{owned("1", "uid-a"), owned("2", "uid-b")}}
+	g := newTestCollector(t, api)
+	g.Mode = GCModeDelete
+
+	if err := g.collect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if api.Calls != nil {
+		t.Fatalf("calls = %v, want none within the grace period", api.Calls)
+	}
+	first := g.orphanedSince["1"]
+	if first.IsZero() {
+		t.Fatalf("orphanedSince = %v, want 1 recorded", g.orphanedSince)
+	}
+
+	// 孤立的时间保留到下一次回收，超过宽限期的安全组被删除
+	g.orphanedSince["1"] = first.Add(-2 * time.Hour)
+	if err := g.collect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"delete 1"}; !reflect.DeepEqual(api.Calls, want) {
+		t.Errorf("calls = %v, want %v", api.Calls, want)
+	}
+	if _, ok := g.orphanedSince["1"]; ok {
+		t.Errorf("orphanedSince = %v, want deleted 1 forgotten", g.orphanedSince)
+	}
+	if !g.orphanedSince["2"].Equal(first) {
+		t.Errorf("orphanedSince[2] = %v, want %v", g.orphanedSince["2"], first)
+	}
+	if got := report(t, g); !strings.Contains(got, "id 1 name \"sg-1\" orphaned since") || !strings.Contains(got, ": deleted\n") {
+		t.Errorf("report = %q, want 1 deleted", got)
+	}
+
+	// 安全组有了 SecurityGroup 后不再是孤立的
+	if err := g.Create(context.Background(), &paasv1.SecurityGroup{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "b"}, Spec: paasv1.SecurityGroupSpec{AccountId: "acc", UserId: "user"}, Status: paasv1.SecurityGroupStatus{Id: "2"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.collect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(g.orphanedSince) != 0 {
+		t.Errorf("orphanedSince = %v, want none", g.orphanedSince)
+	}
+}
+
+func TestCollectGracePeriodAfterRestart(t *testing.T) {
+	api := &dcsfake.Client{Groups: []dcs.SecurityGroup{owned("1", "uid-a")}}
+	g := newTestCollector(t, api)
+	g.Mode = GCModeDelete
+	if err := g.collect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	first := g.orphanedSince["1"]
+
+	// 重启后从报告中读取发现时间
+	restarted := newTestCollector(t, api)
+	restarted.Client = g.Client
+	restarted.Mode = GCModeDelete
+	restarted.orphanedSince = nil
+	if err := restarted.collect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !restarted.orphanedSince["1"].Equal(first) {
+		t.Errorf("orphanedSince[1] = %v, want %v", restarted.orphanedSince["1"], first)
+	}
+	if api.Calls != nil {
+		t.Fatalf("calls = %v, want none within the grace period", api.Calls)
+	}
+
+	cm := &corev1.ConfigMap{}
+	if err := g.Get(context.Background(), g.Report, cm); err != nil {
+		t.Fatal(err)
+	}
+	cm.Data[reportOrphanedSince] = `{"1":"` + first.Add(-2*time.Hour).Format(time.RFC3339) + `"}`
+	if err := g.Update(context.Background(), cm); err != nil {
+		t.Fatal(err)
+	}
+	restarted.orphanedSince = nil
+	if err := restarted.collect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"delete 1"}; !reflect.DeepEqual(api.Calls, want) {
+		t.Errorf("calls = %v, want %v", api.Calls, want)
+	}
+}
+
+func TestParseAccounts(t *testing.T) {
+	got, err := ParseAccounts(" a:1, ,b:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []dcs.Account{{AccountId: "a", UserId: "1"}, {AccountId: "b", UserId: "2"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseAccounts() = %v, want %v", got, want)
+	}
+	for _, s := range []string{"a", "a:1:ns", ":1"} {
+		if _, err := ParseAccounts(s); err == nil {
+			t.Errorf("ParseAccounts(%q) succeeded, want an error", s)
+		}
+	}
+}
+
+func TestWriteReport(t *testing.T) {
+	now := time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC)
+	g := newTestCollector(t, &dcsfake.Client{}, &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "security-group-system", Name: "gc-report"},
+		Data:       map[string]string{"report": "old"},
+	})
+	orphans := []orphan{
+		{account: dcs.Account{AccountId: "b"}, group: dcs.SecurityGroup{Id: "1", Name: "web"}, since: now, state: "orphaned"},
+		{account: dcs.Account{AccountId: "a"}, group: dcs.SecurityGroup{Id: "2", Name: "db"}, since: now.Add(-time.Hour), state: "deleted"},
+	}
+	if err := g.writeReport(context.Background(), now, orphans); err != nil {
+		t.Fatal(err)
+	}
+	want := "mode: report, grace period: 1h0m0s, orphans: 2\n" +
+		"account a id 2 name \"db\" orphaned since 2020-03-01T11:00:00Z: deleted\n" +
+		"account b id 1 name \"web\" orphaned since 2020-03-01T12:00:00Z: orphaned\n"
+	if got := report(t, g); got != want {
+		t.Errorf("report = %q, want %q", got, want)
+	}
+}
+
+func TestReleaseSecurityGroup(t *testing.T) {
+	api := &dcsfake.Client{Groups: []dcs.SecurityGroup{
+		owned("1", "uid-a"),
+		{Id: "2", Owned: true, Tags: map[string]string{dcs.TagCluster: "test"}},
+	}}
+	defer func(c dcs.Client) { dcsClient = c }(dcsClient)
+	dcsClient = api
+	r := &SecurityGroupReconciler{Log: logf.Log, ClusterName: "prod"}
+
+	for _, id := range []string{"1", "2", "3"} {
+		sg := &paasv1.SecurityGroup{Spec: paasv1.SecurityGroupSpec{ManagementPolicy: paasv1.ManagementPolicyCreateOnly}, Status: paasv1.SecurityGroupStatus{Id: id}}
+		if err := r.cleanSecurityGroup(context.Background(), ctrl.Request{}, sg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 只释放本集群的安全组，不删除
+	if want := []string{"release 1"}; !reflect.DeepEqual(api.Calls, want) {
+		t.Errorf("calls = %v, want %v", api.Calls, want)
+	}
+	if g := api.Groups[0]; g.OwnedBy("prod") || len(g.Tags) != 0 {
+		t.Errorf("released group = %+v, want no marker or tags", g)
+	}
+	g := newTestCollector(t, api)
+	if err := g.collect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(g.orphanedSince) != 0 {
+		t.Errorf("orphanedSince = %v, want released group left alone", g.orphanedSince)
+	}
+}
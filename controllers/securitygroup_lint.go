@@ -0,0 +1,59 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	paasv1 "security-group/api/v1"
+	"security-group/lint"
+	"security-group/planner"
+)
+
+// ReasonLintFindings is the Event reason for new findings of the rule analyzer.
+const ReasonLintFindings string = "LintFindings"
+
+// lintRules records the redundant, shadowed and overly permissive rules of the spec in the
+// status, and as an Event when they change. The rules generated for Services are not
+// analyzed. Findings never block changes to DCS.
+func (r *SecurityGroupReconciler) lintRules(ctx context.Context, sg *paasv1.SecurityGroup) error {
+	expanded, err := planner.ExpandActive(ctx, r, sg)
+	if err != nil {
+		return err
+	}
+	findings, err := lint.Analyze(expanded)
+	if err != nil {
+		return err
+	}
+	status := lint.Status(findings)
+	if reflect.DeepEqual(status, sg.Status.Lint) {
+		return nil
+	}
+	sg.Status.Lint = status
+	if len(findings) > 0 {
+		messages := make([]string, 0, len(findings))
+		for _, f := range findings {
+			messages = append(messages, f.String())
+		}
+		r.Recorder.Event(sg, corev1.EventTypeWarning, ReasonLintFindings, strings.Join(messages, "; "))
+	}
+	return r.Status().Update(ctx, sg)
+}
@@ -0,0 +1,59 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	paasv1 "security-group/api/v1"
+	"security-group/dcs"
+	"security-group/planner"
+)
+
+// observeSecurityGroup refreshes the status of a SecurityGroup from its security group in
+// DCS without changing it, for SecurityGroups whose management policy forbids the changes.
+// The calls that would make DCS match the spec are recorded as an unapplied plan, and the
+// SecurityGroup is marked as drifted while there are any.
+func (r *SecurityGroupReconciler) observeSecurityGroup(ctx context.Context, sg *paasv1.SecurityGroup) error {
+	if sg.Status.Id == "" && sg.Annotations[dcs.AdoptAnnotation] != "" {
+		if err := r.adoptSecurityGroup(ctx, sg); err != nil {
+			return r.ruleError(ctx, sg, err)
+		}
+	}
+	if sg.Status.Id == "" {
+		return r.ruleError(ctx, sg, fmt.Errorf("%s SecurityGroup has no security group to observe, set the %s annotation",
+			sg.Spec.ManagementPolicy, dcs.AdoptAnnotation))
+	}
+	changes, err := r.plannedChanges(ctx, sg)
+	if err != nil {
+		return r.ruleError(ctx, sg, err)
+	}
+	// plannedChanges 在安全组不存在时计划创建安全组
+	if len(changes) > 0 && changes[0].Action == paasv1.PlanActionCreateSecurityGroup {
+		sg.Status.SetConditions(paasv1.Unavailable().WithMessage(fmt.Sprintf("security group %s does not exist in DCS", sg.Status.Id)),
+			paasv1.ReconcileSuccess())
+	} else if len(changes) > 0 {
+		sg.Status.SetConditions(paasv1.Available(), paasv1.Drifted(planner.Summary(changes)))
+	} else {
+		sg.Status.SetConditions(paasv1.Available(), paasv1.ReconcileSuccess())
+	}
+	if err := r.recordPlan(ctx, sg, changes); err != nil {
+		return err
+	}
+	return r.Status().Update(ctx, sg)
+}
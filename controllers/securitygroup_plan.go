@@ -0,0 +1,81 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"security-group/planner"
+
+	paasv1 "security-group/api/v1"
+)
+
+const (
+	// ReconcileModeAnnotation selects how a SecurityGroup is reconciled.
+	ReconcileModeAnnotation string = "paas.unicom.cn/reconcile-mode"
+
+	// ReconcileModeApply makes the calls to DCS. This is the default.
+	ReconcileModeApply string = "apply"
+	// ReconcileModePlan computes the calls to DCS and records them without making them.
+	ReconcileModePlan string = "plan"
+
+	ReasonPlanned string = "Planned"
+)
+
+// planMode reports whether the security group is reconciled in plan mode, either because
+// the controller runs in plan mode or because the SecurityGroup is annotated.
+func (r *SecurityGroupReconciler) planMode(sg *paasv1.SecurityGroup) bool {
+	return r.ReconcileMode == ReconcileModePlan || sg.Annotations[ReconcileModeAnnotation] == ReconcileModePlan
+}
+
+// planSecurityGroup computes the calls applySecurityGroup and applySecurityGroupRules would
+// make and records them in the status and as an Event. Nothing is changed in DCS.
+func (r *SecurityGroupReconciler) planSecurityGroup(ctx context.Context, sg *paasv1.SecurityGroup) error {
+	changes, err := r.plannedChanges(ctx, sg)
+	if err != nil {
+		return r.ruleError(ctx, sg, err)
+	}
+	return r.recordPlan(ctx, sg, changes)
+}
+
+// plannedChanges computes the calls applySecurityGroup and applySecurityGroupRules would make.
+func (r *SecurityGroupReconciler) plannedChanges(ctx context.Context, sg *paasv1.SecurityGroup) ([]paasv1.PlannedChange, error) {
+	desired, err := r.desiredRules(ctx, sg)
+	if err != nil {
+		return nil, err
+	}
+	return planner.Changes(ctx, dcsClient, sg, desired, r.ClusterName)
+}
+
+// planCleanSecurityGroup records the calls cleanSecurityGroup would make.
+func (r *SecurityGroupReconciler) planCleanSecurityGroup(ctx context.Context, sg *paasv1.SecurityGroup) error {
+	return r.recordPlan(ctx, sg, planner.CleanChanges(sg))
+}
+
+// recordPlan writes an unapplied plan into the status and an Event, unless the same plan
+// is already recorded.
+func (r *SecurityGroupReconciler) recordPlan(ctx context.Context, sg *paasv1.SecurityGroup, changes []paasv1.PlannedChange) error {
+	if sg.Status.Plan != nil && !sg.Status.Plan.Applied && reflect.DeepEqual(sg.Status.Plan.Changes, changes) {
+		return nil
+	}
+	sg.Status.Plan = &paasv1.SecurityGroupPlan{Changes: changes, Time: time.Now().Format(time.RFC3339)}
+	r.Recorder.Event(sg, corev1.EventTypeNormal, ReasonPlanned, planner.Summary(changes))
+	return r.Status().Update(ctx, sg)
+}
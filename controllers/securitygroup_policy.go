@@ -0,0 +1,84 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	paasv1 "security-group/api/v1"
+	"security-group/policy"
+)
+
+// +kubebuilder:rbac:groups=paas.unicom.cn,resources=securitygrouppolicies,verbs=get;list;watch
+
+// checkPolicies checks the desired rules of the security group, including the rules generated
+// from Services, against the SecurityGroupPolicies. The webhook only sees the spec and may be
+// bypassed or predate a policy, so the reconciler checks again before changing DCS.
+// A violation is recorded as a condition and an Event and returned as an error.
+func (r *SecurityGroupReconciler) checkPolicies(ctx context.Context, sg *paasv1.SecurityGroup) error {
+	desired, err := r.desiredRules(ctx, sg)
+	if err != nil {
+		return r.ruleError(ctx, sg, err)
+	}
+	policies := &paasv1.SecurityGroupPolicyList{}
+	if err := r.List(ctx, policies); err != nil {
+		return err
+	}
+	violations, err := policy.Check(sg.Namespace, desired, policies.Items)
+	if err != nil {
+		return r.ruleError(ctx, sg, err)
+	}
+
+	if len(violations) == 0 {
+		if sg.Status.GetCondition(paasv1.TypeCompliant).Status != paasv1.ConditionTrue {
+			sg.Status.SetConditions(paasv1.Compliant())
+			return r.Status().Update(ctx, sg)
+		}
+		return nil
+	}
+
+	messages := make([]string, 0, len(violations))
+	for _, v := range violations {
+		messages = append(messages, v.String())
+	}
+	msg := strings.Join(messages, "; ")
+	sg.Status.SetConditions(paasv1.PolicyViolation(msg), paasv1.ReconcileError(errors.New(msg)))
+	r.Recorder.Event(sg, corev1.EventTypeWarning, paasv1.ReasonPolicyViolation, msg)
+	r.Status().Update(ctx, sg)
+	return errors.New(msg)
+}
+
+// allSecurityGroups enqueues every SecurityGroup, so that a changed policy is checked again.
+func (r *SecurityGroupReconciler) allSecurityGroups() []reconcile.Request {
+	sgs := &paasv1.SecurityGroupList{}
+	if err := r.List(context.Background(), sgs, client.InNamespace("")); err != nil {
+		r.Log.Error(err, "获取 SecurityGroup 列表失败")
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(sgs.Items))
+	for _, sg := range sgs.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: sg.Namespace, Name: sg.Name}})
+	}
+	return requests
+}
@@ -0,0 +1,115 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"security-group/dcs"
+	"security-group/planner"
+	"security-group/rules"
+
+	paasv1 "security-group/api/v1"
+)
+
+// Event reasons for rule changes.
+const (
+	ReasonRulesPlanned string = "RulesPlanned"
+	ReasonRulesApplied string = "RulesApplied"
+	ReasonRulesFailed  string = "RulesFailed"
+)
+
+// applySecurityGroupRules makes the rules of the security group in DCS match the desired rules.
+// Rules are only removed if the SecurityGroup manages its rules or they were generated for
+// a Service.
+// The changes are recorded in the status and as Events.
+func (r *SecurityGroupReconciler) applySecurityGroupRules(ctx context.Context, sg *paasv1.SecurityGroup) error {
+	// 安全组尚未创建，没有规则需要同步
+	if sg.Status.Id == "" {
+		return nil
+	}
+
+	normalized, err := r.desiredRules(ctx, sg)
+	if err != nil {
+		return r.ruleError(ctx, sg, err)
+	}
+	remote, err := r.remoteRules(ctx, sg)
+	if err != nil {
+		return r.ruleError(ctx, sg, err)
+	}
+
+	// 计算最小变更计划，没有变更则直接返回
+	plan := planner.RuleChanges(sg, normalized, remote)
+	if len(plan) == 0 {
+		return nil
+	}
+	sg.Status.Plan = &paasv1.SecurityGroupPlan{Changes: plan.Status(), Time: time.Now().Format(time.RFC3339)}
+	r.Recorder.Event(sg, corev1.EventTypeNormal, ReasonRulesPlanned, plan.Summary())
+
+	// 按计划顺序执行：先创建缺少的规则，再删除多余的规则
+	for _, change := range plan {
+		if err := r.applyRuleChange(ctx, sg, change); err != nil {
+			r.Recorder.Event(sg, corev1.EventTypeWarning, ReasonRulesFailed, err.Error())
+			return r.ruleError(ctx, sg, err)
+		}
+	}
+	sg.Status.Plan.Applied = true
+	r.Recorder.Eventf(sg, corev1.EventTypeNormal, ReasonRulesApplied, "Created %d and deleted %d rules", plan.Creates(), plan.Deletes())
+	return r.Status().Update(ctx, sg)
+}
+
+// desiredRules returns the normalized rules of the spec that have not expired, with their
+// address groups and services expanded, and the rules generated for it.
+func (r *SecurityGroupReconciler) desiredRules(ctx context.Context, sg *paasv1.SecurityGroup) ([]rules.Rule, error) {
+	desired, err := planner.ExpandActive(ctx, r, sg)
+	if err != nil {
+		return nil, err
+	}
+	if r.ServiceRules {
+		generated, err := r.serviceRules(ctx, sg)
+		if err != nil {
+			return nil, err
+		}
+		desired = append(desired, generated...)
+	}
+	return planner.Desired(desired)
+}
+
+// remoteRules returns the rules of the security group in DCS.
+func (r *SecurityGroupReconciler) remoteRules(ctx context.Context, sg *paasv1.SecurityGroup) ([]rules.RemoteRule, error) {
+	return dcsClient.ListRules(ctx, dcs.AccountOf(sg), sg.Status.Id)
+}
+
+// applyRuleChange makes a single call to DCS.
+func (r *SecurityGroupReconciler) applyRuleChange(ctx context.Context, sg *paasv1.SecurityGroup, change rules.Change) error {
+	switch change.Action {
+	case paasv1.PlanActionCreateRule:
+		return dcsClient.CreateRule(ctx, dcs.AccountOf(sg), sg.Status.Id, change.Rule)
+	case paasv1.PlanActionDeleteRule:
+		return dcsClient.DeleteRule(ctx, dcs.AccountOf(sg), sg.Status.Id, change.RemoteId)
+	}
+	return nil
+}
+
+// ruleError records a rule synchronization error in the status and returns it.
+func (r *SecurityGroupReconciler) ruleError(ctx context.Context, sg *paasv1.SecurityGroup, err error) error {
+	sg.Status.SetConditions(paasv1.ReconcileError(err))
+	r.Status().Update(ctx, sg)
+	return err
+}
@@ -0,0 +1,98 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"security-group/planner"
+	"security-group/schedule"
+
+	paasv1 "security-group/api/v1"
+)
+
+// Event reasons for windows of scheduled rules.
+const (
+	ReasonScheduledRuleOpened string = "ScheduledRuleOpened"
+	ReasonScheduledRuleClosed string = "ScheduledRuleClosed"
+)
+
+// trackScheduledRules records whether the window of each scheduled rule of the spec and its
+// template is open and when it opens or closes next, and emits Events at the transitions.
+// It returns how long until the next transition, or 0 if there is none.
+func (r *SecurityGroupReconciler) trackScheduledRules(ctx context.Context, sg *paasv1.SecurityGroup) (time.Duration, error) {
+	now := time.Now()
+	var tracked []paasv1.ScheduledRule
+	var next time.Time
+	seen := map[string]bool{}
+	for i, rule := range planner.SpecRules(sg) {
+		if rule.Schedule == nil {
+			continue
+		}
+		key := rule.String()
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		w, err := schedule.ForRule(rule.Schedule)
+		if err != nil {
+			return 0, r.ruleError(ctx, sg, fmt.Errorf("rule %d: %v", i, err))
+		}
+		active, transition := w.Active(now)
+		s := paasv1.ScheduledRule{Rule: key, Active: active}
+		if !transition.IsZero() {
+			s.NextTransitionTime = transition.Format(time.RFC3339)
+			if next.IsZero() || transition.Before(next) {
+				next = transition
+			}
+		}
+
+		old, ok := sg.Status.GetScheduledRule(key)
+		switch {
+		case active && (!ok || !old.Active):
+			r.Recorder.Eventf(sg, corev1.EventTypeNormal, ReasonScheduledRuleOpened, "Window of scheduled rule %s opened until %s", key, s.NextTransitionTime)
+		case !active && ok && old.Active:
+			r.Recorder.Eventf(sg, corev1.EventTypeNormal, ReasonScheduledRuleClosed, "Window of scheduled rule %s closed until %s", key, s.NextTransitionTime)
+		}
+		tracked = append(tracked, s)
+	}
+
+	if !reflect.DeepEqual(tracked, sg.Status.ScheduledRules) {
+		sg.Status.ScheduledRules = tracked
+		if err := r.Status().Update(ctx, sg); err != nil {
+			return 0, err
+		}
+	}
+	if next.IsZero() {
+		return 0, nil
+	}
+	// 多等一秒，保证重新调谐时窗口已经切换
+	return next.Sub(now) + time.Second, nil
+}
+
+// earliest returns the shorter of two requeue intervals, ignoring zero intervals.
+func earliest(a, b time.Duration) time.Duration {
+	if a == 0 || (b != 0 && b < a) {
+		return b
+	}
+	return a
+}
@@ -0,0 +1,121 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	paasv1 "security-group/api/v1"
+	"security-group/planner"
+	"security-group/render"
+)
+
+// +kubebuilder:rbac:groups=paas.unicom.cn,resources=securitygrouptemplates,verbs=get;list;watch
+// +kubebuilder:rbac:groups=paas.unicom.cn,resources=clustersecuritygrouptemplates,verbs=get;list;watch
+
+const (
+	// templateIndex indexes SecurityGroups by the key of the template they reference.
+	templateIndex string = ".spec.template"
+
+	ReasonTemplateRendered string = "TemplateRendered"
+	ReasonTemplateFailed   string = "TemplateFailed"
+)
+
+// renderTemplate renders the template of the spec into the status. Nothing is recorded if
+// the rendered result did not change.
+func (r *SecurityGroupReconciler) renderTemplate(ctx context.Context, sg *paasv1.SecurityGroup) error {
+	ref := sg.Spec.Template
+	if ref == nil {
+		if sg.Status.Template == nil {
+			return nil
+		}
+		sg.Status.Template = nil
+		return r.Status().Update(ctx, sg)
+	}
+
+	spec, resourceVersion, err := planner.GetTemplate(ctx, r, sg.Namespace, ref)
+	if err != nil {
+		return r.templateError(ctx, sg, fmt.Errorf("failed to get %s: %v", ref.Key(), err))
+	}
+
+	description, rules, err := render.Template(spec, ref.Parameters)
+	if err != nil {
+		return r.templateError(ctx, sg, fmt.Errorf("failed to render %s: %v", ref.Key(), err))
+	}
+	rendered := &paasv1.RenderedTemplate{
+		Template:        ref.Key(),
+		ResourceVersion: resourceVersion,
+		Description:     description,
+		Rules:           rules,
+	}
+	if reflect.DeepEqual(rendered, sg.Status.Template) {
+		return nil
+	}
+	if !reflect.DeepEqual(renderedOnly(rendered), renderedOnly(sg.Status.Template)) {
+		r.Recorder.Eventf(sg, corev1.EventTypeNormal, ReasonTemplateRendered, "Rendered %d rules from %s", len(rules), ref.Key())
+	}
+	sg.Status.Template = rendered
+	return r.Status().Update(ctx, sg)
+}
+
+func (r *SecurityGroupReconciler) templateError(ctx context.Context, sg *paasv1.SecurityGroup, err error) error {
+	r.Recorder.Event(sg, corev1.EventTypeWarning, ReasonTemplateFailed, err.Error())
+	return r.ruleError(ctx, sg, err)
+}
+
+// renderedOnly returns the rendered result without the version of the template.
+func renderedOnly(t *paasv1.RenderedTemplate) *paasv1.RenderedTemplate {
+	if t == nil {
+		return nil
+	}
+	c := t.DeepCopy()
+	c.ResourceVersion = ""
+	return c
+}
+
+// indexTemplate returns the template a SecurityGroup references.
+func indexTemplate(obj runtime.Object) []string {
+	sg := obj.(*paasv1.SecurityGroup)
+	if sg.Spec.Template == nil {
+		return nil
+	}
+	return []string{sg.Spec.Template.Key()}
+}
+
+// securityGroupsForTemplate enqueues the SecurityGroups that reference the template, in
+// namespace or in all namespaces for a ClusterSecurityGroupTemplate.
+func (r *SecurityGroupReconciler) securityGroupsForTemplate(kind, namespace, name string) []reconcile.Request {
+	sgs := &paasv1.SecurityGroupList{}
+	key := (&paasv1.TemplateReference{Kind: kind, Name: name}).Key()
+	if err := r.List(context.Background(), sgs, client.InNamespace(namespace), client.MatchingFields{templateIndex: key}); err != nil {
+		r.Log.Error(err, "获取引用模板的 SecurityGroup 列表失败", "template", key)
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(sgs.Items))
+	for _, sg := range sgs.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: sg.Namespace, Name: sg.Name}})
+	}
+	return requests
+}
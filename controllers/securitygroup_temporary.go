@@ -0,0 +1,128 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"security-group/planner"
+	"security-group/rules"
+
+	paasv1 "security-group/api/v1"
+)
+
+// Event reasons for the lifecycle of temporary rules.
+const (
+	ReasonTemporaryRuleAdded   string = "TemporaryRuleAdded"
+	ReasonTemporaryRuleExpired string = "TemporaryRuleExpired"
+)
+
+// trackTemporaryRules records when the temporary rules of the spec and its template expire,
+// and emits an Event when they expire. The ttl of a rule that has not been applied yet is
+// counted from now. It returns how long until the next rule expires, or 0 if no rule is
+// going to expire.
+func (r *SecurityGroupReconciler) trackTemporaryRules(ctx context.Context, sg *paasv1.SecurityGroup) (time.Duration, error) {
+	now := time.Now()
+	var tracked []paasv1.TemporaryRule
+	var next time.Time
+	seen := map[string]bool{}
+	for i, rule := range planner.SpecRules(sg) {
+		if !rule.Temporary() {
+			continue
+		}
+		key := rule.String()
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		t, _ := sg.Status.GetTemporaryRule(key)
+		t.Rule = key
+		appliedAt := now
+		if t.AppliedAt != "" {
+			appliedAt, _ = time.Parse(time.RFC3339, t.AppliedAt)
+		}
+		expiry, err := rules.Expiry(rule, appliedAt)
+		if err != nil {
+			return 0, r.ruleError(ctx, sg, fmt.Errorf("rule %d: %v", i, err))
+		}
+		t.ExpiresAt = ""
+		if t.AppliedAt != "" || rule.ExpiresAt != "" {
+			t.ExpiresAt = expiry.Format(time.RFC3339)
+		}
+
+		expired := !now.Before(expiry)
+		switch {
+		case expired && !t.Expired:
+			r.Recorder.Eventf(sg, corev1.EventTypeNormal, ReasonTemporaryRuleExpired, "Temporary rule %s expired at %s and is removed", key, expiry.Format(time.RFC3339))
+		case !expired && t.Expired:
+			// 重新生效的规则在再次写入 DCS 时重新计时
+			t.AppliedAt = ""
+		}
+		t.Expired = expired
+		if !expired && (next.IsZero() || expiry.Before(next)) {
+			next = expiry
+		}
+		tracked = append(tracked, t)
+	}
+
+	if !reflect.DeepEqual(tracked, sg.Status.TemporaryRules) {
+		sg.Status.TemporaryRules = tracked
+		if err := r.Status().Update(ctx, sg); err != nil {
+			return 0, err
+		}
+	}
+	if next.IsZero() {
+		return 0, nil
+	}
+	// 多等一秒，保证重新调谐时规则已经过期
+	return next.Sub(now) + time.Second, nil
+}
+
+// startTemporaryRules records the temporary rules that have just been applied to DCS for
+// the first time, which starts their ttl, and emits an Event for them.
+func (r *SecurityGroupReconciler) startTemporaryRules(ctx context.Context, sg *paasv1.SecurityGroup) error {
+	// 安全组尚未创建，规则没有写入 DCS
+	if sg.Status.Id == "" {
+		return nil
+	}
+	now := time.Now()
+	started := false
+	for _, rule := range planner.SpecRules(sg) {
+		t, ok := sg.Status.GetTemporaryRule(rule.String())
+		if !rule.Temporary() || !ok || t.AppliedAt != "" || t.Expired {
+			continue
+		}
+		expiry, err := rules.Expiry(rule, now)
+		if err != nil {
+			return err
+		}
+		t.AppliedAt = now.Format(time.RFC3339)
+		t.ExpiresAt = expiry.Format(time.RFC3339)
+		sg.Status.SetTemporaryRule(t)
+		started = true
+		r.Recorder.Eventf(sg, corev1.EventTypeNormal, ReasonTemporaryRuleAdded, "Temporary rule %s is added until %s", t.Rule, t.ExpiresAt)
+	}
+	if !started {
+		return nil
+	}
+	return r.Status().Update(ctx, sg)
+}
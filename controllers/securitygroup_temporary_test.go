@@ -0,0 +1,85 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	paasv1 "security-group/api/v1"
+	"security-group/planner"
+)
+
+func TestTemporaryRuleStartsWhenApplied(t *testing.T) {
+	rule := paasv1.SecurityGroupRule{Direction: "ingress", Protocol: "tcp", Ports: "22", CIDR: "10.0.0.0/8", TTL: "1h"}
+	sg := &paasv1.SecurityGroup{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "web"},
+		Spec:       paasv1.SecurityGroupSpec{Rules: []paasv1.SecurityGroupRule{rule}},
+	}
+	r := &SecurityGroupReconciler{
+		Client:   fake.NewFakeClientWithScheme(newTestScheme(t), sg.DeepCopy()),
+		Log:      logf.Log,
+		Recorder: record.NewFakeRecorder(10),
+	}
+	ctx := context.Background()
+
+	// 等待审批或安全组尚未创建时规则没有写入 DCS，不开始计时
+	if _, err := r.trackTemporaryRules(ctx, sg); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.startTemporaryRules(ctx, sg); err != nil {
+		t.Fatal(err)
+	}
+	tracked, _ := sg.Status.GetTemporaryRule(rule.String())
+	if tracked.AppliedAt != "" || tracked.ExpiresAt != "" {
+		t.Fatalf("temporary rule = %+v, want not started", tracked)
+	}
+	if active := planner.ActiveRules(sg, time.Now().Add(2*time.Hour)); len(active) != 1 {
+		t.Errorf("ActiveRules() = %v, want the rule not applied yet", active)
+	}
+
+	sg.Status.Id = "1"
+	before := time.Now().Truncate(time.Second)
+	if err := r.startTemporaryRules(ctx, sg); err != nil {
+		t.Fatal(err)
+	}
+	tracked, _ = sg.Status.GetTemporaryRule(rule.String())
+	appliedAt, err := time.Parse(time.RFC3339, tracked.AppliedAt)
+	if err != nil || appliedAt.Before(before) {
+		t.Fatalf("appliedAt = %q, want now", tracked.AppliedAt)
+	}
+	if want := appliedAt.Add(time.Hour).Format(time.RFC3339); tracked.ExpiresAt != want {
+		t.Errorf("expiresAt = %q, want %q", tracked.ExpiresAt, want)
+	}
+	if active := planner.ActiveRules(sg, appliedAt.Add(2*time.Hour)); len(active) != 0 {
+		t.Errorf("ActiveRules() = %v, want the rule expired", active)
+	}
+
+	// 已开始计时的规则不再重新计时
+	if _, err := r.trackTemporaryRules(ctx, sg); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := sg.Status.GetTemporaryRule(rule.String()); got != tracked {
+		t.Errorf("temporary rule = %+v, want %+v", got, tracked)
+	}
+}
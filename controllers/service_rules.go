@@ -0,0 +1,103 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	paasv1 "security-group/api/v1"
+	"security-group/planner"
+)
+
+// +kubebuilder:rbac:groups="",resources=services,verbs=get;list;watch
+
+const (
+	// ServiceSecurityGroupAnnotation names the SecurityGroup in the Service's namespace
+	// that the Service's node ports are opened in.
+	ServiceSecurityGroupAnnotation string = "paas.unicom.cn/security-group"
+)
+
+// serviceRules returns the rules generated from the NodePort and LoadBalancer Services
+// that target the security group.
+func (r *SecurityGroupReconciler) serviceRules(ctx context.Context, sg *paasv1.SecurityGroup) ([]paasv1.SecurityGroupRule, error) {
+	services := &corev1.ServiceList{}
+	if err := r.List(ctx, services, client.InNamespace(sg.Namespace)); err != nil {
+		return nil, fmt.Errorf("failed to list Services: %v", err)
+	}
+	var rules []paasv1.SecurityGroupRule
+	for _, svc := range services.Items {
+		// 删除中的 Service 不再生成规则
+		if svc.Annotations[ServiceSecurityGroupAnnotation] != sg.Name || !svc.DeletionTimestamp.IsZero() {
+			continue
+		}
+		rules = append(rules, rulesForService(&svc)...)
+	}
+	return rules, nil
+}
+
+// rulesForService generates an ingress rule for every node port of the Service and every
+// loadBalancerSourceRanges entry, or for any address of the IP family of the Service if no
+// source ranges are set.
+func rulesForService(svc *corev1.Service) []paasv1.SecurityGroupRule {
+	if svc.Spec.Type != corev1.ServiceTypeNodePort && svc.Spec.Type != corev1.ServiceTypeLoadBalancer {
+		return nil
+	}
+	cidrs := svc.Spec.LoadBalancerSourceRanges
+	if len(cidrs) == 0 {
+		cidrs = []string{""}
+	}
+	// 没有来源地址时按 Service 的地址族放行所有地址
+	ethertype := ""
+	if len(svc.Spec.LoadBalancerSourceRanges) == 0 && svc.Spec.IPFamily != nil && *svc.Spec.IPFamily == corev1.IPv6Protocol {
+		ethertype = paasv1.EthertypeIPv6
+	}
+	var rules []paasv1.SecurityGroupRule
+	for _, port := range svc.Spec.Ports {
+		if port.NodePort == 0 {
+			continue
+		}
+		for _, cidr := range cidrs {
+			rules = append(rules, paasv1.SecurityGroupRule{
+				Direction:   paasv1.DirectionIngress,
+				Protocol:    strings.ToLower(string(port.Protocol)),
+				Ports:       strconv.Itoa(int(port.NodePort)),
+				CIDR:        strings.TrimSpace(cidr),
+				Ethertype:   ethertype,
+				Description: planner.ServiceRuleDescription(svc.Namespace, svc.Name, port.Port),
+			})
+		}
+	}
+	return rules
+}
+
+// securityGroupForService maps a Service to the SecurityGroup named in its annotation.
+var securityGroupForService = handler.ToRequestsFunc(func(a handler.MapObject) []reconcile.Request {
+	name := a.Meta.GetAnnotations()[ServiceSecurityGroupAnnotation]
+	if name == "" {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: a.Meta.GetNamespace(), Name: name}}}
+})
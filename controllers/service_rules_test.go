@@ -0,0 +1,75 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	paasv1 "security-group/api/v1"
+	"security-group/dcs"
+	dcsfake "security-group/dcs/fake"
+	"security-group/rules"
+)
+
+func TestServiceRulesRemovedWithService(t *testing.T) {
+	sg := &paasv1.SecurityGroup{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "web"},
+		Status:     paasv1.SecurityGroupStatus{Id: "1"},
+	}
+	db := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "db", Annotations: map[string]string{ServiceSecurityGroupAnnotation: "web"}},
+		Spec: corev1.ServiceSpec{Type: corev1.ServiceTypeNodePort, Ports: []corev1.ServicePort{
+			{Protocol: corev1.ProtocolTCP, Port: 5432, NodePort: 30432},
+		}},
+	}
+	remote := func(id string, rule paasv1.SecurityGroupRule) rules.RemoteRule {
+		parsed, err := rules.Parse(rule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rules.RemoteRule{Rule: parsed, Id: id}
+	}
+	api := &dcsfake.Client{Rules: map[string][]rules.RemoteRule{"1": {
+		// 已删除的 Service 生成的规则
+		remote("11", paasv1.SecurityGroupRule{Direction: "ingress", Protocol: "tcp", Ports: "30080", Description: "service ns/api port 80"}),
+		remote("12", paasv1.SecurityGroupRule{Direction: "ingress", Protocol: "tcp", Ports: "30432", Description: "service ns/db port 5432"}),
+		remote("13", paasv1.SecurityGroupRule{Direction: "ingress", Protocol: "tcp", Ports: "22", CIDR: "10.0.0.0/8"}),
+	}}}
+	defer func(c dcs.Client) { dcsClient = c }(dcsClient)
+	dcsClient = api
+
+	r := &SecurityGroupReconciler{
+		Client:       fake.NewFakeClientWithScheme(newTestScheme(t), sg.DeepCopy(), db),
+		Log:          logf.Log,
+		Recorder:     record.NewFakeRecorder(10),
+		ServiceRules: true,
+	}
+	if err := r.applySecurityGroupRules(context.Background(), sg); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"delete-rule 1 11"}; !reflect.DeepEqual(api.Calls, want) {
+		t.Errorf("calls = %v, want %v", api.Calls, want)
+	}
+}
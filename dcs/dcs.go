@@ -0,0 +1,343 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package dcs is the client of the DCS security group API shared by the controllers and
+// sgctl. It converts between DCS rules and the canonical rules of the rules package.
+package dcs
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/antihax/optional"
+	"paas.unicom.cn/dcs-sdk/dcsapi"
+	"paas.unicom.cn/dcs-sdk/dcsapi/model/securitygroup"
+
+	paasv1 "security-group/api/v1"
+	"security-group/rules"
+)
+
+const (
+	// DefaultBasePath is the address of the DCS API.
+	DefaultBasePath string = "http://172.31.248.3:30086"
+
+	// AdoptAnnotation is the id of an existing security group in DCS that a SecurityGroup
+	// without an id in its status takes over instead of creating a new security group.
+	AdoptAnnotation string = "paas.unicom.cn/adopt-id"
+
+	// OwnerMarker ends the description of the security groups the controller creates and
+	// updates, which tells them apart from the security groups created by other means.
+	OwnerMarker string = "[security-group-operator]"
+
+	// pageSize is the number of security groups listed per call.
+	pageSize int32 = 100
+)
+
+// MarkDescription returns the description with the owner marker.
+func MarkDescription(description string) string {
+	if description == "" {
+		return OwnerMarker
+	}
+	return description + " " + OwnerMarker
+}
+
+// ParseDescription returns the description without the owner marker, and whether it had it.
+func ParseDescription(description string) (string, bool) {
+	if !strings.HasSuffix(description, OwnerMarker) {
+		return description, false
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(description, OwnerMarker), " "), true
+}
+
+// Account is the DCS account and user calls are made as.
+type Account struct {
+	AccountId string
+	UserId    string
+}
+
+// AccountOf returns the account of the SecurityGroup.
+func AccountOf(sg *paasv1.SecurityGroup) Account {
+	return Account{AccountId: sg.Spec.AccountId, UserId: sg.Spec.UserId}
+}
+
+// SecurityGroup is a security group in DCS.
+type SecurityGroup struct {
+	Id   string
+	Name string
+	// Description without the owner marker.
+	Description string
+	// Owned is true if the description has the owner marker.
+	Owned bool
+	Tags  map[string]string
+}
+
+// securityGroup converts a DCS security group.
+func securityGroup(sg securitygroup.Securitygroup) SecurityGroup {
+	description, owned := ParseDescription(sg.Description)
+	return SecurityGroup{Id: strconv.FormatInt(sg.Id, 10), Name: sg.Name, Description: description, Owned: owned, Tags: TagMap(sg.Tags)}
+}
+
+// Changes describes how the name, description and tags differ from the security group,
+// e.g. `name "web" -> "web-prod"`.
+func (g *SecurityGroup) Changes(name, description string, tags map[string]string) []string {
+	var diffs []string
+	if g.Name != name {
+		diffs = append(diffs, fmt.Sprintf("name %q -> %q", g.Name, name))
+	}
+	if g.Description != description {
+		diffs = append(diffs, fmt.Sprintf("description %q -> %q", g.Description, description))
+	}
+	return append(diffs, tagChanges(g.Tags, tags)...)
+}
+
+// Client reads security groups, reads and writes their rules and attaches them to
+// instances in DCS.
+type Client interface {
+	// GetSecurityGroup returns the security group with the id, or nil if it does not exist.
+	GetSecurityGroup(ctx context.Context, account Account, id string) (*SecurityGroup, error)
+	// ListSecurityGroups returns all security groups of the account.
+	ListSecurityGroups(ctx context.Context, account Account) ([]SecurityGroup, error)
+	// CreateSecurityGroup creates a security group with the owner marker and returns its id.
+	CreateSecurityGroup(ctx context.Context, account Account, name, description string, tags map[string]string) (string, error)
+	// UpdateSecurityGroup sets the name, description and tags of the security group and
+	// adds the owner marker.
+	UpdateSecurityGroup(ctx context.Context, account Account, id, name, description string, tags map[string]string) error
+	// DeleteSecurityGroup deletes the security group.
+	DeleteSecurityGroup(ctx context.Context, account Account, id string) error
+	// ReleaseSecurityGroup removes the owner marker and the tags of the controller from the
+	// security group, so that no controller owns it any more.
+	ReleaseSecurityGroup(ctx context.Context, account Account, id string) error
+	// ListRules returns the rules of the security group.
+	ListRules(ctx context.Context, account Account, id string) ([]rules.RemoteRule, error)
+	// CreateRule adds the rule to the security group.
+	CreateRule(ctx context.Context, account Account, id string, rule rules.Rule) error
+	// DeleteRule removes the rule with the rule id from the security group.
+	DeleteRule(ctx context.Context, account Account, id, ruleId string) error
+	// AttachInstance attaches the security group to the instance.
+	AttachInstance(ctx context.Context, account Account, id, instanceId string) error
+	// DetachInstance detaches the security group from the instance.
+	DetachInstance(ctx context.Context, account Account, id, instanceId string) error
+}
+
+// New returns a client of the DCS API at the base path.
+func New(basePath string) Client {
+	return NewForAPI(dcsapi.NewAPIClient(dcsapi.NewConfigurationWithBasePath(basePath)))
+}
+
+// NewForAPI returns a client that makes its calls with the SDK client.
+func NewForAPI(api *dcsapi.APIClient) Client {
+	return &apiClient{api: api}
+}
+
+type apiClient struct {
+	api *dcsapi.APIClient
+}
+
+func (c *apiClient) GetSecurityGroup(ctx context.Context, account Account, id string) (*SecurityGroup, error) {
+	getSecuritygroupsResponse, _, e := c.api.SecuritygroupApi.V2SecurityGroupsGet(ctx, &dcsapi.SecuritygroupApiV2SecurityGroupsGetOpts{
+		XAccountID: optional.NewString(account.AccountId),
+		XUserID:    optional.NewString(account.UserId),
+		SearchById: optional.NewString(id)})
+	if getSecuritygroupsResponse.Code != 200 {
+		return nil, fmt.Errorf("failed to get Securitygroup: %v, %v", getSecuritygroupsResponse.Message, e)
+	}
+	if len(getSecuritygroupsResponse.Result.List) == 0 {
+		return nil, nil
+	}
+	sg := securityGroup(getSecuritygroupsResponse.Result.List[0])
+	return &sg, nil
+}
+
+func (c *apiClient) ListSecurityGroups(ctx context.Context, account Account) ([]SecurityGroup, error) {
+	var groups []SecurityGroup
+	for page := int32(1); ; page++ {
+		listSecuritygroupsResponse, _, e := c.api.SecuritygroupApi.V2SecurityGroupsGet(ctx, &dcsapi.SecuritygroupApiV2SecurityGroupsGetOpts{
+			XAccountID: optional.NewString(account.AccountId),
+			XUserID:    optional.NewString(account.UserId),
+			PageNo:     optional.NewInt32(page),
+			PageSize:   optional.NewInt32(pageSize)})
+		if listSecuritygroupsResponse.Code != 200 {
+			return nil, fmt.Errorf("failed to list Securitygroups: %v, %v", listSecuritygroupsResponse.Message, e)
+		}
+		for _, sg := range listSecuritygroupsResponse.Result.List {
+			groups = append(groups, securityGroup(sg))
+		}
+		if len(listSecuritygroupsResponse.Result.List) < int(pageSize) || int64(len(groups)) >= listSecuritygroupsResponse.Result.Total {
+			return groups, nil
+		}
+	}
+}
+
+func (c *apiClient) CreateSecurityGroup(ctx context.Context, account Account, name, description string, tags map[string]string) (string, error) {
+	createSecuritygroupResponse, _, e := c.api.SecuritygroupApi.V2SecurityGroupsPost(ctx, &dcsapi.SecuritygroupApiV2SecurityGroupsPostOpts{
+		XAccountID: optional.NewString(account.AccountId),
+		XUserID:    optional.NewString(account.UserId),
+		Root:       &securitygroup.CreateSecuritygroupRequest{Name: name, Description: MarkDescription(description), Tags: Tags(tags)}})
+	if createSecuritygroupResponse.Code != 200 {
+		return "", fmt.Errorf("failed to create Securitygroup: %+v, %+v", createSecuritygroupResponse.Message, e)
+	}
+	return strconv.FormatInt(createSecuritygroupResponse.Result.Id, 10), nil
+}
+
+func (c *apiClient) UpdateSecurityGroup(ctx context.Context, account Account, id, name, description string, tags map[string]string) error {
+	updateSecuritygroupsResponse, _, e := c.api.SecuritygroupApi.V2SecurityGroupsIdPut(ctx, id, &dcsapi.SecuritygroupApiV2SecurityGroupsIdPutOpts{
+		XAccountID: optional.NewString(account.AccountId),
+		XUserID:    optional.NewString(account.UserId),
+		Root:       &securitygroup.UpdateSecuritygroupRequest{Name: name, Description: MarkDescription(description), Tags: Tags(tags)}})
+	if updateSecuritygroupsResponse.Code != 200 {
+		return fmt.Errorf("failed to update Securitygroup %s: %+v, %+v", id, updateSecuritygroupsResponse.Message, e)
+	}
+	return nil
+}
+
+func (c *apiClient) DeleteSecurityGroup(ctx context.Context, account Account, id string) error {
+	deleteSecuritygroupResponse, _, e := c.api.SecuritygroupApi.V2SecurityGroupsIdDelete(ctx, id, &dcsapi.SecuritygroupApiV2SecurityGroupsIdDeleteOpts{
+		XAccountID: optional.NewString(account.AccountId),
+		XUserID:    optional.NewString(account.UserId)})
+	if deleteSecuritygroupResponse.Code != 200 {
+		return fmt.Errorf("failed to delete Securitygroup %s: %+v, %+v", id, deleteSecuritygroupResponse.Message, e)
+	}
+	return nil
+}
+
+func (c *apiClient) ReleaseSecurityGroup(ctx context.Context, account Account, id string) error {
+	sg, err := c.GetSecurityGroup(ctx, account, id)
+	if err != nil || sg == nil {
+		return err
+	}
+	updateSecuritygroupsResponse, _, e := c.api.SecuritygroupApi.V2SecurityGroupsIdPut(ctx, id, &dcsapi.SecuritygroupApiV2SecurityGroupsIdPutOpts{
+		XAccountID: optional.NewString(account.AccountId),
+		XUserID:    optional.NewString(account.UserId),
+		Root:       &securitygroup.UpdateSecuritygroupRequest{Name: sg.Name, Description: sg.Description, Tags: Tags(UserTags(sg.Tags))}})
+	if updateSecuritygroupsResponse.Code != 200 {
+		return fmt.Errorf("failed to release Securitygroup %s: %+v, %+v", id, updateSecuritygroupsResponse.Message, e)
+	}
+	return nil
+}
+
+func (c *apiClient) ListRules(ctx context.Context, account Account, id string) ([]rules.RemoteRule, error) {
+	listRulesResponse, _, e := c.api.SecuritygroupApi.V2SecurityGroupsIdRulesGet(ctx, id, &dcsapi.SecuritygroupApiV2SecurityGroupsIdRulesGetOpts{
+		XAccountID: optional.NewString(account.AccountId),
+		XUserID:    optional.NewString(account.UserId)})
+	if listRulesResponse.Code != 200 {
+		return nil, fmt.Errorf("failed to get Securitygroup rules: %+v, %+v", listRulesResponse.Message, e)
+	}
+	remote := make([]rules.RemoteRule, 0, len(listRulesResponse.Result.List))
+	for _, rr := range listRulesResponse.Result.List {
+		remote = append(remote, remoteRule(rr))
+	}
+	return remote, nil
+}
+
+func (c *apiClient) CreateRule(ctx context.Context, account Account, id string, rule rules.Rule) error {
+	if err := Supported(rule); err != nil {
+		return err
+	}
+	createRuleResponse, _, e := c.api.SecuritygroupApi.V2SecurityGroupsIdRulesPost(ctx, id, &dcsapi.SecuritygroupApiV2SecurityGroupsIdRulesPostOpts{
+		XAccountID: optional.NewString(account.AccountId),
+		XUserID:    optional.NewString(account.UserId),
+		Root:       ruleRequest(rule)})
+	if createRuleResponse.Code != 200 {
+		return fmt.Errorf("failed to create Securitygroup rule %s: %+v, %+v", rule, createRuleResponse.Message, e)
+	}
+	return nil
+}
+
+func (c *apiClient) DeleteRule(ctx context.Context, account Account, id, ruleId string) error {
+	deleteRuleResponse, _, e := c.api.SecuritygroupApi.V2SecurityGroupsIdRulesRuleIdDelete(ctx, id, ruleId, &dcsapi.SecuritygroupApiV2SecurityGroupsIdRulesRuleIdDeleteOpts{
+		XAccountID: optional.NewString(account.AccountId),
+		XUserID:    optional.NewString(account.UserId)})
+	if deleteRuleResponse.Code != 200 {
+		return fmt.Errorf("failed to delete Securitygroup rule %s: %+v, %+v", ruleId, deleteRuleResponse.Message, e)
+	}
+	return nil
+}
+
+func (c *apiClient) AttachInstance(ctx context.Context, account Account, id, instanceId string) error {
+	attachResponse, _, e := c.api.SecuritygroupApi.V2SecurityGroupsIdInstancesPost(ctx, id, &dcsapi.SecuritygroupApiV2SecurityGroupsIdInstancesPostOpts{
+		XAccountID: optional.NewString(account.AccountId),
+		XUserID:    optional.NewString(account.UserId),
+		Root:       &securitygroup.BindInstanceRequest{InstanceId: instanceId}})
+	if attachResponse.Code != 200 {
+		return fmt.Errorf("failed to attach Securitygroup %s to instance %s: %+v, %+v", id, instanceId, attachResponse.Message, e)
+	}
+	return nil
+}
+
+func (c *apiClient) DetachInstance(ctx context.Context, account Account, id, instanceId string) error {
+	detachResponse, _, e := c.api.SecuritygroupApi.V2SecurityGroupsIdInstancesInstanceIdDelete(ctx, id, instanceId, &dcsapi.SecuritygroupApiV2SecurityGroupsIdInstancesInstanceIdDeleteOpts{
+		XAccountID: optional.NewString(account.AccountId),
+		XUserID:    optional.NewString(account.UserId)})
+	if detachResponse.Code != 200 {
+		return fmt.Errorf("failed to detach Securitygroup %s from instance %s: %+v, %+v", id, instanceId, detachResponse.Message, e)
+	}
+	return nil
+}
+
+// Supported returns an error if the rule cannot be created with the DCS rule API, which
+// only has stateful allow rules without priority.
+func Supported(rule rules.Rule) error {
+	switch {
+	case rule.Deny():
+		return fmt.Errorf("rule %s: DCS does not support deny rules", rule)
+	case rule.Priority != 0:
+		return fmt.Errorf("rule %s: DCS does not support rule priorities", rule)
+	case rule.Stateless:
+		return fmt.Errorf("rule %s: DCS does not support stateless rules", rule)
+	}
+	return nil
+}
+
+// remoteRule converts a DCS rule into its canonical form. Rules that cannot be parsed keep
+// their raw values, so they never match a desired rule and are deleted.
+func remoteRule(rr securitygroup.SecuritygroupRule) rules.RemoteRule {
+	id := strconv.FormatInt(rr.Id, 10)
+	// DCS 中没有远端地址的规则匹配其 ethertype 的所有地址，IPv6 规则的 icmp 即 icmpv6
+	cidr, protocol := rr.RemoteIpPrefix, rr.Protocol
+	if cidr == "" {
+		cidr = rules.AnyCIDR(rr.Ethertype)
+	}
+	if rr.Ethertype == paasv1.EthertypeIPv6 && rules.CanonicalProtocol(protocol) == "icmp" {
+		protocol = "icmpv6"
+	}
+	rule, err := rules.New(rr.Direction, protocol, rr.PortRangeMin, rr.PortRangeMax, cidr, rr.Description)
+	if err != nil {
+		rule = rules.Rule{
+			Direction:   rr.Direction,
+			Protocol:    rr.Protocol,
+			PortMin:     rr.PortRangeMin,
+			PortMax:     rr.PortRangeMax,
+			CIDR:        rr.RemoteIpPrefix,
+			Description: rr.Description,
+		}
+	}
+	return rules.RemoteRule{Rule: rule, Id: id}
+}
+
+// ruleRequest converts a canonical rule into a DCS rule creation request.
+func ruleRequest(rule rules.Rule) *securitygroup.CreateSecuritygroupRuleRequest {
+	return &securitygroup.CreateSecuritygroupRuleRequest{
+		Direction:      rule.Direction,
+		Ethertype:      rule.Ethertype(),
+		Protocol:       rule.Protocol,
+		PortRangeMin:   rule.PortMin,
+		PortRangeMax:   rule.PortMax,
+		RemoteIpPrefix: rule.CIDR,
+		Description:    rule.Description,
+	}
+}
@@ -0,0 +1,222 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dcs
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"paas.unicom.cn/dcs-sdk/dcsapi/model/securitygroup"
+
+	"security-group/rules"
+)
+
+func TestRemoteRule(t *testing.T) {
+	tests := []struct {
+		name string
+		rule securitygroup.SecuritygroupRule
+		want string
+	}{
+		{
+			name: "ipv4",
+			rule: securitygroup.SecuritygroupRule{Id: 1, Direction: "ingress", Ethertype: "IPv4", Protocol: "tcp", PortRangeMin: 22, PortRangeMax: 22, RemoteIpPrefix: "10.0.0.0/8"},
+			want: "ingress/tcp/22-22/10.0.0.0/8",
+		},
+		{
+			name: "any ipv6 address",
+			rule: securitygroup.SecuritygroupRule{Id: 2, Direction: "ingress", Ethertype: "IPv6", Protocol: "tcp", PortRangeMin: 443, PortRangeMax: 443},
+			want: "ingress/tcp/443-443/::/0",
+		},
+		{
+			name: "icmp of ipv6 rule",
+			rule: securitygroup.SecuritygroupRule{Id: 3, Direction: "ingress", Ethertype: "IPv6", Protocol: "icmp", RemoteIpPrefix: "fd00::/8"},
+			want: "ingress/icmpv6/0-0/fd00::/8",
+		},
+		{
+			name: "invalid rule keeps raw values",
+			rule: securitygroup.SecuritygroupRule{Id: 4, Direction: "inbound", Protocol: "tcp", RemoteIpPrefix: "10.0.0.0/8"},
+			want: "inbound/tcp/0-0/10.0.0.0/8",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := remoteRule(tt.rule)
+			if got.Key() != tt.want {
+				t.Errorf("remoteRule() = %s, want %s", got.Key(), tt.want)
+			}
+		})
+	}
+}
+
+func TestRuleRequest(t *testing.T) {
+	r, err := rules.New("egress", "udp", 53, 53, "fd00::53", "dns")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &securitygroup.CreateSecuritygroupRuleRequest{
+		Direction: "egress", Ethertype: "IPv6", Protocol: "udp", PortRangeMin: 53, PortRangeMax: 53, RemoteIpPrefix: "fd00::53/128", Description: "dns",
+	}
+	if got := ruleRequest(r); !reflect.DeepEqual(got, want) {
+		t.Errorf("ruleRequest() = %+v, want %+v", got, want)
+	}
+	created := securitygroup.SecuritygroupRule{
+		Id: 5, Direction: want.Direction, Ethertype: want.Ethertype, Protocol: want.Protocol,
+		PortRangeMin: want.PortRangeMin, PortRangeMax: want.PortRangeMax, RemoteIpPrefix: want.RemoteIpPrefix,
+	}
+	if got := remoteRule(created); got.Key() != r.Key() {
+		t.Errorf("remoteRule(ruleRequest()) = %s, want %s", got.Key(), r.Key())
+	}
+
+	r.Priority = 10
+	if err := Supported(r); err == nil {
+		t.Errorf("Supported() should fail for a rule with priority")
+	}
+}
+
+func TestChanges(t *testing.T) {
+	g := &SecurityGroup{Id: "1", Name: "web", Description: "web servers", Tags: map[string]string{"team": "a", "env": "prod"}}
+	if diffs := g.Changes("web", "web servers", map[string]string{"env": "prod", "team": "a"}); diffs != nil {
+		t.Errorf("Changes() = %v, want none", diffs)
+	}
+	want := []string{`name "web" -> "web-prod"`, `description "web servers" -> ""`,
+		`tag cost "1" added`, `tag env "prod" removed`, `tag team "a" -> "b"`}
+	if diffs := g.Changes("web-prod", "", map[string]string{"team": "b", "cost": "1"}); !reflect.DeepEqual(diffs, want) {
+		t.Errorf("Changes() = %v, want %v", diffs, want)
+	}
+}
+
+// fakeClient serves security groups and their rules from memory.
+type fakeClient struct {
+	groups []SecurityGroup
+	rules  map[string][]rules.RemoteRule
+}
+
+func (c *fakeClient) GetSecurityGroup(ctx context.Context, account Account, id string) (*SecurityGroup, error) {
+	for i := range c.groups {
+		if c.groups[i].Id == id {
+			return &c.groups[i], nil
+		}
+	}
+	return nil, nil
+}
+
+func (c *fakeClient) ListSecurityGroups(ctx context.Context, account Account) ([]SecurityGroup, error) {
+	return c.groups, nil
+}
+
+func (c *fakeClient) CreateSecurityGroup(ctx context.Context, account Account, name, description string, tags map[string]string) (string, error) {
+	return "", nil
+}
+
+func (c *fakeClient) UpdateSecurityGroup(ctx context.Context, account Account, id, name, description string, tags map[string]string) error {
+	return nil
+}
+
+func (c *fakeClient) DeleteSecurityGroup(ctx context.Context, account Account, id string) error {
+	return nil
+}
+
+func (c *fakeClient) ReleaseSecurityGroup(ctx context.Context, account Account, id string) error {
+	return nil
+}
+
+func (c *fakeClient) ListRules(ctx context.Context, account Account, id string) ([]rules.RemoteRule, error) {
+	return c.rules[id], nil
+}
+
+func (c *fakeClient) CreateRule(ctx context.Context, account Account, id string, rule rules.Rule) error {
+	return nil
+}
+
+func (c *fakeClient) DeleteRule(ctx context.Context, account Account, id, ruleId string) error {
+	return nil
+}
+
+func (c *fakeClient) AttachInstance(ctx context.Context, account Account, id, instanceId string) error {
+	return nil
+}
+
+func (c *fakeClient) DetachInstance(ctx context.Context, account Account, id, instanceId string) error {
+	return nil
+}
+
+func TestExport(t *testing.T) {
+	c := &fakeClient{
+		groups: []SecurityGroup{
+			{Id: "1", Name: "Web Servers", Description: "web", Tags: map[string]string{"team": "a", TagUID: "1234"}},
+			{Id: "2", Name: "web_servers"},
+			{Id: "3", Name: "数据库"},
+		},
+		rules: map[string][]rules.RemoteRule{
+			"1": {
+				remoteRule(securitygroup.SecuritygroupRule{Id: 11, Direction: "ingress", Ethertype: "IPv4", Protocol: "tcp", PortRangeMin: 443, PortRangeMax: 443}),
+				remoteRule(securitygroup.SecuritygroupRule{Id: 12, Direction: "ingress", Ethertype: "IPv4", Protocol: "tcp", PortRangeMin: 22, PortRangeMax: 22, RemoteIpPrefix: "10.0.0.0/8"}),
+				remoteRule(securitygroup.SecuritygroupRule{Id: 13, Direction: "ingress", Ethertype: "IPv4", Protocol: "tcp", PortRangeMin: 22, PortRangeMax: 22, RemoteIpPrefix: "10.0.0.0/8"}),
+				remoteRule(securitygroup.SecuritygroupRule{Id: 14, Direction: "inbound", Protocol: "tcp", RemoteIpPrefix: "10.0.0.0/8"}),
+			},
+		},
+	}
+	exported, err := Export(context.Background(), c, Account{AccountId: "a", UserId: "u"}, "tenant")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range exported {
+		names = append(names, e.SecurityGroup.Name)
+	}
+	if want := []string{"web-servers", "web-servers-2", "sg-3"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("names = %v, want %v", names, want)
+	}
+
+	web := exported[0]
+	if web.SecurityGroup.Namespace != "tenant" || web.SecurityGroup.Annotations[AdoptAnnotation] != "1" {
+		t.Errorf("metadata = %+v", web.SecurityGroup.ObjectMeta)
+	}
+	if web.SecurityGroup.Spec.Name != "Web Servers" || web.SecurityGroup.Spec.Description != "web" || web.SecurityGroup.Spec.AccountId != "a" ||
+		!reflect.DeepEqual(web.SecurityGroup.Spec.Tags, map[string]string{"team": "a"}) {
+		t.Errorf("spec = %+v", web.SecurityGroup.Spec)
+	}
+	var got []string
+	for _, r := range web.SecurityGroup.Spec.Rules {
+		got = append(got, r.String())
+	}
+	if want := []string{"ingress tcp 22 10.0.0.0/8", "ingress tcp 443 0.0.0.0/0"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("rules = %v, want %v", got, want)
+	}
+	if len(web.Skipped) != 2 {
+		t.Errorf("skipped = %v, want the duplicate and the invalid rule", web.Skipped)
+	}
+	if manage := web.SecurityGroup.Spec.ManageRules; manage == nil || *manage {
+		t.Errorf("manageRules = %v, want false to keep the invalid rule", manage)
+	}
+	if len(exported[1].SecurityGroup.Spec.Rules) != 0 || len(exported[1].Skipped) != 0 || exported[1].SecurityGroup.Spec.ManageRules != nil {
+		t.Errorf("group without rules = %+v", exported[1])
+	}
+}
+
+func TestParseDescription(t *testing.T) {
+	for _, description := range []string{"", "web servers"} {
+		got, owned := ParseDescription(MarkDescription(description))
+		if got != description || !owned {
+			t.Errorf("ParseDescription(MarkDescription(%q)) = %q, %v", description, got, owned)
+		}
+		if got, owned := ParseDescription(description); got != description || owned {
+			t.Errorf("ParseDescription(%q) = %q, %v", description, got, owned)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dcs
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	paasv1 "security-group/api/v1"
+	"security-group/rules"
+)
+
+// Exported is a security group of DCS converted into a SecurityGroup that adopts it.
+type Exported struct {
+	SecurityGroup paasv1.SecurityGroup
+	// Skipped are the rules of the security group that are not valid rules of a
+	// SecurityGroup or duplicate another rule. The SecurityGroup does not manage its
+	// rules if any rule is invalid, so that the controller does not delete them.
+	Skipped []string
+}
+
+// invalidNameChars are the characters that cannot be used in the names of resources.
+var invalidNameChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// Export converts all security groups of the account into SecurityGroups of the namespace,
+// with their rules and the annotation that makes them adopt the security group. The names
+// of the SecurityGroups are derived from the names in DCS, and made unique with the id of
+// the security group if needed.
+func Export(ctx context.Context, c Client, account Account, namespace string) ([]Exported, error) {
+	groups, err := c.ListSecurityGroups(ctx, account)
+	if err != nil {
+		return nil, err
+	}
+	return ExportGroups(ctx, c, account, namespace, groups)
+}
+
+// ExportGroups converts the security groups of the account like Export.
+func ExportGroups(ctx context.Context, c Client, account Account, namespace string, groups []SecurityGroup) ([]Exported, error) {
+	exported := make([]Exported, 0, len(groups))
+	used := map[string]bool{}
+	for _, g := range groups {
+		remote, err := c.ListRules(ctx, account, g.Id)
+		if err != nil {
+			return nil, fmt.Errorf("security group %s: %v", g.Id, err)
+		}
+		e := Exported{SecurityGroup: paasv1.SecurityGroup{
+			TypeMeta: metav1.TypeMeta{APIVersion: paasv1.GroupVersion.String(), Kind: "SecurityGroup"},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        resourceName(g, used),
+				Namespace:   namespace,
+				Annotations: map[string]string{AdoptAnnotation: g.Id},
+			},
+			Spec: paasv1.SecurityGroupSpec{
+				AccountId:   account.AccountId,
+				UserId:      account.UserId,
+				Name:        g.Name,
+				Description: g.Description,
+				Tags:        UserTags(g.Tags),
+			},
+		}}
+		desired := make([]rules.Rule, 0, len(remote))
+		seen := map[string]bool{}
+		manage := false
+		for _, rr := range remote {
+			if _, err := rules.Parse(rr.Spec()); err != nil {
+				e.Skipped = append(e.Skipped, fmt.Sprintf("%s (%s): %v", rr.Rule, rr.Id, err))
+				e.SecurityGroup.Spec.ManageRules = &manage
+				continue
+			}
+			if seen[rr.Key()] {
+				e.Skipped = append(e.Skipped, fmt.Sprintf("%s (%s): duplicate", rr.Rule, rr.Id))
+				continue
+			}
+			seen[rr.Key()] = true
+			desired = append(desired, rr.Rule)
+		}
+		rules.Sort(desired)
+		for _, r := range desired {
+			e.SecurityGroup.Spec.Rules = append(e.SecurityGroup.Spec.Rules, r.Spec())
+		}
+		exported = append(exported, e)
+	}
+	return exported, nil
+}
+
+// resourceName returns a name for the SecurityGroup of the security group that is not used yet.
+func resourceName(g SecurityGroup, used map[string]bool) string {
+	name := strings.Trim(invalidNameChars.ReplaceAllString(strings.ToLower(g.Name), "-"), "-")
+	if len(name) > 200 {
+		name = strings.TrimRight(name[:200], "-")
+	}
+	switch {
+	case name == "":
+		name = "sg-" + g.Id
+	case used[name]:
+		name = name + "-" + g.Id
+	}
+	used[name] = true
+	return name
+}
@@ -0,0 +1,199 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package fake is an in-memory dcs.Client for tests.
+package fake
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"security-group/dcs"
+	"security-group/rules"
+)
+
+// Client serves security groups and their rules from memory and records the calls that
+// change them. Err, if set, is returned by every call.
+type Client struct {
+	Groups []dcs.SecurityGroup
+	Rules  map[string][]rules.RemoteRule
+	Err    error
+	// Calls are the changing calls made, e.g. "delete-rule 1 11".
+	Calls []string
+	// ListRulesCalls counts the calls of ListRules.
+	ListRulesCalls int
+
+	created int
+}
+
+var _ dcs.Client = &Client{}
+
+// GetSecurityGroup returns the security group with the id, or nil if it does not exist.
+func (c *Client) GetSecurityGroup(ctx context.Context, account dcs.Account, id string) (*dcs.SecurityGroup, error) {
+	if c.Err != nil {
+		return nil, c.Err
+	}
+	for i := range c.Groups {
+		if c.Groups[i].Id == id {
+			g := c.Groups[i]
+			return &g, nil
+		}
+	}
+	return nil, nil
+}
+
+// ListSecurityGroups returns all security groups.
+func (c *Client) ListSecurityGroups(ctx context.Context, account dcs.Account) ([]dcs.SecurityGroup, error) {
+	if c.Err != nil {
+		return nil, c.Err
+	}
+	return append([]dcs.SecurityGroup{}, c.Groups...), nil
+}
+
+// CreateSecurityGroup adds an owned security group with a new id.
+func (c *Client) CreateSecurityGroup(ctx context.Context, account dcs.Account, name, description string, tags map[string]string) (string, error) {
+	if c.Err != nil {
+		return "", c.Err
+	}
+	c.created++
+	id := "new-" + strconv.Itoa(c.created)
+	c.Calls = append(c.Calls, "create "+name)
+	c.Groups = append(c.Groups, dcs.SecurityGroup{Id: id, Name: name, Description: description, Owned: true, Tags: copyTags(tags)})
+	return id, nil
+}
+
+// UpdateSecurityGroup sets the name, description and tags of the security group and marks
+// it owned.
+func (c *Client) UpdateSecurityGroup(ctx context.Context, account dcs.Account, id, name, description string, tags map[string]string) error {
+	if c.Err != nil {
+		return c.Err
+	}
+	c.Calls = append(c.Calls, "update "+id)
+	for i := range c.Groups {
+		if c.Groups[i].Id == id {
+			c.Groups[i].Name = name
+			c.Groups[i].Description = description
+			c.Groups[i].Owned = true
+			c.Groups[i].Tags = copyTags(tags)
+		}
+	}
+	return nil
+}
+
+// DeleteSecurityGroup deletes the security group and its rules.
+func (c *Client) DeleteSecurityGroup(ctx context.Context, account dcs.Account, id string) error {
+	if c.Err != nil {
+		return c.Err
+	}
+	c.Calls = append(c.Calls, "delete "+id)
+	for i := range c.Groups {
+		if c.Groups[i].Id == id {
+			c.Groups = append(c.Groups[:i], c.Groups[i+1:]...)
+			break
+		}
+	}
+	delete(c.Rules, id)
+	return nil
+}
+
+// ReleaseSecurityGroup removes the owner marker and the tags of the controller.
+func (c *Client) ReleaseSecurityGroup(ctx context.Context, account dcs.Account, id string) error {
+	if c.Err != nil {
+		return c.Err
+	}
+	c.Calls = append(c.Calls, "release "+id)
+	for i := range c.Groups {
+		if c.Groups[i].Id == id {
+			c.Groups[i].Owned = false
+			tags := map[string]string{}
+			for key, value := range c.Groups[i].Tags {
+				if !strings.HasPrefix(key, dcs.TagPrefix) {
+					tags[key] = value
+				}
+			}
+			c.Groups[i].Tags = tags
+		}
+	}
+	return nil
+}
+
+// ListRules returns the rules of the security group.
+func (c *Client) ListRules(ctx context.Context, account dcs.Account, id string) ([]rules.RemoteRule, error) {
+	c.ListRulesCalls++
+	if c.Err != nil {
+		return nil, c.Err
+	}
+	return append([]rules.RemoteRule{}, c.Rules[id]...), nil
+}
+
+// CreateRule adds the rule to the security group with a new id.
+func (c *Client) CreateRule(ctx context.Context, account dcs.Account, id string, rule rules.Rule) error {
+	if c.Err != nil {
+		return c.Err
+	}
+	if c.Rules == nil {
+		c.Rules = map[string][]rules.RemoteRule{}
+	}
+	c.created++
+	ruleId := "new-" + strconv.Itoa(c.created)
+	c.Calls = append(c.Calls, fmt.Sprintf("create-rule %s %s", id, rule))
+	c.Rules[id] = append(c.Rules[id], rules.RemoteRule{Rule: rule, Id: ruleId})
+	return nil
+}
+
+// DeleteRule removes the rule with the rule id from the security group.
+func (c *Client) DeleteRule(ctx context.Context, account dcs.Account, id, ruleId string) error {
+	if c.Err != nil {
+		return c.Err
+	}
+	c.Calls = append(c.Calls, fmt.Sprintf("delete-rule %s %s", id, ruleId))
+	remote := c.Rules[id]
+	for i := range remote {
+		if remote[i].Id == ruleId {
+			c.Rules[id] = append(remote[:i], remote[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// AttachInstance records the attachment.
+func (c *Client) AttachInstance(ctx context.Context, account dcs.Account, id, instanceId string) error {
+	if c.Err != nil {
+		return c.Err
+	}
+	c.Calls = append(c.Calls, fmt.Sprintf("attach %s %s", id, instanceId))
+	return nil
+}
+
+// DetachInstance records the detachment.
+func (c *Client) DetachInstance(ctx context.Context, account dcs.Account, id, instanceId string) error {
+	if c.Err != nil {
+		return c.Err
+	}
+	c.Calls = append(c.Calls, fmt.Sprintf("detach %s %s", id, instanceId))
+	return nil
+}
+
+func copyTags(tags map[string]string) map[string]string {
+	copied := make(map[string]string, len(tags))
+	for key, value := range tags {
+		copied[key] = value
+	}
+	return copied
+}
@@ -0,0 +1,181 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dcs
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"paas.unicom.cn/dcs-sdk/dcsapi/model/securitygroup"
+
+	paasv1 "security-group/api/v1"
+)
+
+// Keys of the tags the controller adds to the security groups it manages.
+const (
+	// TagPrefix starts the keys of the tags the controller adds, and cannot be used in the
+	// tags of a SecurityGroup.
+	TagPrefix string = "paas.unicom.cn/"
+
+	TagCluster   string = TagPrefix + "cluster"
+	TagNamespace string = TagPrefix + "namespace"
+	TagName      string = TagPrefix + "name"
+	TagUID       string = TagPrefix + "uid"
+)
+
+// ValidateTags returns an error if the tags of a SecurityGroup use a key of the controller.
+func ValidateTags(tags map[string]string) error {
+	for key := range tags {
+		if strings.HasPrefix(key, TagPrefix) {
+			return fmt.Errorf("tag %q: keys starting with %q are set by the controller", key, TagPrefix)
+		}
+	}
+	return nil
+}
+
+// DesiredTags returns the tags of the SecurityGroup and the tags that identify it, which
+// include the name of the cluster unless it is empty.
+func DesiredTags(cluster string, sg *paasv1.SecurityGroup) map[string]string {
+	tags := map[string]string{}
+	for key, value := range sg.Spec.Tags {
+		tags[key] = value
+	}
+	if cluster != "" {
+		tags[TagCluster] = cluster
+	}
+	tags[TagNamespace] = sg.Namespace
+	tags[TagName] = sg.Name
+	tags[TagUID] = string(sg.UID)
+	return tags
+}
+
+// ExpectedTags returns the tags the security group in DCS should have. Security groups the
+// controller updates have the desired tags, the others keep the tags of the controller they
+// have, if any, and are only expected to have the tags of the SecurityGroup.
+func ExpectedTags(cluster string, sg *paasv1.SecurityGroup, current map[string]string, updated bool) map[string]string {
+	if updated {
+		return DesiredTags(cluster, sg)
+	}
+	tags := map[string]string{}
+	for key, value := range current {
+		if strings.HasPrefix(key, TagPrefix) {
+			tags[key] = value
+		}
+	}
+	for key, value := range sg.Spec.Tags {
+		tags[key] = value
+	}
+	return tags
+}
+
+// OwnedBy reports whether the controller of the cluster created or manages the security
+// group. When the cluster has a name, only security groups tagged with it are owned, as
+// clusters sharing a DCS account cannot tell their untagged security groups apart. Without
+// a name, security groups of no cluster are owned if they have the UID tag or the owner
+// marker in their description.
+func (g *SecurityGroup) OwnedBy(cluster string) bool {
+	c, tagged := g.Tags[TagCluster]
+	if cluster != "" {
+		return tagged && c == cluster
+	}
+	if tagged {
+		return false
+	}
+	if _, ok := g.Tags[TagUID]; ok {
+		return true
+	}
+	return g.Owned
+}
+
+// Owner returns the namespace, name and UID of the SecurityGroup the tags identify, or
+// false if the security group has none.
+func (g *SecurityGroup) Owner() (namespace, name, uid string, ok bool) {
+	uid, ok = g.Tags[TagUID]
+	return g.Tags[TagNamespace], g.Tags[TagName], uid, ok
+}
+
+// UserTags returns the tags without the tags of the controller.
+func UserTags(tags map[string]string) map[string]string {
+	var user map[string]string
+	for key, value := range tags {
+		if strings.HasPrefix(key, TagPrefix) {
+			continue
+		}
+		if user == nil {
+			user = map[string]string{}
+		}
+		user[key] = value
+	}
+	return user
+}
+
+// TagMap converts DCS tags into a map.
+func TagMap(tags []securitygroup.Tag) map[string]string {
+	if len(tags) == 0 {
+		return nil
+	}
+	m := make(map[string]string, len(tags))
+	for _, t := range tags {
+		m[t.Key] = t.Value
+	}
+	return m
+}
+
+// Tags converts a map into DCS tags, sorted by key.
+func Tags(m map[string]string) []securitygroup.Tag {
+	tags := make([]securitygroup.Tag, 0, len(m))
+	for key, value := range m {
+		tags = append(tags, securitygroup.Tag{Key: key, Value: value})
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Key < tags[j].Key })
+	return tags
+}
+
+// tagChanges describes how the tags differ from the desired tags, e.g. `tag team "a" -> "b"`.
+func tagChanges(current, desired map[string]string) []string {
+	var diffs []string
+	for _, key := range sortedKeys(current, desired) {
+		have, had := current[key]
+		want, wanted := desired[key]
+		switch {
+		case !had:
+			diffs = append(diffs, fmt.Sprintf("tag %s %q added", key, want))
+		case !wanted:
+			diffs = append(diffs, fmt.Sprintf("tag %s %q removed", key, have))
+		case have != want:
+			diffs = append(diffs, fmt.Sprintf("tag %s %q -> %q", key, have, want))
+		}
+	}
+	return diffs
+}
+
+// sortedKeys returns the keys of the maps, sorted.
+func sortedKeys(maps ...map[string]string) []string {
+	seen := map[string]bool{}
+	var keys []string
+	for _, m := range maps {
+		for key := range m {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
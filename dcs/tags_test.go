@@ -0,0 +1,81 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dcs
+
+import (
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	paasv1 "security-group/api/v1"
+)
+
+func TestValidateTags(t *testing.T) {
+	if err := ValidateTags(map[string]string{"team": "a"}); err != nil {
+		t.Errorf("ValidateTags() = %v", err)
+	}
+	if err := ValidateTags(map[string]string{TagCluster: "other"}); err == nil {
+		t.Error("ValidateTags() of a tag of the controller succeeded")
+	}
+}
+
+func TestExpectedTags(t *testing.T) {
+	sg := &paasv1.SecurityGroup{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "tenant", Name: "web", UID: "1234"},
+		Spec:       paasv1.SecurityGroupSpec{Tags: map[string]string{"team": "a"}},
+	}
+	current := map[string]string{TagCluster: "old", "team": "b", "owner": "ops"}
+
+	want := map[string]string{"team": "a", TagCluster: "prod", TagNamespace: "tenant", TagName: "web", TagUID: "1234"}
+	if got := ExpectedTags("prod", sg, current, true); !reflect.DeepEqual(got, want) {
+		t.Errorf("ExpectedTags() of an updated group = %v, want %v", got, want)
+	}
+	want = map[string]string{"team": "a", TagCluster: "old"}
+	if got := ExpectedTags("prod", sg, current, false); !reflect.DeepEqual(got, want) {
+		t.Errorf("ExpectedTags() of an observed group = %v, want %v", got, want)
+	}
+	if got := DesiredTags("", sg); got[TagCluster] != "" {
+		t.Errorf("DesiredTags() without cluster name = %v", got)
+	}
+}
+
+func TestOwnedBy(t *testing.T) {
+	tests := []struct {
+		name    string
+		cluster string
+		group   SecurityGroup
+		want    bool
+	}{
+		{name: "cluster tag", cluster: "prod", group: SecurityGroup{Tags: map[string]string{TagCluster: "prod", TagUID: "1"}}, want: true},
+		{name: "other cluster", cluster: "prod", group: SecurityGroup{Tags: map[string]string{TagCluster: "test", TagUID: "1"}, Owned: true}},
+		{name: "uid tag without cluster", cluster: "prod", group: SecurityGroup{Tags: map[string]string{TagUID: "1"}}},
+		{name: "owner marker without cluster", cluster: "prod", group: SecurityGroup{Owned: true}},
+		{name: "unmanaged", cluster: "prod", group: SecurityGroup{Tags: map[string]string{"team": "a"}}},
+		{name: "unnamed cluster, uid tag", group: SecurityGroup{Tags: map[string]string{TagUID: "1"}}, want: true},
+		{name: "unnamed cluster, owner marker", group: SecurityGroup{Owned: true}, want: true},
+		{name: "unnamed cluster, named cluster tag", group: SecurityGroup{Tags: map[string]string{TagCluster: "prod", TagUID: "1"}, Owned: true}},
+		{name: "unnamed cluster, unmanaged", group: SecurityGroup{Tags: map[string]string{"team": "a"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.group.OwnedBy(tt.cluster); got != tt.want {
+				t.Errorf("OwnedBy(%q) = %v, want %v", tt.cluster, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package lint analyzes the rules of a SecurityGroup for rules that have no effect because
+// other rules already decide their traffic, and for rules that open too much.
+package lint
+
+import (
+	"fmt"
+	"net"
+
+	paasv1 "security-group/api/v1"
+	"security-group/rules"
+)
+
+// Finding types.
+const (
+	// TypeRedundant is a rule whose traffic another rule already handles the same way.
+	TypeRedundant string = "Redundant"
+	// TypeShadowed is a rule whose traffic a rule evaluated before it handles the other way,
+	// so the rule never applies.
+	TypeShadowed string = "Shadowed"
+	// TypePermissive is an ingress rule that allows too much from too many addresses.
+	TypePermissive string = "Permissive"
+)
+
+// sensitivePorts are ports that should not be open to any address, by name.
+var sensitivePorts = []struct {
+	name string
+	port int32
+}{
+	{"ssh", 22},
+	{"telnet", 23},
+	{"rdp", 3389},
+	{"mysql", 3306},
+	{"postgres", 5432},
+	{"redis", 6379},
+	{"mongodb", 27017},
+	{"etcd", 2379},
+}
+
+// Finding is a problem with a rule.
+type Finding struct {
+	Type    string
+	Rule    rules.Rule
+	Message string
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%s: %s", f.Type, f.Message)
+}
+
+// Analyze returns the findings for the rules of a SecurityGroup, in the order of the rules.
+// Address groups and services must be expanded first. The rules are not normalized, since
+// normalizing removes redundant rules.
+func Analyze(specRules []paasv1.SecurityGroupRule) ([]Finding, error) {
+	parsed := make([]rules.Rule, 0, len(specRules))
+	for i, sr := range specRules {
+		r, err := rules.Parse(sr)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %v", i, err)
+		}
+		parsed = append(parsed, r)
+	}
+
+	var findings []Finding
+	for i, r := range parsed {
+		if f, ok := covered(i, parsed); ok {
+			findings = append(findings, f)
+			continue
+		}
+		if f, ok := permissive(r); ok {
+			findings = append(findings, f)
+		}
+	}
+	return findings, nil
+}
+
+// covered returns a finding if another rule decides all traffic of rule i before it. Of
+// two rules that match the same traffic in the same order, the later one is reported.
+// If several rules cover rule i, the one evaluated first is reported.
+func covered(i int, parsed []rules.Rule) (Finding, bool) {
+	r := parsed[i]
+	by := -1
+	for j, o := range parsed {
+		if i == j || !o.Matches(r) {
+			continue
+		}
+		if !o.Before(r) && (r.Before(o) || (j > i && r.Matches(o))) {
+			continue
+		}
+		if by < 0 || o.Before(parsed[by]) {
+			by = j
+		}
+	}
+	if by < 0 {
+		return Finding{}, false
+	}
+	o := parsed[by]
+	if o.Deny() == r.Deny() {
+		return Finding{Type: TypeRedundant, Rule: r, Message: fmt.Sprintf("rule %s is redundant, rule %s already %s all of its traffic", r, o, verb(o))}, true
+	}
+	return Finding{Type: TypeShadowed, Rule: r, Message: fmt.Sprintf("rule %s never applies, rule %s is evaluated before it and %s all of its traffic", r, o, verb(o))}, true
+}
+
+// permissive returns a finding if the rule allows ingress of any protocol, of all ports or
+// of a sensitive port from any address or a network nearly as large.
+func permissive(r rules.Rule) (Finding, bool) {
+	if r.Deny() || r.Direction != paasv1.DirectionIngress || !broad(r.Network()) {
+		return Finding{}, false
+	}
+	switch {
+	case r.Protocol == "":
+		return Finding{Type: TypePermissive, Rule: r, Message: fmt.Sprintf("rule %s allows any protocol from %s", r, r.CIDR)}, true
+	case r.PortMin == 0 && r.PortMax == 0 && (r.Protocol == "tcp" || r.Protocol == "udp" || r.Protocol == "sctp"):
+		return Finding{Type: TypePermissive, Rule: r, Message: fmt.Sprintf("rule %s allows all %s ports from %s", r, r.Protocol, r.CIDR)}, true
+	case r.Protocol == "tcp":
+		for _, p := range sensitivePorts {
+			if r.PortMin <= p.port && p.port <= r.PortMax {
+				return Finding{Type: TypePermissive, Rule: r, Message: fmt.Sprintf("rule %s allows %s (tcp %d) from %s", r, p.name, p.port, r.CIDR)}, true
+			}
+		}
+	}
+	return Finding{}, false
+}
+
+// broad reports whether the network is any address, or a network larger than a /8 for
+// IPv4 or a /16 for IPv6.
+func broad(n *net.IPNet) bool {
+	if n == nil {
+		return false
+	}
+	ones, bits := n.Mask.Size()
+	if bits == 128 {
+		return ones < 16
+	}
+	return ones < 8
+}
+
+func verb(r rules.Rule) string {
+	if r.Deny() {
+		return "denies"
+	}
+	return "allows"
+}
+
+// Status returns the findings in the format of the SecurityGroup status.
+func Status(findings []Finding) []paasv1.LintFinding {
+	if len(findings) == 0 {
+		return nil
+	}
+	status := make([]paasv1.LintFinding, 0, len(findings))
+	for _, f := range findings {
+		status = append(status, paasv1.LintFinding{Type: f.Type, Rule: f.Rule.String(), Message: f.Message})
+	}
+	return status
+}
@@ -0,0 +1,119 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lint
+
+import (
+	"reflect"
+	"testing"
+
+	paasv1 "security-group/api/v1"
+)
+
+func TestAnalyze(t *testing.T) {
+	tcp := func(ports, cidr string) paasv1.SecurityGroupRule {
+		return paasv1.SecurityGroupRule{Direction: "ingress", Protocol: "tcp", Ports: ports, CIDR: cidr}
+	}
+
+	tests := []struct {
+		name  string
+		rules []paasv1.SecurityGroupRule
+		want  []string
+	}{
+		{
+			name:  "no findings",
+			rules: []paasv1.SecurityGroupRule{tcp("443", ""), tcp("22", "10.0.0.0/8"), {Direction: "egress"}},
+		},
+		{
+			name:  "duplicate",
+			rules: []paasv1.SecurityGroupRule{tcp("22", "10.0.0.0/8"), tcp("22", "10.1.2.3/8")},
+			want:  []string{"Redundant: rule ingress tcp 22 10.0.0.0/8 is redundant, rule ingress tcp 22 10.0.0.0/8 already allows all of its traffic"},
+		},
+		{
+			name:  "covered by broader rule",
+			rules: []paasv1.SecurityGroupRule{tcp("8080", "10.1.0.0/16"), tcp("8000-9000", "10.0.0.0/8")},
+			want:  []string{"Redundant: rule ingress tcp 8080 10.1.0.0/16 is redundant, rule ingress tcp 8000-9000 10.0.0.0/8 already allows all of its traffic"},
+		},
+		{
+			name: "allow shadowed by deny",
+			rules: []paasv1.SecurityGroupRule{
+				tcp("22", "10.1.0.0/16"),
+				{Direction: "ingress", Protocol: "tcp", Ports: "1-1024", CIDR: "10.0.0.0/8", Action: "deny", Priority: 10},
+			},
+			want: []string{"Shadowed: rule ingress tcp 22 10.1.0.0/16 never applies, rule ingress tcp 1-1024 10.0.0.0/8 deny priority 10 is evaluated before it and denies all of its traffic"},
+		},
+		{
+			name: "deny after broader allow",
+			rules: []paasv1.SecurityGroupRule{
+				{Direction: "ingress", Protocol: "tcp", Ports: "22", CIDR: "10.0.0.0/8", Priority: 5},
+				{Direction: "ingress", Protocol: "tcp", Ports: "22", CIDR: "10.1.0.0/16", Action: "deny", Priority: 10},
+			},
+			want: []string{"Shadowed: rule ingress tcp 22 10.1.0.0/16 deny priority 10 never applies, rule ingress tcp 22 10.0.0.0/8 priority 5 is evaluated before it and allows all of its traffic"},
+		},
+		{
+			name: "broader rule evaluated later",
+			rules: []paasv1.SecurityGroupRule{
+				{Direction: "ingress", Protocol: "tcp", Ports: "22", CIDR: "10.1.0.0/16", Priority: 5},
+				{Direction: "ingress", Protocol: "tcp", Ports: "22", CIDR: "10.0.0.0/8", Action: "deny", Priority: 10},
+			},
+		},
+		{
+			name: "reported against the rule evaluated first",
+			rules: []paasv1.SecurityGroupRule{
+				{Direction: "ingress", Protocol: "tcp", CIDR: "10.0.0.0/8"},
+				tcp("22", "10.1.0.0/16"),
+				{Direction: "ingress", Protocol: "tcp", Ports: "22", CIDR: "10.0.0.0/8", Action: "deny"},
+			},
+			want: []string{"Shadowed: rule ingress tcp 22 10.1.0.0/16 never applies, rule ingress tcp 22 10.0.0.0/8 deny is evaluated before it and denies all of its traffic"},
+		},
+		{
+			name:  "other family not covered",
+			rules: []paasv1.SecurityGroupRule{tcp("443", "::/0"), tcp("443", "10.0.0.0/8")},
+		},
+		{
+			name: "permissive",
+			rules: []paasv1.SecurityGroupRule{
+				{Direction: "ingress", CIDR: "128.0.0.0/2"},
+				{Direction: "ingress", Protocol: "udp", CIDR: "::/0"},
+				tcp("3000-3500", "0.0.0.0/4"),
+				tcp("22", "10.0.0.0/8"),
+				{Direction: "ingress", Protocol: "tcp", Ports: "22", Action: "deny"},
+			},
+			want: []string{
+				"Permissive: rule ingress any all 128.0.0.0/2 allows any protocol from 128.0.0.0/2",
+				"Permissive: rule ingress udp all ::/0 allows all udp ports from ::/0",
+				"Permissive: rule ingress tcp 3000-3500 0.0.0.0/4 allows rdp (tcp 3389) from 0.0.0.0/4",
+				"Shadowed: rule ingress tcp 22 10.0.0.0/8 never applies, rule ingress tcp 22 0.0.0.0/0 deny is evaluated before it and denies all of its traffic",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			findings, err := Analyze(tt.rules)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, f := range findings {
+				got = append(got, f.String())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Analyze() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
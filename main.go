@@ -17,17 +17,24 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	"k8s.io/apimachinery/pkg/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
 	paasv1 "security-group/api/v1"
 	"security-group/controllers"
+	"security-group/webhooks"
 	// +kubebuilder:scaffold:imports
 )
 
@@ -46,34 +53,170 @@ func init() {
 func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
+	var enableServiceRules bool
+	var reconcileMode string
+	var enableWebhooks bool
+	var approverGroups string
+	var controllerUsername string
+	var discoverAccounts string
+	var discoveryInterval time.Duration
+	var clusterName string
+	var gcMode string
+	var gcInterval time.Duration
+	var gcGracePeriod time.Duration
+	var gcReport string
+	var gcAccountList string
 	flag.StringVar(&metricsAddr, "metrics-addr", ":8080", "The address the metric endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "enable-leader-election", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.BoolVar(&enableServiceRules, "enable-service-rules", false,
+		"Open the node ports of NodePort and LoadBalancer Services annotated with "+
+			controllers.ServiceSecurityGroupAnnotation+" in the named SecurityGroup.")
+	flag.StringVar(&reconcileMode, "reconcile-mode", controllers.ReconcileModeApply,
+		"Either apply, or plan to only record the changes to DCS of every SecurityGroup without making them.")
+	flag.BoolVar(&enableWebhooks, "enable-webhooks", false,
+		"Serve the validating webhook that enforces SecurityGroupPolicies. "+
+			"Requires a serving certificate, see config/default.")
+	flag.StringVar(&approverGroups, "approver-groups", "",
+		"Comma-separated groups whose members may approve changes to SecurityGroups that require approval. "+
+			"Requires --enable-webhooks, without which the manager does not start if any SecurityGroup requires approval.")
+	flag.StringVar(&controllerUsername, "controller-username", "system:serviceaccount:security-group-system:default",
+		"User the controller runs as, the only user allowed to create SecurityGroupChangeRequests.")
+	flag.StringVar(&clusterName, "cluster-name", "",
+		"Name of the cluster, added as a tag to the security groups in DCS the controller manages. "+
+			"Must be unique among the clusters that manage the security groups of an account.")
+	flag.StringVar(&discoverAccounts, "discover-accounts", "",
+		"Comma-separated DCS accounts in the form accountId:userId:namespace whose security groups that no "+
+			"SecurityGroup manages are created as ObserveOnly SecurityGroups in the namespace.")
+	flag.DurationVar(&discoveryInterval, "discovery-interval", 10*time.Minute,
+		"How often the security groups of the --discover-accounts are listed.")
+	flag.StringVar(&gcMode, "gc-orphans", "",
+		"Find the security groups in DCS the controller created that no SecurityGroup has, and either "+
+			controllers.GCModeReport+" or "+controllers.GCModeDelete+" them. Off by default. "+
+			controllers.GCModeDelete+" requires --cluster-name.")
+	flag.StringVar(&gcAccountList, "gc-accounts", "",
+		"Comma-separated DCS accounts in the form accountId:userId that are searched for orphaned security groups "+
+			"in addition to the accounts of the SecurityGroups.")
+	flag.DurationVar(&gcInterval, "gc-interval", time.Hour, "How often orphaned security groups are searched for.")
+	flag.DurationVar(&gcGracePeriod, "gc-grace-period", 24*time.Hour,
+		"How long a security group must have been found orphaned before it is deleted.")
+	flag.StringVar(&gcReport, "gc-report", "security-group-system/security-group-gc-report",
+		"Namespace and name of the ConfigMap the report of the last garbage collection is written to.")
 	flag.Parse()
 
 	ctrl.SetLogger(zap.New(zap.UseDevMode(true)))
 
+	if reconcileMode != controllers.ReconcileModeApply && reconcileMode != controllers.ReconcileModePlan {
+		setupLog.Error(fmt.Errorf("invalid reconcile mode %q", reconcileMode), "unable to start manager")
+		os.Exit(1)
+	}
+
+	accounts, err := controllers.ParseDiscoveryAccounts(discoverAccounts)
+	if err != nil {
+		setupLog.Error(err, "unable to start manager")
+		os.Exit(1)
+	}
+	gcAccounts, err := controllers.ParseAccounts(gcAccountList)
+	if err != nil {
+		setupLog.Error(err, "unable to start manager")
+		os.Exit(1)
+	}
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme:             scheme,
 		MetricsBindAddress: metricsAddr,
 		Port:               9443,
 		LeaderElection:     enableLeaderElection,
 		LeaderElectionID:   "72e831f5.unicom.cn",
+		NewClient:          controllers.NewClient,
 	})
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
 		os.Exit(1)
 	}
 
+	// 不启用 webhook 时任何人都能批准变更，拒绝启动
+	if !enableWebhooks {
+		names, err := controllers.SecurityGroupsRequiringApproval(context.Background(), mgr.GetAPIReader())
+		if err != nil {
+			setupLog.Error(err, "unable to start manager")
+			os.Exit(1)
+		}
+		if len(names) > 0 {
+			setupLog.Error(fmt.Errorf("SecurityGroups %s require approval, which requires --enable-webhooks", strings.Join(names, ", ")), "unable to start manager")
+			os.Exit(1)
+		}
+	}
+
 	if err = (&controllers.SecurityGroupReconciler{
+		Client:        mgr.GetClient(),
+		Log:           ctrl.Log.WithName("controllers").WithName("SecurityGroup"),
+		Scheme:        mgr.GetScheme(),
+		Recorder:      mgr.GetEventRecorderFor("securitygroup-controller"),
+		ReconcileMode: reconcileMode,
+		ServiceRules:  enableServiceRules,
+		ClusterName:   clusterName,
+		Approvals:     enableWebhooks,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "SecurityGroup")
+		os.Exit(1)
+	}
+	if err = (&controllers.NodeSecurityGroupBindingReconciler{
 		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("SecurityGroup"),
+		Log:    ctrl.Log.WithName("controllers").WithName("NodeSecurityGroupBinding"),
 		Scheme: mgr.GetScheme(),
 	}).SetupWithManager(mgr); err != nil {
-		setupLog.Error(err, "unable to create controller", "controller", "SecurityGroup")
+		setupLog.Error(err, "unable to create controller", "controller", "NodeSecurityGroupBinding")
 		os.Exit(1)
 	}
+	if len(accounts) > 0 {
+		if err = (&controllers.SecurityGroupDiscovery{
+			Client:      mgr.GetClient(),
+			Log:         ctrl.Log.WithName("controllers").WithName("SecurityGroupDiscovery"),
+			Accounts:    accounts,
+			Interval:    discoveryInterval,
+			ClusterName: clusterName,
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "SecurityGroupDiscovery")
+			os.Exit(1)
+		}
+	}
+	if gcMode != "" {
+		report := strings.SplitN(gcReport, "/", 2)
+		if len(report) != 2 {
+			setupLog.Error(fmt.Errorf("invalid report ConfigMap %q, must be namespace/name", gcReport), "unable to start manager")
+			os.Exit(1)
+		}
+		if err = (&controllers.SecurityGroupCollector{
+			Client:      mgr.GetClient(),
+			Log:         ctrl.Log.WithName("controllers").WithName("SecurityGroupCollector"),
+			Mode:        gcMode,
+			Accounts:    gcAccounts,
+			Interval:    gcInterval,
+			GracePeriod: gcGracePeriod,
+			ClusterName: clusterName,
+			Report:      client.ObjectKey{Namespace: report[0], Name: report[1]},
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "SecurityGroupCollector")
+			os.Exit(1)
+		}
+	}
+	if enableWebhooks {
+		mgr.GetWebhookServer().Register(webhooks.SecurityGroupValidatorPath, &webhook.Admission{Handler: &webhooks.SecurityGroupValidator{
+			Client: mgr.GetClient(),
+			Log:    ctrl.Log.WithName("webhooks").WithName("SecurityGroup"),
+		}})
+		mgr.GetWebhookServer().Register(webhooks.SecurityGroupAnnotatorPath, &webhook.Admission{Handler: &webhooks.SecurityGroupAnnotator{}})
+		var groups []string
+		if approverGroups != "" {
+			groups = strings.Split(approverGroups, ",")
+		}
+		mgr.GetWebhookServer().Register(webhooks.SecurityGroupChangeRequestValidatorPath, &webhook.Admission{Handler: &webhooks.SecurityGroupChangeRequestValidator{
+			ApproverGroups:     groups,
+			ControllerUsername: controllerUsername,
+		}})
+	}
 	// +kubebuilder:scaffold:builder
 
 	setupLog.Info("starting manager")
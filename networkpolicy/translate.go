@@ -0,0 +1,219 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package networkpolicy translates Kubernetes NetworkPolicies into SecurityGroup rules
+// for VM-based workloads that are integrated with the cluster.
+package networkpolicy
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	paasv1 "security-group/api/v1"
+)
+
+// Unsupported describes a construct of a NetworkPolicy that cannot be expressed as
+// security group rules. The traffic it would allow is not allowed by the translated rules.
+type Unsupported struct {
+	// Path of the construct in the NetworkPolicy, e.g. "spec.ingress[0].from[1].podSelector".
+	Path string
+	// Reason the construct is not supported.
+	Reason string
+}
+
+func (u Unsupported) String() string {
+	return fmt.Sprintf("%s: %s", u.Path, u.Reason)
+}
+
+// Translate converts the ipBlock peers and numeric ports of the NetworkPolicy into
+// SecurityGroup rules. The policy's own podSelector is ignored, as the rules apply to
+// whatever the resulting security group is attached to. Only the directions listed in
+// policyTypes are translated; without policyTypes, ingress is always translated and
+// egress only if the policy has egress rules.
+func Translate(np *networkingv1.NetworkPolicy) ([]paasv1.SecurityGroupRule, []Unsupported) {
+	var rules []paasv1.SecurityGroupRule
+	var unsupported []Unsupported
+
+	if hasPolicyType(np, networkingv1.PolicyTypeIngress) {
+		for i, rule := range np.Spec.Ingress {
+			path := fmt.Sprintf("spec.ingress[%d]", i)
+			desc := fmt.Sprintf("networkpolicy %s/%s ingress[%d]", np.Namespace, np.Name, i)
+			r, u := translateRule(paasv1.DirectionIngress, path, "from", desc, rule.From, rule.Ports)
+			rules = append(rules, r...)
+			unsupported = append(unsupported, u...)
+		}
+	} else if len(np.Spec.Ingress) > 0 {
+		unsupported = append(unsupported, Unsupported{Path: "spec.ingress", Reason: "ignored because policyTypes does not include Ingress"})
+	}
+	if hasPolicyType(np, networkingv1.PolicyTypeEgress) {
+		for i, rule := range np.Spec.Egress {
+			path := fmt.Sprintf("spec.egress[%d]", i)
+			desc := fmt.Sprintf("networkpolicy %s/%s egress[%d]", np.Namespace, np.Name, i)
+			r, u := translateRule(paasv1.DirectionEgress, path, "to", desc, rule.To, rule.Ports)
+			rules = append(rules, r...)
+			unsupported = append(unsupported, u...)
+		}
+	} else if len(np.Spec.Egress) > 0 {
+		unsupported = append(unsupported, Unsupported{Path: "spec.egress", Reason: "ignored because policyTypes does not include Egress"})
+	}
+	return rules, unsupported
+}
+
+// hasPolicyType reports whether the policy applies to the given direction, following the
+// defaulting of policyTypes by the API server.
+func hasPolicyType(np *networkingv1.NetworkPolicy, t networkingv1.PolicyType) bool {
+	if len(np.Spec.PolicyTypes) == 0 {
+		return t == networkingv1.PolicyTypeIngress || len(np.Spec.Egress) > 0
+	}
+	for _, pt := range np.Spec.PolicyTypes {
+		if pt == t {
+			return true
+		}
+	}
+	return false
+}
+
+func translateRule(direction, path, peerField, desc string, peers []networkingv1.NetworkPolicyPeer, ports []networkingv1.NetworkPolicyPort) ([]paasv1.SecurityGroupRule, []Unsupported) {
+	var unsupported []Unsupported
+
+	// 没有指定 peer 表示允许所有地址
+	cidrs := []string{""}
+	if len(peers) > 0 {
+		cidrs = nil
+		for j, peer := range peers {
+			peerPath := fmt.Sprintf("%s.%s[%d]", path, peerField, j)
+			if peer.PodSelector != nil {
+				unsupported = append(unsupported, Unsupported{Path: peerPath + ".podSelector", Reason: "pod selectors cannot be expressed as CIDRs"})
+				continue
+			}
+			if peer.NamespaceSelector != nil {
+				unsupported = append(unsupported, Unsupported{Path: peerPath + ".namespaceSelector", Reason: "namespace selectors cannot be expressed as CIDRs"})
+				continue
+			}
+			if peer.IPBlock == nil {
+				continue
+			}
+			blocks, err := ipBlockCIDRs(peer.IPBlock)
+			if err != nil {
+				unsupported = append(unsupported, Unsupported{Path: peerPath + ".ipBlock", Reason: err.Error()})
+				continue
+			}
+			cidrs = append(cidrs, blocks...)
+		}
+	}
+
+	type protoPorts struct{ protocol, ports string }
+	// 没有指定端口表示允许所有协议和端口
+	pps := []protoPorts{{}}
+	if len(ports) > 0 {
+		pps = nil
+		for j, port := range ports {
+			protocol := corev1.ProtocolTCP
+			if port.Protocol != nil {
+				protocol = *port.Protocol
+			}
+			pp := protoPorts{protocol: strings.ToLower(string(protocol))}
+			if port.Port != nil {
+				if port.Port.Type == intstr.String {
+					unsupported = append(unsupported, Unsupported{
+						Path:   fmt.Sprintf("%s.ports[%d].port", path, j),
+						Reason: fmt.Sprintf("named port %q cannot be resolved outside the cluster", port.Port.StrVal),
+					})
+					continue
+				}
+				pp.ports = strconv.Itoa(port.Port.IntValue())
+			}
+			pps = append(pps, pp)
+		}
+	}
+
+	var rules []paasv1.SecurityGroupRule
+	for _, cidr := range cidrs {
+		for _, pp := range pps {
+			rules = append(rules, paasv1.SecurityGroupRule{
+				Direction:   direction,
+				Protocol:    pp.protocol,
+				Ports:       pp.ports,
+				CIDR:        cidr,
+				Description: desc,
+			})
+		}
+	}
+	return rules, unsupported
+}
+
+// ipBlockCIDRs returns the CIDRs covered by the ipBlock, with its except blocks removed.
+func ipBlockCIDRs(block *networkingv1.IPBlock) ([]string, error) {
+	_, base, err := net.ParseCIDR(block.CIDR)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cidr %q", block.CIDR)
+	}
+	var excepts []*net.IPNet
+	for _, e := range block.Except {
+		_, except, err := net.ParseCIDR(e)
+		if err != nil {
+			return nil, fmt.Errorf("invalid except cidr %q", e)
+		}
+		excepts = append(excepts, except)
+	}
+	var cidrs []string
+	for _, n := range subtract(base, excepts) {
+		cidrs = append(cidrs, n.String())
+	}
+	return cidrs, nil
+}
+
+// subtract returns the smallest set of networks that cover base without the excepts.
+func subtract(base *net.IPNet, excepts []*net.IPNet) []*net.IPNet {
+	baseOnes, bits := base.Mask.Size()
+	overlapping := false
+	for _, e := range excepts {
+		exceptOnes, exceptBits := e.Mask.Size()
+		if exceptBits != bits {
+			continue
+		}
+		// except 包含整个 base，base 全部被排除
+		if exceptOnes <= baseOnes && e.Contains(base.IP) {
+			return nil
+		}
+		if base.Contains(e.IP) {
+			overlapping = true
+		}
+	}
+	if !overlapping {
+		return []*net.IPNet{base}
+	}
+	// 将 base 一分为二，分别排除
+	lower, upper := split(base)
+	return append(subtract(lower, excepts), subtract(upper, excepts)...)
+}
+
+// split halves the network into its two subnets.
+func split(n *net.IPNet) (*net.IPNet, *net.IPNet) {
+	ones, bits := n.Mask.Size()
+	mask := net.CIDRMask(ones+1, bits)
+	lower := &net.IPNet{IP: n.IP.Mask(mask), Mask: mask}
+	upperIP := make(net.IP, len(lower.IP))
+	copy(upperIP, lower.IP)
+	upperIP[ones/8] |= 0x80 >> uint(ones%8)
+	return lower, &net.IPNet{IP: upperIP, Mask: mask}
+}
@@ -0,0 +1,159 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package networkpolicy
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	paasv1 "security-group/api/v1"
+)
+
+func TestTranslate(t *testing.T) {
+	udp := corev1.ProtocolUDP
+	port53 := intstr.FromInt(53)
+	port443 := intstr.FromInt(443)
+	named := intstr.FromString("http")
+
+	tests := []struct {
+		name            string
+		spec            networkingv1.NetworkPolicySpec
+		wantRules       []paasv1.SecurityGroupRule
+		wantUnsupported []string
+	}{
+		{
+			name: "ingress ipBlock with port",
+			spec: networkingv1.NetworkPolicySpec{
+				Ingress: []networkingv1.NetworkPolicyIngressRule{{
+					From:  []networkingv1.NetworkPolicyPeer{{IPBlock: &networkingv1.IPBlock{CIDR: "10.0.0.0/16"}}},
+					Ports: []networkingv1.NetworkPolicyPort{{Port: &port443}},
+				}},
+			},
+			wantRules: []paasv1.SecurityGroupRule{
+				{Direction: "ingress", Protocol: "tcp", Ports: "443", CIDR: "10.0.0.0/16", Description: "networkpolicy ns/np ingress[0]"},
+			},
+		},
+		{
+			name: "ingress without peers or ports allows everything",
+			spec: networkingv1.NetworkPolicySpec{
+				Ingress: []networkingv1.NetworkPolicyIngressRule{{}},
+			},
+			wantRules: []paasv1.SecurityGroupRule{
+				{Direction: "ingress", Description: "networkpolicy ns/np ingress[0]"},
+			},
+		},
+		{
+			name: "except blocks are subtracted",
+			spec: networkingv1.NetworkPolicySpec{
+				Ingress: []networkingv1.NetworkPolicyIngressRule{{
+					From: []networkingv1.NetworkPolicyPeer{{IPBlock: &networkingv1.IPBlock{CIDR: "10.0.0.0/24", Except: []string{"10.0.0.0/26"}}}},
+				}},
+			},
+			wantRules: []paasv1.SecurityGroupRule{
+				{Direction: "ingress", CIDR: "10.0.0.64/26", Description: "networkpolicy ns/np ingress[0]"},
+				{Direction: "ingress", CIDR: "10.0.0.128/25", Description: "networkpolicy ns/np ingress[0]"},
+			},
+		},
+		{
+			name: "egress with udp port",
+			spec: networkingv1.NetworkPolicySpec{
+				PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress},
+				Egress: []networkingv1.NetworkPolicyEgressRule{{
+					To:    []networkingv1.NetworkPolicyPeer{{IPBlock: &networkingv1.IPBlock{CIDR: "192.168.1.1/32"}}},
+					Ports: []networkingv1.NetworkPolicyPort{{Protocol: &udp, Port: &port53}},
+				}},
+			},
+			wantRules: []paasv1.SecurityGroupRule{
+				{Direction: "egress", Protocol: "udp", Ports: "53", CIDR: "192.168.1.1/32", Description: "networkpolicy ns/np egress[0]"},
+			},
+		},
+		{
+			name: "selectors and named ports are unsupported",
+			spec: networkingv1.NetworkPolicySpec{
+				Ingress: []networkingv1.NetworkPolicyIngressRule{{
+					From: []networkingv1.NetworkPolicyPeer{
+						{PodSelector: &metav1.LabelSelector{}},
+						{NamespaceSelector: &metav1.LabelSelector{}},
+						{IPBlock: &networkingv1.IPBlock{CIDR: "10.1.0.0/16"}},
+					},
+					Ports: []networkingv1.NetworkPolicyPort{{Port: &named}, {Port: &port443}},
+				}},
+			},
+			wantRules: []paasv1.SecurityGroupRule{
+				{Direction: "ingress", Protocol: "tcp", Ports: "443", CIDR: "10.1.0.0/16", Description: "networkpolicy ns/np ingress[0]"},
+			},
+			wantUnsupported: []string{
+				"spec.ingress[0].from[0].podSelector",
+				"spec.ingress[0].from[1].namespaceSelector",
+				"spec.ingress[0].ports[0].port",
+			},
+		},
+		{
+			name: "egress ignored without policy type",
+			spec: networkingv1.NetworkPolicySpec{
+				PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+				Egress:      []networkingv1.NetworkPolicyEgressRule{{}},
+			},
+			wantUnsupported: []string{"spec.egress"},
+		},
+		{
+			name: "ingress ignored without policy type",
+			spec: networkingv1.NetworkPolicySpec{
+				PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress},
+				Ingress:     []networkingv1.NetworkPolicyIngressRule{{}},
+				Egress:      []networkingv1.NetworkPolicyEgressRule{{}},
+			},
+			wantRules: []paasv1.SecurityGroupRule{
+				{Direction: "egress", Description: "networkpolicy ns/np egress[0]"},
+			},
+			wantUnsupported: []string{"spec.ingress"},
+		},
+		{
+			name: "egress translated by default when present",
+			spec: networkingv1.NetworkPolicySpec{
+				Ingress: []networkingv1.NetworkPolicyIngressRule{{}},
+				Egress:  []networkingv1.NetworkPolicyEgressRule{{}},
+			},
+			wantRules: []paasv1.SecurityGroupRule{
+				{Direction: "ingress", Description: "networkpolicy ns/np ingress[0]"},
+				{Direction: "egress", Description: "networkpolicy ns/np egress[0]"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			np := &networkingv1.NetworkPolicy{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "np"}, Spec: tt.spec}
+			rules, unsupported := Translate(np)
+			if !reflect.DeepEqual(rules, tt.wantRules) {
+				t.Errorf("rules = %+v, want %+v", rules, tt.wantRules)
+			}
+			var paths []string
+			for _, u := range unsupported {
+				paths = append(paths, u.Path)
+			}
+			if !reflect.DeepEqual(paths, tt.wantUnsupported) {
+				t.Errorf("unsupported = %v, want %v", paths, tt.wantUnsupported)
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package planner
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	paasv1 "security-group/api/v1"
+	"security-group/dcs"
+	"security-group/rules"
+)
+
+// Changes returns the calls that make the security group in DCS match the SecurityGroup
+// with the desired rules, in the order the controller makes them. A SecurityGroup that
+// is going to adopt a security group is planned as if it had adopted it.
+func Changes(ctx context.Context, api dcs.Client, sg *paasv1.SecurityGroup, desired []rules.Rule, cluster string) ([]paasv1.PlannedChange, error) {
+	// 待采纳的安全组按已采纳计算
+	if sg.Status.Id == "" && sg.Annotations[dcs.AdoptAnnotation] != "" {
+		sg = sg.DeepCopy()
+		sg.Status.Id = sg.Annotations[dcs.AdoptAnnotation]
+	}
+
+	var changes []paasv1.PlannedChange
+	var remote []rules.RemoteRule
+	exists := false
+	if sg.Status.Id != "" {
+		account := dcs.AccountOf(sg)
+		current, err := api.GetSecurityGroup(ctx, account, sg.Status.Id)
+		if err != nil {
+			return nil, err
+		}
+		if current != nil {
+			exists = true
+			diffs := current.Changes(sg.Spec.Name, Description(sg), dcs.ExpectedTags(cluster, sg, current.Tags, MayUpdate(sg)))
+			if !current.Owned && MayUpdate(sg) {
+				diffs = append(diffs, "add owner marker")
+			}
+			if len(diffs) > 0 {
+				changes = append(changes, paasv1.PlannedChange{Action: paasv1.PlanActionUpdateSecurityGroup, Detail: strings.Join(diffs, ", ")})
+			}
+			if remote, err = api.ListRules(ctx, account, sg.Status.Id); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if !exists {
+		changes = append(changes, paasv1.PlannedChange{Action: paasv1.PlanActionCreateSecurityGroup, Detail: fmt.Sprintf("name %q", sg.Spec.Name)})
+	}
+	return append(changes, RuleChanges(sg, desired, remote).Status()...), nil
+}
+
+// ManagesRules reports whether the controller removes the rules in DCS that the
+// SecurityGroup does not want, see spec.manageRules.
+func ManagesRules(sg *paasv1.SecurityGroup) bool {
+	if sg.Spec.ManageRules != nil {
+		return *sg.Spec.ManageRules
+	}
+	return len(sg.Spec.Rules) > 0 || sg.Spec.Template != nil
+}
+
+// ServiceRuleDescription returns the description of the rules generated for a port of a
+// Service. The rules are recognized in DCS by it after the Service is gone.
+func ServiceRuleDescription(namespace, name string, port int32) string {
+	return fmt.Sprintf("service %s/%s port %d", namespace, name, port)
+}
+
+var serviceRuleDescription = regexp.MustCompile(`^service ([^/ ]+)/[^/ ]+ port [0-9]+$`)
+
+// IsServiceRule reports whether the rule was generated for a Service in the namespace of
+// the SecurityGroup.
+func IsServiceRule(sg *paasv1.SecurityGroup, rule rules.Rule) bool {
+	m := serviceRuleDescription.FindStringSubmatch(rule.Description)
+	return m != nil && m[1] == sg.Namespace
+}
+
+// RuleChanges returns the plan that makes the remote rules match the desired rules. The
+// rules of a SecurityGroup that does not manage its rules are only added, except the rules
+// generated for Services, which are always removed when no longer wanted.
+func RuleChanges(sg *paasv1.SecurityGroup, desired []rules.Rule, remote []rules.RemoteRule) rules.Plan {
+	plan := rules.Diff(desired, remote)
+	if ManagesRules(sg) {
+		return plan
+	}
+	var kept rules.Plan
+	for _, change := range plan {
+		if change.Action == paasv1.PlanActionCreateRule || IsServiceRule(sg, change.Rule) {
+			kept = append(kept, change)
+		}
+	}
+	return kept
+}
+
+// CleanChanges returns the calls the controller makes when the SecurityGroup is deleted.
+func CleanChanges(sg *paasv1.SecurityGroup) []paasv1.PlannedChange {
+	if sg.Status.Id == "" || !MayUpdate(sg) {
+		return nil
+	}
+	return []paasv1.PlannedChange{{Action: paasv1.PlanActionDeleteSecurityGroup, Detail: fmt.Sprintf("id %s", sg.Status.Id)}}
+}
+
+// Summary describes the changes in a single line.
+func Summary(changes []paasv1.PlannedChange) string {
+	if len(changes) == 0 {
+		return "No changes"
+	}
+	s := make([]string, 0, len(changes))
+	for _, change := range changes {
+		s = append(s, change.String())
+	}
+	return fmt.Sprintf("%d changes: %s", len(changes), strings.Join(s, "; "))
+}
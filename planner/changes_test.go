@@ -0,0 +1,212 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package planner
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	paasv1 "security-group/api/v1"
+	"security-group/dcs"
+	"security-group/dcs/fake"
+	"security-group/rules"
+)
+
+func ssh(t *testing.T) rules.Rule {
+	r, err := rules.Parse(paasv1.SecurityGroupRule{Direction: "ingress", Protocol: "tcp", Ports: "22", CIDR: "10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func newSecurityGroup(policy, id string) *paasv1.SecurityGroup {
+	return &paasv1.SecurityGroup{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "tenant", Name: "web", UID: "1234"},
+		Spec:       paasv1.SecurityGroupSpec{AccountId: "a", UserId: "u", Name: "web", ManagementPolicy: policy},
+		Status:     paasv1.SecurityGroupStatus{Id: id},
+	}
+}
+
+func actions(changes []paasv1.PlannedChange) []string {
+	var s []string
+	for _, c := range changes {
+		s = append(s, c.Action)
+	}
+	return s
+}
+
+func TestChanges(t *testing.T) {
+	owned := dcs.SecurityGroup{Id: "1", Name: "web", Owned: true,
+		Tags: map[string]string{dcs.TagCluster: "c1", dcs.TagNamespace: "tenant", dcs.TagName: "web", dcs.TagUID: "1234"}}
+	unowned := dcs.SecurityGroup{Id: "1", Name: "web"}
+	remote := []rules.RemoteRule{{Rule: ssh(t), Id: "11"}}
+
+	tests := []struct {
+		name   string
+		sg     *paasv1.SecurityGroup
+		groups []dcs.SecurityGroup
+		want   []string
+		detail string
+	}{
+		{
+			name: "not created",
+			sg:   newSecurityGroup("", ""),
+			want: []string{paasv1.PlanActionCreateSecurityGroup, paasv1.PlanActionCreateRule},
+		},
+		{
+			name: "deleted in dcs",
+			sg:   newSecurityGroup("", "1"),
+			want: []string{paasv1.PlanActionCreateSecurityGroup, paasv1.PlanActionCreateRule},
+		},
+		{
+			name:   "in sync",
+			sg:     newSecurityGroup("", "1"),
+			groups: []dcs.SecurityGroup{owned},
+		},
+		{
+			name: "adopting",
+			sg: func() *paasv1.SecurityGroup {
+				sg := newSecurityGroup("", "")
+				sg.Annotations = map[string]string{dcs.AdoptAnnotation: "1"}
+				return sg
+			}(),
+			groups: []dcs.SecurityGroup{unowned},
+			want:   []string{paasv1.PlanActionUpdateSecurityGroup},
+			detail: `tag paas.unicom.cn/cluster "c1" added, tag paas.unicom.cn/name "web" added, ` +
+				`tag paas.unicom.cn/namespace "tenant" added, tag paas.unicom.cn/uid "1234" added, add owner marker`,
+		},
+		{
+			name:   "observed groups keep their tags and get no marker",
+			sg:     newSecurityGroup(paasv1.ManagementPolicyObserveOnly, "1"),
+			groups: []dcs.SecurityGroup{unowned},
+		},
+		{
+			name:   "renamed",
+			sg:     func() *paasv1.SecurityGroup { sg := newSecurityGroup("", "1"); sg.Spec.Name = "web-prod"; return sg }(),
+			groups: []dcs.SecurityGroup{owned},
+			want:   []string{paasv1.PlanActionUpdateSecurityGroup},
+			detail: `name "web" -> "web-prod"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := &fake.Client{Groups: tt.groups, Rules: map[string][]rules.RemoteRule{"1": remote}}
+			changes, err := Changes(context.Background(), api, tt.sg, []rules.Rule{ssh(t)}, "c1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := actions(changes); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Changes() = %v, want %v", changes, tt.want)
+			}
+			if tt.detail != "" && changes[0].Detail != tt.detail {
+				t.Errorf("Changes() detail = %s, want %s", changes[0].Detail, tt.detail)
+			}
+			if len(api.Calls) > 0 {
+				t.Errorf("Changes() made calls %v", api.Calls)
+			}
+		})
+	}
+}
+
+func TestCleanChanges(t *testing.T) {
+	if got := actions(CleanChanges(newSecurityGroup("", "1"))); !reflect.DeepEqual(got, []string{paasv1.PlanActionDeleteSecurityGroup}) {
+		t.Errorf("CleanChanges() = %v", got)
+	}
+	for _, sg := range []*paasv1.SecurityGroup{
+		newSecurityGroup("", ""),
+		newSecurityGroup(paasv1.ManagementPolicyCreateOnly, "1"),
+		newSecurityGroup(paasv1.ManagementPolicyObserveOnly, "1"),
+	} {
+		if changes := CleanChanges(sg); len(changes) > 0 {
+			t.Errorf("CleanChanges() of %s SecurityGroup %q = %v", sg.Spec.ManagementPolicy, sg.Status.Id, changes)
+		}
+	}
+}
+
+func TestRuleChanges(t *testing.T) {
+	yes, no := true, false
+	other, err := rules.Parse(paasv1.SecurityGroupRule{Direction: "ingress", Protocol: "tcp", Ports: "80"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	generated := other
+	generated.Description = ServiceRuleDescription("ns", "web", 80)
+	foreign := other
+	foreign.Description = ServiceRuleDescription("other", "web", 80)
+	remote := []rules.RemoteRule{{Rule: other, Id: "11"}}
+	desired := []rules.Rule{ssh(t)}
+
+	tests := []struct {
+		name   string
+		spec   paasv1.SecurityGroupSpec
+		remote []rules.RemoteRule
+		want   []string
+	}{
+		{
+			name: "rules predating spec.rules are kept",
+			want: []string{paasv1.PlanActionCreateRule},
+		},
+		{
+			name:   "rules of deleted Services are removed",
+			spec:   paasv1.SecurityGroupSpec{ManageRules: &no},
+			remote: []rules.RemoteRule{{Rule: generated, Id: "12"}},
+			want:   []string{paasv1.PlanActionCreateRule, paasv1.PlanActionDeleteRule},
+		},
+		{
+			name:   "rules of Services in other namespaces are kept",
+			remote: []rules.RemoteRule{{Rule: foreign, Id: "12"}},
+			want:   []string{paasv1.PlanActionCreateRule},
+		},
+		{
+			name: "rules of the spec are managed",
+			spec: paasv1.SecurityGroupSpec{Rules: []paasv1.SecurityGroupRule{{Direction: "ingress"}}},
+			want: []string{paasv1.PlanActionCreateRule, paasv1.PlanActionDeleteRule},
+		},
+		{
+			name: "rules of a template are managed",
+			spec: paasv1.SecurityGroupSpec{Template: &paasv1.TemplateReference{Name: "web"}},
+			want: []string{paasv1.PlanActionCreateRule, paasv1.PlanActionDeleteRule},
+		},
+		{
+			name: "opted in",
+			spec: paasv1.SecurityGroupSpec{ManageRules: &yes},
+			want: []string{paasv1.PlanActionCreateRule, paasv1.PlanActionDeleteRule},
+		},
+		{
+			name: "opted out",
+			spec: paasv1.SecurityGroupSpec{Rules: []paasv1.SecurityGroupRule{{Direction: "ingress"}}, ManageRules: &no},
+			want: []string{paasv1.PlanActionCreateRule},
+		},
+	}
+	for _, tt := range tests {
+		sg := &paasv1.SecurityGroup{ObjectMeta: metav1.ObjectMeta{Namespace: "ns"}, Spec: tt.spec}
+		if tt.remote == nil {
+			tt.remote = remote
+		}
+		var got []string
+		for _, change := range RuleChanges(sg, desired, tt.remote) {
+			got = append(got, change.Action)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: RuleChanges() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package planner
+
+import (
+	paasv1 "security-group/api/v1"
+	"security-group/dcs"
+)
+
+// MayUpdate reports whether the management policy lets the controller update and delete
+// the security group in DCS.
+func MayUpdate(sg *paasv1.SecurityGroup) bool {
+	return sg.Spec.ManagementPolicy == "" || sg.Spec.ManagementPolicy == paasv1.ManagementPolicyFull
+}
+
+// MayCreate reports whether the management policy lets the controller create the security
+// group in DCS.
+func MayCreate(sg *paasv1.SecurityGroup) bool {
+	return sg.Spec.ManagementPolicy != paasv1.ManagementPolicyObserveOnly
+}
+
+// Observed reports whether the controller only refreshes the status of the SecurityGroup,
+// because its management policy does not let it make the changes the SecurityGroup needs.
+// A CreateOnly SecurityGroup is observed once it has a security group.
+func Observed(sg *paasv1.SecurityGroup) bool {
+	if MayUpdate(sg) {
+		return false
+	}
+	return !MayCreate(sg) || sg.Status.Id != "" || sg.Annotations[dcs.AdoptAnnotation] != ""
+}
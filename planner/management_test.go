@@ -0,0 +1,74 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package planner
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	paasv1 "security-group/api/v1"
+	"security-group/dcs"
+)
+
+func TestManagementPolicy(t *testing.T) {
+	adopting := metav1.ObjectMeta{Annotations: map[string]string{dcs.AdoptAnnotation: "1"}}
+	tests := []struct {
+		name      string
+		sg        paasv1.SecurityGroup
+		mayUpdate bool
+		mayCreate bool
+		observed  bool
+	}{
+		{name: "default", sg: paasv1.SecurityGroup{}, mayUpdate: true, mayCreate: true},
+		{name: "full with id", sg: paasv1.SecurityGroup{
+			Spec:   paasv1.SecurityGroupSpec{ManagementPolicy: paasv1.ManagementPolicyFull},
+			Status: paasv1.SecurityGroupStatus{Id: "1"},
+		}, mayUpdate: true, mayCreate: true},
+		{name: "create only without id", sg: paasv1.SecurityGroup{
+			Spec: paasv1.SecurityGroupSpec{ManagementPolicy: paasv1.ManagementPolicyCreateOnly},
+		}, mayCreate: true},
+		{name: "create only with id", sg: paasv1.SecurityGroup{
+			Spec:   paasv1.SecurityGroupSpec{ManagementPolicy: paasv1.ManagementPolicyCreateOnly},
+			Status: paasv1.SecurityGroupStatus{Id: "1"},
+		}, mayCreate: true, observed: true},
+		{name: "create only adopting", sg: paasv1.SecurityGroup{
+			ObjectMeta: adopting,
+			Spec:       paasv1.SecurityGroupSpec{ManagementPolicy: paasv1.ManagementPolicyCreateOnly},
+		}, mayCreate: true, observed: true},
+		{name: "observe only without id", sg: paasv1.SecurityGroup{
+			Spec: paasv1.SecurityGroupSpec{ManagementPolicy: paasv1.ManagementPolicyObserveOnly},
+		}, observed: true},
+		{name: "observe only with id", sg: paasv1.SecurityGroup{
+			Spec:   paasv1.SecurityGroupSpec{ManagementPolicy: paasv1.ManagementPolicyObserveOnly},
+			Status: paasv1.SecurityGroupStatus{Id: "1"},
+		}, observed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MayUpdate(&tt.sg); got != tt.mayUpdate {
+				t.Errorf("MayUpdate() = %v, want %v", got, tt.mayUpdate)
+			}
+			if got := MayCreate(&tt.sg); got != tt.mayCreate {
+				t.Errorf("MayCreate() = %v, want %v", got, tt.mayCreate)
+			}
+			if got := Observed(&tt.sg); got != tt.observed {
+				t.Errorf("Observed() = %v, want %v", got, tt.observed)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package planner computes the rules a SecurityGroup wants in DCS and the calls that make
+// DCS match it. It is shared by the controller, the webhook and sgctl so that they agree
+// on what a SecurityGroup means.
+package planner
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"security-group/addressgroup"
+	paasv1 "security-group/api/v1"
+	"security-group/dcs"
+	"security-group/rules"
+	"security-group/schedule"
+)
+
+// SpecRules returns the rules rendered from the template followed by the rules of the spec.
+func SpecRules(sg *paasv1.SecurityGroup) []paasv1.SecurityGroupRule {
+	if sg.Status.Template == nil || sg.Spec.Template == nil {
+		return sg.Spec.Rules
+	}
+	return append(append([]paasv1.SecurityGroupRule{}, sg.Status.Template.Rules...), sg.Spec.Rules...)
+}
+
+// Description returns the description of the spec, or the one rendered from the template.
+func Description(sg *paasv1.SecurityGroup) string {
+	if sg.Spec.Description == "" && sg.Spec.Template != nil && sg.Status.Template != nil {
+		return sg.Status.Template.Description
+	}
+	return sg.Spec.Description
+}
+
+// ActiveRules returns the rules of the spec and its template without the expired temporary
+// rules and the scheduled rules whose window is closed at now.
+func ActiveRules(sg *paasv1.SecurityGroup, now time.Time) []paasv1.SecurityGroupRule {
+	all := SpecRules(sg)
+	active := make([]paasv1.SecurityGroupRule, 0, len(all))
+	for _, rule := range all {
+		if !InWindow(rule, now) {
+			continue
+		}
+		if rule.Temporary() {
+			// 尚未写入 DCS 的规则从现在开始计时
+			appliedAt := now
+			if t, ok := sg.Status.GetTemporaryRule(rule.String()); ok && t.AppliedAt != "" {
+				appliedAt, _ = time.Parse(time.RFC3339, t.AppliedAt)
+			}
+			// 格式错误的规则交给 rules.Normalize 报错
+			if expiry, err := rules.Expiry(rule, appliedAt); err == nil && !now.Before(expiry) {
+				continue
+			}
+		}
+		active = append(active, rule)
+	}
+	return active
+}
+
+// InWindow reports whether the rule has no schedule or its window is open.
+func InWindow(rule paasv1.SecurityGroupRule, now time.Time) bool {
+	if rule.Schedule == nil {
+		return true
+	}
+	w, err := schedule.ForRule(rule.Schedule)
+	if err != nil {
+		// 格式错误的规则交给 rules.Normalize 报错
+		return true
+	}
+	active, _ := w.Active(now)
+	return active
+}
+
+// Expand replaces the rules that reference address groups or services of the catalog
+// with a rule for each of their CIDRs, protocols and ports. Address groups that do not
+// exist are an error, unless missingOK is set and they are treated as empty.
+func Expand(ctx context.Context, c client.Reader, namespace string, specRules []paasv1.SecurityGroupRule, missingOK bool) ([]paasv1.SecurityGroupRule, error) {
+	expanded := specRules
+	if names := rules.AddressGroups(specRules); len(names) > 0 {
+		groups, missing, err := addressgroup.Resolve(ctx, c, namespace, names)
+		if err != nil {
+			return nil, err
+		}
+		if len(missing) > 0 && !missingOK {
+			return nil, fmt.Errorf("address groups not found: %s", strings.Join(missing, ", "))
+		}
+		for _, name := range missing {
+			groups[name] = nil
+		}
+		if expanded, err = rules.Expand(specRules, groups); err != nil {
+			return nil, err
+		}
+	}
+	catalogs := &paasv1.ServiceCatalogList{}
+	if err := c.List(ctx, catalogs); err != nil {
+		return nil, err
+	}
+	return rules.ExpandServices(expanded, rules.Catalog(catalogs.Items))
+}
+
+// ExpandActive returns the active rules of the SecurityGroup and its template with their
+// address groups and services expanded.
+func ExpandActive(ctx context.Context, c client.Reader, sg *paasv1.SecurityGroup) ([]paasv1.SecurityGroupRule, error) {
+	active := ActiveRules(sg, time.Now())
+	if err := rules.ValidatePriorities(active); err != nil {
+		return nil, err
+	}
+	return Expand(ctx, c, sg.Namespace, active, false)
+}
+
+// Desired normalizes expanded rules into the rules wanted in DCS and checks that DCS
+// supports them.
+func Desired(expanded []paasv1.SecurityGroupRule) ([]rules.Rule, error) {
+	// 规范化期望的规则：去重、合并端口范围和 CIDR
+	normalized, err := rules.Normalize(expanded)
+	if err != nil {
+		return nil, err
+	}
+	for _, rule := range normalized {
+		if err := dcs.Supported(rule); err != nil {
+			return nil, err
+		}
+	}
+	return normalized, nil
+}
@@ -0,0 +1,43 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package planner
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	paasv1 "security-group/api/v1"
+)
+
+// GetTemplate returns the spec and the resource version of the SecurityGroupTemplate in the
+// namespace or the ClusterSecurityGroupTemplate the reference names.
+func GetTemplate(ctx context.Context, c client.Reader, namespace string, ref *paasv1.TemplateReference) (paasv1.SecurityGroupTemplateSpec, string, error) {
+	if ref.Kind == paasv1.KindClusterSecurityGroupTemplate {
+		t := &paasv1.ClusterSecurityGroupTemplate{}
+		if err := c.Get(ctx, types.NamespacedName{Name: ref.Name}, t); err != nil {
+			return paasv1.SecurityGroupTemplateSpec{}, "", err
+		}
+		return t.Spec, t.ResourceVersion, nil
+	}
+	t := &paasv1.SecurityGroupTemplate{}
+	if err := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: ref.Name}, t); err != nil {
+		return paasv1.SecurityGroupTemplateSpec{}, "", err
+	}
+	return t.Spec, t.ResourceVersion, nil
+}
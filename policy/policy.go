@@ -0,0 +1,155 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package policy checks the rules of SecurityGroups against the cluster-wide
+// SecurityGroupPolicies. It is used by both the validating webhook and the reconciler.
+package policy
+
+import (
+	"fmt"
+	"strings"
+
+	paasv1 "security-group/api/v1"
+	"security-group/rules"
+)
+
+// Violation is a rule of a SecurityGroup that a policy denies, or a rule that a policy
+// requires and the SecurityGroup lacks.
+type Violation struct {
+	// Policy is the name of the violated SecurityGroupPolicy.
+	Policy string
+	// Message describes the violation.
+	Message string
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("policy %s: %s", v.Policy, v.Message)
+}
+
+// Check returns the violations of the policies that apply to the namespace by the
+// normalized rules of a SecurityGroup. An error is returned if a policy is invalid.
+func Check(namespace string, desired []rules.Rule, policies []paasv1.SecurityGroupPolicy) ([]Violation, error) {
+	var violations []Violation
+	for i := range policies {
+		p := &policies[i]
+		if !p.AppliesTo(namespace) {
+			continue
+		}
+		for j, deny := range p.Spec.Deny {
+			for _, r := range desired {
+				// 拒绝规则不会放行流量
+				if r.Deny() {
+					continue
+				}
+				match, err := Matches(deny, r)
+				if err != nil {
+					return nil, fmt.Errorf("policy %s deny %d: %v", p.Name, j, err)
+				}
+				if match {
+					violations = append(violations, Violation{Policy: p.Name, Message: denyMessage(deny, r)})
+				}
+			}
+		}
+		for j, sr := range p.Spec.Require {
+			required, err := rules.Parse(sr)
+			if err != nil {
+				return nil, fmt.Errorf("policy %s require %d: %v", p.Name, j, err)
+			}
+			if !covered(required, desired) {
+				violations = append(violations, Violation{Policy: p.Name, Message: fmt.Sprintf("missing required rule %s", required)})
+			}
+		}
+	}
+	return violations, nil
+}
+
+// Matches reports whether the policy rule matches the rule.
+func Matches(pr paasv1.PolicyRule, r rules.Rule) (bool, error) {
+	if pr.Direction != "" && !strings.EqualFold(pr.Direction, r.Direction) {
+		return false, nil
+	}
+	if pr.Ethertype != "" && pr.Ethertype != r.Ethertype() {
+		return false, nil
+	}
+
+	if len(pr.Protocols) > 0 && r.Protocol != "" {
+		found := false
+		for _, p := range pr.Protocols {
+			p = rules.CanonicalProtocol(p)
+			// icmp 同时匹配 IPv6 的 icmpv6 规则
+			if p == "" || p == r.Protocol || p == "icmp" && r.Protocol == "icmpv6" {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false, nil
+		}
+	}
+
+	if pr.Ports != "" {
+		min, max, err := rules.ParsePorts(pr.Ports)
+		if err != nil {
+			return false, err
+		}
+		// 没有端口的协议(如 icmp)不会放行任何端口
+		if r.Protocol != "" && r.PortMin == 0 && r.PortMax == 0 && !hasPorts(r.Protocol) {
+			return false, nil
+		}
+		if r.PortMin != 0 && (r.PortMax < min || r.PortMin > max) {
+			return false, nil
+		}
+	}
+
+	if len(pr.CIDRs) > 0 {
+		found := false
+		for _, cidr := range pr.CIDRs {
+			n, err := rules.ParseCIDR(cidr)
+			if err != nil {
+				return false, err
+			}
+			// 只比较同一地址族的网络；规则放行其中任一地址即匹配，拆分成多条规则也无法绕过
+			if rules.OverlapsNet(r.Network(), n) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func covered(required rules.Rule, desired []rules.Rule) bool {
+	for _, r := range desired {
+		if r.Covers(required) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasPorts(protocol string) bool {
+	return protocol == "tcp" || protocol == "udp" || protocol == "sctp"
+}
+
+func denyMessage(pr paasv1.PolicyRule, r rules.Rule) string {
+	if pr.Description != "" {
+		return fmt.Sprintf("rule %s is denied: %s", r, pr.Description)
+	}
+	return fmt.Sprintf("rule %s is denied", r)
+}
@@ -0,0 +1,204 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package policy
+
+import (
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	paasv1 "security-group/api/v1"
+	"security-group/rules"
+)
+
+func TestCheck(t *testing.T) {
+	rule := func(direction, protocol, ports, cidr string) rules.Rule {
+		r, err := rules.Parse(paasv1.SecurityGroupRule{Direction: direction, Protocol: protocol, Ports: ports, CIDR: cidr})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+	policy := func(name string, spec paasv1.SecurityGroupPolicySpec) paasv1.SecurityGroupPolicy {
+		return paasv1.SecurityGroupPolicy{ObjectMeta: metav1.ObjectMeta{Name: name}, Spec: spec}
+	}
+	noWorldSSH := policy("no-world-ssh", paasv1.SecurityGroupPolicySpec{
+		Deny: []paasv1.PolicyRule{{Direction: "ingress", Protocols: []string{"tcp"}, Ports: "22", CIDRs: []string{"0.0.0.0/0"}, Description: "ssh must not be open to the world"}},
+	})
+
+	tests := []struct {
+		name      string
+		namespace string
+		desired   []rules.Rule
+		policies  []paasv1.SecurityGroupPolicy
+		want      []string
+	}{
+		{
+			name:     "world ssh denied",
+			desired:  []rules.Rule{rule("ingress", "tcp", "22", "0.0.0.0/0")},
+			policies: []paasv1.SecurityGroupPolicy{noWorldSSH},
+			want:     []string{"policy no-world-ssh: rule ingress tcp 22 0.0.0.0/0 is denied: ssh must not be open to the world"},
+		},
+		{
+			name:     "port range including ssh denied",
+			desired:  []rules.Rule{rule("ingress", "tcp", "1-1024", "0.0.0.0/0")},
+			policies: []paasv1.SecurityGroupPolicy{noWorldSSH},
+			want:     []string{"policy no-world-ssh: rule ingress tcp 1-1024 0.0.0.0/0 is denied: ssh must not be open to the world"},
+		},
+		{
+			name:     "any protocol denied",
+			desired:  []rules.Rule{rule("ingress", "", "", "0.0.0.0/0")},
+			policies: []paasv1.SecurityGroupPolicy{noWorldSSH},
+			want:     []string{"policy no-world-ssh: rule ingress any all 0.0.0.0/0 is denied: ssh must not be open to the world"},
+		},
+		{
+			name:     "ipv6 rule not matched by ipv4 cidr",
+			desired:  []rules.Rule{rule("ingress", "tcp", "22", "::/0")},
+			policies: []paasv1.SecurityGroupPolicy{noWorldSSH},
+		},
+		{
+			name:    "dual-stack policy",
+			desired: []rules.Rule{rule("ingress", "tcp", "22", "::/0"), rule("ingress", "tcp", "22", "0.0.0.0/0")},
+			policies: []paasv1.SecurityGroupPolicy{policy("no-world-ssh", paasv1.SecurityGroupPolicySpec{
+				Deny: []paasv1.PolicyRule{{Protocols: []string{"tcp"}, Ports: "22", CIDRs: []string{"0.0.0.0/0", "::/0"}}},
+			})},
+			want: []string{"policy no-world-ssh: rule ingress tcp 22 ::/0 is denied", "policy no-world-ssh: rule ingress tcp 22 0.0.0.0/0 is denied"},
+		},
+		{
+			name:    "ethertype and icmpv6 matched by icmp",
+			desired: []rules.Rule{rule("ingress", "icmp", "", "0.0.0.0/0"), rule("ingress", "icmpv6", "", "fd00::/8")},
+			policies: []paasv1.SecurityGroupPolicy{policy("no-ping6", paasv1.SecurityGroupPolicySpec{
+				Deny: []paasv1.PolicyRule{{Ethertype: "IPv6", Protocols: []string{"icmp"}}},
+			})},
+			want: []string{"policy no-ping6: rule ingress icmpv6 all fd00::/8 is denied"},
+		},
+		{
+			name:    "required ipv6 rule not covered by ipv4 rule",
+			desired: []rules.Rule{rule("egress", "udp", "53", "0.0.0.0/0")},
+			policies: []paasv1.SecurityGroupPolicy{policy("dns", paasv1.SecurityGroupPolicySpec{
+				Require: []paasv1.SecurityGroupRule{{Direction: "egress", Ethertype: "IPv6", Protocol: "udp", Ports: "53"}},
+			})},
+			want: []string{"policy dns: missing required rule egress udp 53 ::/0"},
+		},
+		{
+			name: "deny rule not denied",
+			desired: []rules.Rule{func() rules.Rule {
+				r := rule("ingress", "tcp", "22", "0.0.0.0/0")
+				r.Action = "deny"
+				return r
+			}()},
+			policies: []paasv1.SecurityGroupPolicy{noWorldSSH},
+		},
+		{
+			name:     "ssh to part of the denied network denied",
+			desired:  []rules.Rule{rule("ingress", "tcp", "22", "10.0.0.0/8")},
+			policies: []paasv1.SecurityGroupPolicy{noWorldSSH},
+			want:     []string{"policy no-world-ssh: rule ingress tcp 22 10.0.0.0/8 is denied: ssh must not be open to the world"},
+		},
+		{
+			name:     "split ranges denied",
+			desired:  []rules.Rule{rule("ingress", "tcp", "22", "0.0.0.0/1"), rule("ingress", "tcp", "22", "128.0.0.0/1")},
+			policies: []paasv1.SecurityGroupPolicy{noWorldSSH},
+			want: []string{
+				"policy no-world-ssh: rule ingress tcp 22 0.0.0.0/1 is denied: ssh must not be open to the world",
+				"policy no-world-ssh: rule ingress tcp 22 128.0.0.0/1 is denied: ssh must not be open to the world",
+			},
+		},
+		{
+			name:    "networks containing or inside the denied network denied",
+			desired: []rules.Rule{rule("ingress", "tcp", "22", "192.0.2.128/25"), rule("ingress", "tcp", "22", "192.0.0.0/16"), rule("ingress", "tcp", "22", "10.0.0.0/8")},
+			policies: []paasv1.SecurityGroupPolicy{policy("no-test-net", paasv1.SecurityGroupPolicySpec{
+				Deny: []paasv1.PolicyRule{{Ports: "22", CIDRs: []string{"192.0.2.0/24"}}},
+			})},
+			want: []string{"policy no-test-net: rule ingress tcp 22 192.0.2.128/25 is denied", "policy no-test-net: rule ingress tcp 22 192.0.0.0/16 is denied"},
+		},
+		{
+			name:     "other ports and protocols allowed",
+			desired:  []rules.Rule{rule("ingress", "tcp", "443", "0.0.0.0/0"), rule("ingress", "udp", "22", "0.0.0.0/0"), rule("ingress", "icmp", "", "0.0.0.0/0")},
+			policies: []paasv1.SecurityGroupPolicy{noWorldSSH},
+		},
+		{
+			name:     "egress allowed",
+			desired:  []rules.Rule{rule("egress", "tcp", "22", "0.0.0.0/0")},
+			policies: []paasv1.SecurityGroupPolicy{noWorldSSH},
+		},
+		{
+			name:      "other namespace",
+			namespace: "dev",
+			desired:   []rules.Rule{rule("ingress", "tcp", "22", "0.0.0.0/0")},
+			policies: []paasv1.SecurityGroupPolicy{policy("prod-only", paasv1.SecurityGroupPolicySpec{
+				Namespaces: []string{"prod"},
+				Deny:       []paasv1.PolicyRule{{Ports: "22"}},
+			})},
+		},
+		{
+			name:    "port range denied entirely",
+			desired: []rules.Rule{rule("egress", "udp", "6050", "10.0.0.0/8"), rule("egress", "udp", "7000", "10.0.0.0/8")},
+			policies: []paasv1.SecurityGroupPolicy{policy("no-x11", paasv1.SecurityGroupPolicySpec{
+				Deny: []paasv1.PolicyRule{{Ports: "6000-6100"}},
+			})},
+			want: []string{"policy no-x11: rule egress udp 6050 10.0.0.0/8 is denied"},
+		},
+		{
+			name:    "required rule covered",
+			desired: []rules.Rule{rule("egress", "udp", "1-1024", "10.0.0.0/8")},
+			policies: []paasv1.SecurityGroupPolicy{policy("dns", paasv1.SecurityGroupPolicySpec{
+				Require: []paasv1.SecurityGroupRule{{Direction: "egress", Protocol: "udp", Ports: "53", CIDR: "10.0.0.2"}},
+			})},
+		},
+		{
+			name:    "required rule missing",
+			desired: []rules.Rule{rule("egress", "tcp", "53", "10.0.0.2/32")},
+			policies: []paasv1.SecurityGroupPolicy{policy("dns", paasv1.SecurityGroupPolicySpec{
+				Require: []paasv1.SecurityGroupRule{{Direction: "egress", Protocol: "udp", Ports: "53", CIDR: "10.0.0.2"}},
+			})},
+			want: []string{"policy dns: missing required rule egress udp 53 10.0.0.2/32"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			namespace := tt.namespace
+			if namespace == "" {
+				namespace = "prod"
+			}
+			violations, err := Check(namespace, tt.desired, tt.policies)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, v := range violations {
+				got = append(got, v.String())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Check() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckInvalidPolicy(t *testing.T) {
+	r, _ := rules.New("ingress", "tcp", 22, 22, "", "")
+	policies := []paasv1.SecurityGroupPolicy{{
+		ObjectMeta: metav1.ObjectMeta{Name: "bad"},
+		Spec:       paasv1.SecurityGroupPolicySpec{Deny: []paasv1.PolicyRule{{CIDRs: []string{"not-a-cidr"}}}},
+	}}
+	if _, err := Check("default", []rules.Rule{r}, policies); err == nil {
+		t.Errorf("Check() should fail for an invalid policy")
+	}
+}
@@ -0,0 +1,168 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package reachability evaluates whether a flow is allowed by the rules of a set of
+// SecurityGroups, and explains which rule decided it.
+package reachability
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	paasv1 "security-group/api/v1"
+	"security-group/rules"
+)
+
+// Flow is traffic between an instance and a remote address.
+type Flow struct {
+	// Direction is ingress for traffic from the address to the instance, or egress for
+	// traffic from the instance to the address.
+	Direction string
+	// Protocol is the canonical protocol name, e.g. tcp.
+	Protocol string
+	// Port is the destination port, or 0 for protocols without ports.
+	Port int32
+	// Address is the remote address.
+	Address net.IP
+}
+
+// ParseFlow parses a flow. The port is required for tcp, udp and sctp and must be empty
+// for other protocols.
+func ParseFlow(direction, protocol, port, address string) (Flow, error) {
+	f := Flow{
+		Direction: strings.ToLower(strings.TrimSpace(direction)),
+		Protocol:  rules.CanonicalProtocol(protocol),
+		Address:   net.ParseIP(strings.TrimSpace(address)),
+	}
+	if f.Direction != paasv1.DirectionIngress && f.Direction != paasv1.DirectionEgress {
+		return Flow{}, fmt.Errorf("invalid direction %q", direction)
+	}
+	if f.Protocol == "" {
+		return Flow{}, fmt.Errorf("a flow needs a protocol")
+	}
+	if f.Address == nil {
+		return Flow{}, fmt.Errorf("invalid address %q", address)
+	}
+	if ip4 := f.Address.To4(); ip4 != nil {
+		f.Address = ip4
+	}
+	switch {
+	case hasPorts(f.Protocol):
+		p, err := strconv.ParseInt(strings.TrimSpace(port), 10, 32)
+		if err != nil || p < 1 || p > 65535 {
+			return Flow{}, fmt.Errorf("invalid port %q", port)
+		}
+		f.Port = int32(p)
+	case strings.TrimSpace(port) != "":
+		return Flow{}, fmt.Errorf("protocol %s has no ports", f.Protocol)
+	}
+	return f, nil
+}
+
+func (f Flow) String() string {
+	peer := "from"
+	if f.Direction == paasv1.DirectionEgress {
+		peer = "to"
+	}
+	if f.Port == 0 {
+		return fmt.Sprintf("%s %s %s %s", f.Direction, f.Protocol, peer, f.Address)
+	}
+	return fmt.Sprintf("%s %s %d %s %s", f.Direction, f.Protocol, f.Port, peer, f.Address)
+}
+
+// Group is a SecurityGroup with its normalized rules.
+type Group struct {
+	// Name identifies the group in explanations, e.g. "default/web".
+	Name  string
+	Rules []rules.Rule
+}
+
+// Result is the decision for a flow.
+type Result struct {
+	Flow    Flow
+	Allowed bool
+	// Group and Rule decided the flow. Rule is nil if no rule matches the flow, in which
+	// case the flow is denied.
+	Group string
+	Rule  *rules.Rule
+}
+
+// Explain describes the decision in a single line.
+func (r Result) Explain() string {
+	if r.Rule == nil {
+		return fmt.Sprintf("%s: denied, no rule matches", r.Flow)
+	}
+	verdict := "allowed"
+	if !r.Allowed {
+		verdict = "denied"
+	}
+	s := fmt.Sprintf("%s: %s by %s rule %q", r.Flow, verdict, r.Group, r.Rule.String())
+	if r.Rule.Description != "" {
+		s += fmt.Sprintf(" (%s)", r.Rule.Description)
+	}
+	return s
+}
+
+// Evaluate decides the flow by the rules of all groups of an instance. The rules are
+// evaluated by priority, with rules without a priority last and deny rules before allow
+// rules of the same priority, and the first matching rule decides. Flows no rule matches
+// are denied.
+func Evaluate(flow Flow, groups []Group) Result {
+	type match struct {
+		group string
+		rule  rules.Rule
+	}
+	var matches []match
+	for _, g := range groups {
+		for _, r := range g.Rules {
+			if Matches(r, flow) {
+				matches = append(matches, match{g.Name, r})
+			}
+		}
+	}
+	if len(matches) == 0 {
+		return Result{Flow: flow}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].rule.Before(matches[j].rule) })
+	first := matches[0]
+	return Result{Flow: flow, Allowed: !first.rule.Deny(), Group: first.group, Rule: &first.rule}
+}
+
+// Matches reports whether the rule matches the flow.
+func Matches(r rules.Rule, flow Flow) bool {
+	if r.Direction != flow.Direction {
+		return false
+	}
+	if r.Protocol != "" && r.Protocol != flow.Protocol {
+		return false
+	}
+	if r.PortMin != 0 && (flow.Port < r.PortMin || flow.Port > r.PortMax) {
+		return false
+	}
+	n := r.Network()
+	// IPv4 网络的 Contains 也匹配 IPv4-mapped IPv6 地址，需先比较地址族
+	if n == nil || (len(n.IP) == net.IPv4len) != (len(flow.Address) == net.IPv4len) {
+		return false
+	}
+	return n.Contains(flow.Address)
+}
+
+func hasPorts(protocol string) bool {
+	return protocol == "tcp" || protocol == "udp" || protocol == "sctp"
+}
@@ -0,0 +1,85 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package reachability
+
+import (
+	"testing"
+
+	paasv1 "security-group/api/v1"
+	"security-group/rules"
+)
+
+func TestEvaluate(t *testing.T) {
+	rule := func(sr paasv1.SecurityGroupRule) rules.Rule {
+		r, err := rules.Parse(sr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+	web := Group{Name: "default/web", Rules: []rules.Rule{
+		rule(paasv1.SecurityGroupRule{Direction: "ingress", Protocol: "tcp", Ports: "443", Description: "https"}),
+		rule(paasv1.SecurityGroupRule{Direction: "ingress", Protocol: "tcp", Ports: "22", CIDR: "10.0.0.0/8"}),
+		rule(paasv1.SecurityGroupRule{Direction: "ingress", Protocol: "tcp", Ports: "22", CIDR: "10.66.0.0/16", Action: "deny", Priority: 10}),
+		rule(paasv1.SecurityGroupRule{Direction: "ingress", Ethertype: "IPv6", Protocol: "icmpv6"}),
+	}}
+	dns := Group{Name: "default/dns", Rules: []rules.Rule{
+		rule(paasv1.SecurityGroupRule{Direction: "egress", Protocol: "udp", Ports: "53", CIDR: "10.0.0.2"}),
+	}}
+
+	tests := []struct {
+		direction, protocol, port, address string
+		want                               string
+	}{
+		{"ingress", "tcp", "443", "203.0.113.9", `ingress tcp 443 from 203.0.113.9: allowed by default/web rule "ingress tcp 443 0.0.0.0/0" (https)`},
+		{"ingress", "tcp", "22", "10.1.2.3", `ingress tcp 22 from 10.1.2.3: allowed by default/web rule "ingress tcp 22 10.0.0.0/8"`},
+		{"ingress", "tcp", "22", "10.66.2.3", `ingress tcp 22 from 10.66.2.3: denied by default/web rule "ingress tcp 22 10.66.0.0/16 deny priority 10"`},
+		{"ingress", "tcp", "22", "192.168.0.1", `ingress tcp 22 from 192.168.0.1: denied, no rule matches`},
+		{"ingress", "tcp", "443", "2001:db8::1", `ingress tcp 443 from 2001:db8::1: denied, no rule matches`},
+		{"ingress", "icmpv6", "", "2001:db8::1", `ingress icmpv6 from 2001:db8::1: allowed by default/web rule "ingress icmpv6 all ::/0"`},
+		{"egress", "udp", "53", "10.0.0.2", `egress udp 53 to 10.0.0.2: allowed by default/dns rule "egress udp 53 10.0.0.2/32"`},
+		{"egress", "tcp", "53", "10.0.0.2", `egress tcp 53 to 10.0.0.2: denied, no rule matches`},
+	}
+	for _, tt := range tests {
+		flow, err := ParseFlow(tt.direction, tt.protocol, tt.port, tt.address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := Evaluate(flow, []Group{web, dns})
+		if got.Explain() != tt.want {
+			t.Errorf("Evaluate(%s) = %s, want %s", flow, got.Explain(), tt.want)
+		}
+		if got.Allowed != (got.Rule != nil && !got.Rule.Deny()) {
+			t.Errorf("Evaluate(%s).Allowed = %t", flow, got.Allowed)
+		}
+	}
+}
+
+func TestParseFlowError(t *testing.T) {
+	for _, flow := range [][4]string{
+		{"inbound", "tcp", "22", "10.0.0.1"},
+		{"ingress", "", "22", "10.0.0.1"},
+		{"ingress", "tcp", "", "10.0.0.1"},
+		{"ingress", "tcp", "70000", "10.0.0.1"},
+		{"ingress", "icmp", "8", "10.0.0.1"},
+		{"ingress", "tcp", "22", "10.0.0.0/8"},
+	} {
+		if _, err := ParseFlow(flow[0], flow[1], flow[2], flow[3]); err == nil {
+			t.Errorf("ParseFlow(%v) should fail", flow)
+		}
+	}
+}
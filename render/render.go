@@ -0,0 +1,123 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package render renders SecurityGroupTemplates with the parameters of a SecurityGroup.
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"text/template"
+
+	paasv1 "security-group/api/v1"
+)
+
+// Template renders the description and every string field of the rules of the template,
+// including their schedules, with the parameters, which override the defaults of the
+// template. Unknown parameters, missing required parameters
+// and references to undeclared parameters are errors.
+func Template(spec paasv1.SecurityGroupTemplateSpec, params map[string]string) (string, []paasv1.SecurityGroupRule, error) {
+	values, err := Parameters(spec.Parameters, params)
+	if err != nil {
+		return "", nil, err
+	}
+
+	description, err := render("description", spec.Description, values)
+	if err != nil {
+		return "", nil, err
+	}
+	rules := make([]paasv1.SecurityGroupRule, 0, len(spec.Rules))
+	for i, rule := range spec.Rules {
+		rendered := rule.DeepCopy()
+		if err := renderFields(fmt.Sprintf("rules[%d]", i), reflect.ValueOf(rendered).Elem(), values); err != nil {
+			return "", nil, err
+		}
+		rules = append(rules, *rendered)
+	}
+	return description, rules, nil
+}
+
+// Parameters returns the values of the declared parameters, from params or their defaults.
+func Parameters(declared []paasv1.TemplateParameter, params map[string]string) (map[string]string, error) {
+	values := map[string]string{}
+	var missing []string
+	for _, p := range declared {
+		v, ok := params[p.Name]
+		if !ok {
+			if p.Required {
+				missing = append(missing, p.Name)
+				continue
+			}
+			v = p.Default
+		}
+		values[p.Name] = v
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("missing required parameters: %s", strings.Join(missing, ", "))
+	}
+
+	var unknown []string
+	for name := range params {
+		if _, ok := values[name]; !ok {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("unknown parameters: %s", strings.Join(unknown, ", "))
+	}
+	return values, nil
+}
+
+// renderFields renders the string fields of the struct and of the structs it points to, in
+// place. The fields are named by their JSON names, e.g. "rules[0].schedule.cron".
+func renderFields(path string, v reflect.Value, values map[string]string) error {
+	for i := 0; i < v.NumField(); i++ {
+		name := path + "." + strings.Split(v.Type().Field(i).Tag.Get("json"), ",")[0]
+		f := v.Field(i)
+		switch {
+		case f.Kind() == reflect.String:
+			rendered, err := render(name, f.String(), values)
+			if err != nil {
+				return err
+			}
+			f.SetString(rendered)
+		case f.Kind() == reflect.Ptr && !f.IsNil() && f.Elem().Kind() == reflect.Struct:
+			if err := renderFields(name, f.Elem(), values); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func render(name, text string, values map[string]string) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+	t, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var b bytes.Buffer
+	if err := t.Execute(&b, values); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
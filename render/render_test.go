@@ -0,0 +1,160 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package render
+
+import (
+	"reflect"
+	"testing"
+
+	paasv1 "security-group/api/v1"
+)
+
+var webTier = paasv1.SecurityGroupTemplateSpec{
+	Parameters: []paasv1.TemplateParameter{
+		{Name: "app", Required: true},
+		{Name: "port", Default: "443"},
+		{Name: "lb", Default: "10.0.0.0/16"},
+	},
+	Description: "web tier of {{ .app }}",
+	Rules: []paasv1.SecurityGroupRule{
+		{Direction: "ingress", Protocol: "tcp", Ports: "{{ .port }}", CIDR: "{{ .lb }}", Description: "{{ .app }} from load balancers"},
+		{Direction: "egress", Protocol: "udp", Ports: "53"},
+	},
+}
+
+func TestTemplate(t *testing.T) {
+	tests := []struct {
+		name            string
+		params          map[string]string
+		wantDescription string
+		wantRules       []paasv1.SecurityGroupRule
+	}{
+		{
+			name:            "defaults",
+			params:          map[string]string{"app": "shop"},
+			wantDescription: "web tier of shop",
+			wantRules: []paasv1.SecurityGroupRule{
+				{Direction: "ingress", Protocol: "tcp", Ports: "443", CIDR: "10.0.0.0/16", Description: "shop from load balancers"},
+				{Direction: "egress", Protocol: "udp", Ports: "53"},
+			},
+		},
+		{
+			name:            "overrides",
+			params:          map[string]string{"app": "shop", "port": "8443", "lb": "10.1.0.0/24"},
+			wantDescription: "web tier of shop",
+			wantRules: []paasv1.SecurityGroupRule{
+				{Direction: "ingress", Protocol: "tcp", Ports: "8443", CIDR: "10.1.0.0/24", Description: "shop from load balancers"},
+				{Direction: "egress", Protocol: "udp", Ports: "53"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			description, rules, err := Template(webTier, tt.params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if description != tt.wantDescription {
+				t.Errorf("description = %q, want %q", description, tt.wantDescription)
+			}
+			if !reflect.DeepEqual(rules, tt.wantRules) {
+				t.Errorf("rules = %+v, want %+v", rules, tt.wantRules)
+			}
+		})
+	}
+}
+
+func TestTemplateAllFields(t *testing.T) {
+	spec := paasv1.SecurityGroupTemplateSpec{
+		Parameters: []paasv1.TemplateParameter{{Name: "v", Default: "x"}},
+		Rules: []paasv1.SecurityGroupRule{{
+			Direction:    "{{ .v }}",
+			Ethertype:    "{{ .v }}",
+			Protocol:     "{{ .v }}",
+			Ports:        "{{ .v }}",
+			Service:      "{{ .v }}",
+			CIDR:         "{{ .v }}",
+			AddressGroup: "{{ .v }}",
+			Description:  "{{ .v }}",
+			ExpiresAt:    "{{ .v }}",
+			TTL:          "{{ .v }}",
+			Schedule:     &paasv1.RuleSchedule{Cron: "{{ .v }}", Duration: "{{ .v }}", TimeZone: "{{ .v }}"},
+			Action:       "{{ .v }}",
+			Priority:     10,
+			Stateless:    true,
+		}},
+	}
+	_, rules, err := Template(spec, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []paasv1.SecurityGroupRule{{
+		Direction: "x", Ethertype: "x", Protocol: "x", Ports: "x", Service: "x", CIDR: "x", AddressGroup: "x",
+		Description: "x", ExpiresAt: "x", TTL: "x",
+		Schedule: &paasv1.RuleSchedule{Cron: "x", Duration: "x", TimeZone: "x"},
+		Action:   "x", Priority: 10, Stateless: true,
+	}}
+	if !reflect.DeepEqual(rules, want) {
+		t.Errorf("rules = %+v, want %+v", rules, want)
+	}
+	if spec.Rules[0].Schedule.Cron != "{{ .v }}" {
+		t.Errorf("template schedule changed to %+v", spec.Rules[0].Schedule)
+	}
+}
+
+func TestTemplateError(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    paasv1.SecurityGroupTemplateSpec
+		params  map[string]string
+		wantErr string
+	}{
+		{
+			name:    "missing required",
+			spec:    webTier,
+			wantErr: "missing required parameters: app",
+		},
+		{
+			name:    "unknown",
+			spec:    webTier,
+			params:  map[string]string{"app": "shop", "tier": "web", "env": "prod"},
+			wantErr: "unknown parameters: env, tier",
+		},
+		{
+			name: "undeclared reference",
+			spec: paasv1.SecurityGroupTemplateSpec{
+				Rules: []paasv1.SecurityGroupRule{{Direction: "ingress", Ports: "{{ .port }}"}},
+			},
+			wantErr: `template: rules[0].ports:1:3: executing "rules[0].ports" at <.port>: map has no entry for key "port"`,
+		},
+		{
+			name: "undeclared reference in schedule",
+			spec: paasv1.SecurityGroupTemplateSpec{
+				Rules: []paasv1.SecurityGroupRule{{Direction: "ingress", Schedule: &paasv1.RuleSchedule{Cron: "{{ .cron }}", Duration: "1h"}}},
+			},
+			wantErr: `template: rules[0].schedule.cron:1:3: executing "rules[0].schedule.cron" at <.cron>: map has no entry for key "cron"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := Template(tt.spec, tt.params)
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("Template() error = %v, want %s", err, tt.wantErr)
+			}
+		})
+	}
+}
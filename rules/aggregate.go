@@ -0,0 +1,157 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rules
+
+import (
+	"fmt"
+	"net"
+	"sort"
+)
+
+// Aggregate removes duplicate rules and rules covered by other rules, and merges
+// overlapping or adjacent port ranges and sibling CIDRs. The result is sorted by Key.
+func Aggregate(rules []Rule) []Rule {
+	out := append([]Rule(nil), rules...)
+	for {
+		n := len(out)
+		out = removeCovered(out)
+		out = mergeCIDRs(out)
+		out = mergePorts(out)
+		// 每次合并都会减少规则数量，数量不变说明已无可合并的规则
+		if len(out) == n {
+			break
+		}
+	}
+	Sort(out)
+	return out
+}
+
+// removeCovered drops every rule that is covered by another rule. Of two identical rules
+// the first one is kept.
+func removeCovered(rules []Rule) []Rule {
+	dropped := make([]bool, len(rules))
+	for i := range rules {
+		for j := range rules {
+			if i == j || dropped[j] {
+				continue
+			}
+			if rules[j].Covers(rules[i]) && (j < i || !rules[i].Covers(rules[j])) {
+				dropped[i] = true
+				if rules[j].Description == "" {
+					rules[j].Description = rules[i].Description
+				}
+				break
+			}
+		}
+	}
+	out := make([]Rule, 0, len(rules))
+	for i, r := range rules {
+		if !dropped[i] {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// mergeCIDRs replaces two rules that only differ in sibling CIDRs, such as 10.0.0.0/25
+// and 10.0.0.128/25, with a single rule for their parent network.
+func mergeCIDRs(rules []Rule) []Rule {
+	out := append([]Rule(nil), rules...)
+	for merged := true; merged; {
+		merged = false
+	search:
+		for i := range out {
+			for j := i + 1; j < len(out); j++ {
+				parent, ok := siblings(out[i], out[j])
+				if !ok {
+					continue
+				}
+				out[i].CIDR = parent.String()
+				if out[i].Description == "" {
+					out[i].Description = out[j].Description
+				}
+				out = append(out[:j], out[j+1:]...)
+				merged = true
+				break search
+			}
+		}
+	}
+	return out
+}
+
+// siblings returns the parent network if the rules are identical except for two CIDRs
+// that together make up the parent.
+func siblings(a, b Rule) (*net.IPNet, bool) {
+	if a.Direction != b.Direction || a.Protocol != b.Protocol || a.PortMin != b.PortMin || a.PortMax != b.PortMax || !a.sameHandling(b) {
+		return nil, false
+	}
+	na, nb := a.Network(), b.Network()
+	aOnes, aBits := na.Mask.Size()
+	bOnes, bBits := nb.Mask.Size()
+	if aOnes != bOnes || aBits != bBits || aOnes == 0 || na.IP.Equal(nb.IP) {
+		return nil, false
+	}
+	mask := net.CIDRMask(aOnes-1, aBits)
+	if !na.IP.Mask(mask).Equal(nb.IP.Mask(mask)) {
+		return nil, false
+	}
+	return &net.IPNet{IP: na.IP.Mask(mask), Mask: mask}, true
+}
+
+// mergePorts merges the overlapping or adjacent port ranges of rules that only differ in
+// their ports.
+func mergePorts(rules []Rule) []Rule {
+	groups := map[string][]Rule{}
+	var order []string
+	var out []Rule
+	for _, r := range rules {
+		if r.allPorts() {
+			out = append(out, r)
+			continue
+		}
+		k := fmt.Sprintf("%s/%s/%s/%s/%d/%t", r.Direction, r.Protocol, r.CIDR, r.Action, r.Priority, r.Stateless)
+		if _, ok := groups[k]; !ok {
+			order = append(order, k)
+		}
+		groups[k] = append(groups[k], r)
+	}
+	for _, k := range order {
+		group := groups[k]
+		sort.SliceStable(group, func(i, j int) bool { return group[i].PortMin < group[j].PortMin })
+		cur := group[0]
+		for _, r := range group[1:] {
+			if r.PortMin <= cur.PortMax+1 {
+				if r.PortMax > cur.PortMax {
+					cur.PortMax = r.PortMax
+				}
+				if cur.Description == "" {
+					cur.Description = r.Description
+				}
+				continue
+			}
+			out = append(out, cur)
+			cur = r
+		}
+		out = append(out, cur)
+	}
+	for i := range out {
+		if out[i].PortMin == 1 && out[i].PortMax == 65535 {
+			out[i].PortMin, out[i].PortMax = 0, 0
+		}
+	}
+	return out
+}
@@ -0,0 +1,148 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rules
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	paasv1 "security-group/api/v1"
+)
+
+// RemoteRule is a rule that exists in DCS.
+type RemoteRule struct {
+	Rule
+	// Id of the rule in DCS.
+	Id string
+}
+
+// Change is a single call to DCS.
+type Change struct {
+	// Action is paasv1.PlanActionCreateRule or paasv1.PlanActionDeleteRule.
+	Action string
+	Rule   Rule
+	// RemoteId is the DCS id of the rule to delete.
+	RemoteId string
+}
+
+func (c Change) String() string {
+	if c.RemoteId != "" {
+		return fmt.Sprintf("%s %s (%s)", c.Action, c.Rule, c.RemoteId)
+	}
+	return fmt.Sprintf("%s %s", c.Action, c.Rule)
+}
+
+// Plan is an ordered list of changes that turns the remote rules into the desired rules.
+type Plan []Change
+
+// Diff returns the minimal plan that makes the remote rules match the desired rules.
+// Rules are matched by Key, so a rule whose description changed is left alone.
+// Deny rules are created first and deleted last, and allow rules are created before
+// allow rules are deleted. Every intermediate state therefore only allows traffic that
+// is allowed before or after the plan, even when rules change their priority, and
+// traffic allowed both before and after the plan is never interrupted. Duplicate remote
+// rules are deleted.
+func Diff(desired []Rule, remote []RemoteRule) Plan {
+	have := map[string]bool{}
+	var deletes Plan
+	want := map[string]bool{}
+	for _, r := range desired {
+		want[r.Key()] = true
+	}
+	for _, r := range remote {
+		k := r.Key()
+		if want[k] && !have[k] {
+			have[k] = true
+			continue
+		}
+		deletes = append(deletes, Change{Action: paasv1.PlanActionDeleteRule, Rule: r.Rule, RemoteId: r.Id})
+	}
+
+	var plan Plan
+	created := map[string]bool{}
+	for _, r := range desired {
+		k := r.Key()
+		if have[k] || created[k] {
+			continue
+		}
+		created[k] = true
+		plan = append(plan, Change{Action: paasv1.PlanActionCreateRule, Rule: r})
+	}
+	sortChanges(plan)
+	sortChanges(deletes)
+	plan = append(plan, deletes...)
+	sort.SliceStable(plan, func(i, j int) bool { return phase(plan[i]) < phase(plan[j]) })
+	return plan
+}
+
+// phase returns the position of the change in the order of a plan: creating deny rules,
+// creating allow rules, deleting allow rules, deleting deny rules.
+func phase(c Change) int {
+	switch {
+	case c.Action == paasv1.PlanActionCreateRule && c.Rule.Deny():
+		return 0
+	case c.Action == paasv1.PlanActionCreateRule:
+		return 1
+	case !c.Rule.Deny():
+		return 2
+	default:
+		return 3
+	}
+}
+
+// Creates returns the number of rules the plan creates.
+func (p Plan) Creates() int {
+	n := 0
+	for _, c := range p {
+		if c.Action == paasv1.PlanActionCreateRule {
+			n++
+		}
+	}
+	return n
+}
+
+// Deletes returns the number of rules the plan deletes.
+func (p Plan) Deletes() int {
+	return len(p) - p.Creates()
+}
+
+// Summary describes the plan in a single line, e.g. for an Event.
+func (p Plan) Summary() string {
+	changes := make([]string, 0, len(p))
+	for _, c := range p {
+		changes = append(changes, c.String())
+	}
+	return fmt.Sprintf("%d to create, %d to delete: %s", p.Creates(), p.Deletes(), strings.Join(changes, "; "))
+}
+
+// Status returns the plan in the format of the SecurityGroup status.
+func (p Plan) Status() []paasv1.PlannedChange {
+	if len(p) == 0 {
+		return nil
+	}
+	changes := make([]paasv1.PlannedChange, 0, len(p))
+	for _, c := range p {
+		rule := c.Rule.Spec()
+		changes = append(changes, paasv1.PlannedChange{Action: c.Action, Rule: &rule, RuleId: c.RemoteId})
+	}
+	return changes
+}
+
+func sortChanges(p Plan) {
+	sort.SliceStable(p, func(i, j int) bool { return p[i].Rule.Key() < p[j].Rule.Key() })
+}
@@ -0,0 +1,157 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rules
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	rule := func(ports, cidr string) Rule {
+		min, max, err := ParsePorts(ports)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := New("ingress", "tcp", min, max, cidr, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+	remote := func(id string, r Rule) RemoteRule {
+		return RemoteRule{Rule: r, Id: id}
+	}
+	handled := func(r Rule, action string, priority int32) Rule {
+		r.Action, r.Priority = action, priority
+		return r
+	}
+
+	tests := []struct {
+		name    string
+		desired []Rule
+		remote  []RemoteRule
+		want    []string
+	}{
+		{
+			name:    "in sync",
+			desired: []Rule{rule("22", "10.0.0.0/8")},
+			remote:  []RemoteRule{remote("1", rule("22", "10.0.0.0/8"))},
+			want:    nil,
+		},
+		{
+			name:    "create missing",
+			desired: []Rule{rule("22", "10.0.0.0/8"), rule("80", "0.0.0.0/0")},
+			remote:  []RemoteRule{remote("1", rule("22", "10.0.0.0/8"))},
+			want:    []string{"CreateRule ingress tcp 80 0.0.0.0/0"},
+		},
+		{
+			name:    "delete extra",
+			desired: []Rule{rule("22", "10.0.0.0/8")},
+			remote:  []RemoteRule{remote("1", rule("22", "10.0.0.0/8")), remote("2", rule("3389", "0.0.0.0/0"))},
+			want:    []string{"DeleteRule ingress tcp 3389 0.0.0.0/0 (2)"},
+		},
+		{
+			name:    "creates before deletes",
+			desired: []Rule{rule("22", "10.0.0.0/8"), rule("443", "10.0.0.0/8")},
+			remote:  []RemoteRule{remote("1", rule("22", "10.0.0.0/16")), remote("2", rule("80", "10.0.0.0/8"))},
+			want: []string{
+				"CreateRule ingress tcp 22 10.0.0.0/8",
+				"CreateRule ingress tcp 443 10.0.0.0/8",
+				"DeleteRule ingress tcp 22 10.0.0.0/16 (1)",
+				"DeleteRule ingress tcp 80 10.0.0.0/8 (2)",
+			},
+		},
+		{
+			name:    "duplicate remote rules",
+			desired: []Rule{rule("22", "10.0.0.0/8")},
+			remote:  []RemoteRule{remote("1", rule("22", "10.0.0.0/8")), remote("2", rule("22", "10.0.0.0/8"))},
+			want:    []string{"DeleteRule ingress tcp 22 10.0.0.0/8 (2)"},
+		},
+		{
+			name:    "duplicate desired rules",
+			desired: []Rule{rule("22", "10.0.0.0/8"), rule("22", "10.0.0.0/8")},
+			want:    []string{"CreateRule ingress tcp 22 10.0.0.0/8"},
+		},
+		{
+			name: "description change is ignored",
+			desired: []Rule{func() Rule {
+				r := rule("22", "10.0.0.0/8")
+				r.Description = "ssh"
+				return r
+			}()},
+			remote: []RemoteRule{remote("1", rule("22", "10.0.0.0/8"))},
+			want:   nil,
+		},
+		{
+			name: "deny rules created first and deleted last",
+			desired: []Rule{
+				handled(rule("22", "0.0.0.0/0"), "deny", 10),
+				handled(rule("22", "10.0.0.0/8"), "", 20),
+			},
+			remote: []RemoteRule{
+				remote("1", handled(rule("22", "0.0.0.0/0"), "deny", 20)),
+				remote("2", handled(rule("22", "10.0.0.0/8"), "", 10)),
+			},
+			want: []string{
+				"CreateRule ingress tcp 22 0.0.0.0/0 deny priority 10",
+				"CreateRule ingress tcp 22 10.0.0.0/8 priority 20",
+				"DeleteRule ingress tcp 22 10.0.0.0/8 priority 10 (2)",
+				"DeleteRule ingress tcp 22 0.0.0.0/0 deny priority 20 (1)",
+			},
+		},
+		{
+			name:   "delete everything",
+			remote: []RemoteRule{remote("2", rule("80", "0.0.0.0/0")), remote("1", rule("22", "0.0.0.0/0"))},
+			want: []string{
+				"DeleteRule ingress tcp 22 0.0.0.0/0 (1)",
+				"DeleteRule ingress tcp 80 0.0.0.0/0 (2)",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := Diff(tt.desired, tt.remote)
+			var got []string
+			for _, c := range plan {
+				got = append(got, c.String())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Diff() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlanStatus(t *testing.T) {
+	r, _ := New("egress", "udp", 53, 53, "10.0.0.2", "dns")
+	plan := Plan{
+		{Action: "CreateRule", Rule: r},
+		{Action: "DeleteRule", Rule: r, RemoteId: "7"},
+	}
+	if plan.Creates() != 1 || plan.Deletes() != 1 {
+		t.Errorf("Creates() = %d, Deletes() = %d", plan.Creates(), plan.Deletes())
+	}
+	status := plan.Status()
+	if len(status) != 2 || status[1].RuleId != "7" || status[0].Rule.CIDR != "10.0.0.2/32" || status[0].Rule.Ports != "53" {
+		t.Errorf("Status() = %+v", status)
+	}
+	if Plan(nil).Status() != nil {
+		t.Errorf("empty plan should have no status")
+	}
+}
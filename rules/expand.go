@@ -0,0 +1,65 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rules
+
+import (
+	"fmt"
+	"sort"
+
+	paasv1 "security-group/api/v1"
+)
+
+// Expand replaces each rule that references an address group with one rule for each CIDR
+// of the group. groups maps the names of the address groups to their CIDRs; a group
+// without CIDRs expands to no rules.
+func Expand(specRules []paasv1.SecurityGroupRule, groups map[string][]string) ([]paasv1.SecurityGroupRule, error) {
+	expanded := make([]paasv1.SecurityGroupRule, 0, len(specRules))
+	for i, rule := range specRules {
+		if rule.AddressGroup == "" {
+			expanded = append(expanded, rule)
+			continue
+		}
+		if rule.CIDR != "" {
+			return nil, fmt.Errorf("rule %d: cidr and addressGroup cannot both be set", i)
+		}
+		cidrs, ok := groups[rule.AddressGroup]
+		if !ok {
+			return nil, fmt.Errorf("rule %d: unknown address group %q", i, rule.AddressGroup)
+		}
+		for _, cidr := range cidrs {
+			r := rule
+			r.AddressGroup = ""
+			r.CIDR = cidr
+			expanded = append(expanded, r)
+		}
+	}
+	return expanded, nil
+}
+
+// AddressGroups returns the sorted names of the address groups the rules reference.
+func AddressGroups(specRules []paasv1.SecurityGroupRule) []string {
+	seen := map[string]bool{}
+	var names []string
+	for _, rule := range specRules {
+		if rule.AddressGroup != "" && !seen[rule.AddressGroup] {
+			seen[rule.AddressGroup] = true
+			names = append(names, rule.AddressGroup)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,438 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package rules canonicalizes security group rules so that rules from different sources
+// can be deduplicated, aggregated and compared with the rules in DCS.
+package rules
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	paasv1 "security-group/api/v1"
+	"security-group/schedule"
+)
+
+// Protocols that are not written as their lower-case name.
+var protocolAliases = map[string]string{
+	"any":       "",
+	"all":       "",
+	"*":         "",
+	"-1":        "",
+	"1":         "icmp",
+	"6":         "tcp",
+	"17":        "udp",
+	"58":        "icmpv6",
+	"icmp6":     "icmpv6",
+	"ipv6-icmp": "icmpv6",
+	"132":       "sctp",
+}
+
+// Rule is the canonical form of a security group rule.
+type Rule struct {
+	// Direction is either ingress or egress.
+	Direction string
+	// Protocol is the lower-case protocol name, or empty for any protocol.
+	Protocol string
+	// PortMin and PortMax are the inclusive port range. Both are 0 if the rule applies to all ports.
+	PortMin int32
+	PortMax int32
+	// CIDR is the remote network with its host bits cleared.
+	CIDR string
+	// Action is paasv1.ActionDeny, or empty for allow.
+	Action string
+	// Priority is the evaluation order of the rule within its direction, or 0 for rules
+	// evaluated after all rules with a priority.
+	Priority int32
+	// Stateless reports whether the rule does not track connections.
+	Stateless bool
+	// Description is not part of the rule's identity.
+	Description string
+}
+
+// New returns the canonical rule for the given values. An empty cidr means any address
+// and a zero port range means all ports.
+func New(direction, protocol string, portMin, portMax int32, cidr, description string) (Rule, error) {
+	r := Rule{
+		Direction:   strings.ToLower(strings.TrimSpace(direction)),
+		Protocol:    CanonicalProtocol(protocol),
+		PortMin:     portMin,
+		PortMax:     portMax,
+		Description: description,
+	}
+	if r.Direction != paasv1.DirectionIngress && r.Direction != paasv1.DirectionEgress {
+		return Rule{}, fmt.Errorf("invalid direction %q", direction)
+	}
+
+	if portMin != 0 || portMax != 0 {
+		if !hasPorts(r.Protocol) {
+			return Rule{}, fmt.Errorf("ports are only supported for tcp, udp and sctp, not %q", protocol)
+		}
+		if portMin < 1 || portMax > 65535 || portMin > portMax {
+			return Rule{}, fmt.Errorf("invalid port range %d-%d", portMin, portMax)
+		}
+		if portMin == 1 && portMax == 65535 {
+			r.PortMin, r.PortMax = 0, 0
+		}
+	}
+
+	n, err := ParseCIDR(cidr)
+	if err != nil {
+		return Rule{}, err
+	}
+	r.CIDR = n.String()
+	return r, nil
+}
+
+// Parse returns the canonical rule for a rule of a SecurityGroup spec. Rules referencing
+// an address group or a service must be expanded first.
+func Parse(rule paasv1.SecurityGroupRule) (Rule, error) {
+	if rule.AddressGroup != "" {
+		return Rule{}, fmt.Errorf("address group %q is not expanded", rule.AddressGroup)
+	}
+	if rule.Service != "" {
+		return Rule{}, fmt.Errorf("service %q is not expanded", rule.Service)
+	}
+	min, max, err := ParsePorts(rule.Ports)
+	if err != nil {
+		return Rule{}, err
+	}
+	cidr, err := ruleCIDR(rule)
+	if err != nil {
+		return Rule{}, err
+	}
+	if _, err := Expiry(rule, time.Time{}); err != nil {
+		return Rule{}, err
+	}
+	if rule.Schedule != nil {
+		if _, err := schedule.ForRule(rule.Schedule); err != nil {
+			return Rule{}, err
+		}
+	}
+	r, err := New(rule.Direction, rule.Protocol, min, max, cidr, rule.Description)
+	if err != nil {
+		return Rule{}, err
+	}
+	switch rule.Action {
+	case "", paasv1.ActionAllow:
+	case paasv1.ActionDeny:
+		r.Action = paasv1.ActionDeny
+	default:
+		return Rule{}, fmt.Errorf("invalid action %q", rule.Action)
+	}
+	if rule.Priority < 0 {
+		return Rule{}, fmt.Errorf("invalid priority %d", rule.Priority)
+	}
+	r.Priority = rule.Priority
+	r.Stateless = rule.Stateless
+	// icmp 只用于 IPv4，icmpv6 只用于 IPv6
+	switch {
+	case r.Protocol == "icmp" && r.Ethertype() == paasv1.EthertypeIPv6:
+		return Rule{}, fmt.Errorf("protocol icmp cannot be used for IPv6, use icmpv6")
+	case r.Protocol == "icmpv6" && r.Ethertype() == paasv1.EthertypeIPv4:
+		return Rule{}, fmt.Errorf("protocol icmpv6 cannot be used for IPv4, use icmp")
+	}
+	return r, nil
+}
+
+// ruleCIDR returns the CIDR of the rule, or the network of any address of its ethertype.
+// A CIDR of the other family than the ethertype is an error.
+func ruleCIDR(rule paasv1.SecurityGroupRule) (string, error) {
+	switch rule.Ethertype {
+	case "", paasv1.EthertypeIPv4, paasv1.EthertypeIPv6:
+	default:
+		return "", fmt.Errorf("invalid ethertype %q", rule.Ethertype)
+	}
+	if strings.TrimSpace(rule.CIDR) == "" {
+		return AnyCIDR(rule.Ethertype), nil
+	}
+	if rule.Ethertype == "" {
+		return rule.CIDR, nil
+	}
+	n, err := ParseCIDR(rule.CIDR)
+	if err != nil {
+		return "", err
+	}
+	if family(n) != rule.Ethertype {
+		return "", fmt.Errorf("cidr %q is not an %s network", rule.CIDR, rule.Ethertype)
+	}
+	return rule.CIDR, nil
+}
+
+// AnyCIDR returns the network of any address of the ethertype. An empty ethertype means IPv4.
+func AnyCIDR(ethertype string) string {
+	if ethertype == paasv1.EthertypeIPv6 {
+		return "::/0"
+	}
+	return "0.0.0.0/0"
+}
+
+// Normalize parses the rules, removes duplicates and rules covered by other rules, and
+// aggregates adjacent port ranges and CIDRs. The result is sorted by Key.
+func Normalize(specRules []paasv1.SecurityGroupRule) ([]Rule, error) {
+	rules := make([]Rule, 0, len(specRules))
+	for i, sr := range specRules {
+		r, err := Parse(sr)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %v", i, err)
+		}
+		rules = append(rules, r)
+	}
+	return Aggregate(rules), nil
+}
+
+// ParsePorts parses a single port such as "22" or an inclusive range such as "8000-8080".
+// An empty string means all ports and is returned as 0-0.
+func ParsePorts(ports string) (int32, int32, error) {
+	ports = strings.TrimSpace(ports)
+	if ports == "" {
+		return 0, 0, nil
+	}
+	parts := strings.SplitN(ports, "-", 2)
+	min, err := strconv.ParseInt(strings.TrimSpace(parts[0]), 10, 32)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid ports %q", ports)
+	}
+	max := min
+	if len(parts) == 2 {
+		if max, err = strconv.ParseInt(strings.TrimSpace(parts[1]), 10, 32); err != nil {
+			return 0, 0, fmt.Errorf("invalid ports %q", ports)
+		}
+	}
+	if min < 1 || max > 65535 || min > max {
+		return 0, 0, fmt.Errorf("invalid ports %q", ports)
+	}
+	return int32(min), int32(max), nil
+}
+
+// Expiry returns when a temporary rule expires if it was first applied at appliedAt,
+// or the zero time if the rule does not expire. ExpiresAt takes precedence over TTL.
+func Expiry(rule paasv1.SecurityGroupRule, appliedAt time.Time) (time.Time, error) {
+	if rule.ExpiresAt != "" {
+		t, err := time.Parse(time.RFC3339, rule.ExpiresAt)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid expiresAt %q", rule.ExpiresAt)
+		}
+		return t, nil
+	}
+	if rule.TTL != "" {
+		d, err := time.ParseDuration(rule.TTL)
+		if err != nil || d <= 0 {
+			return time.Time{}, fmt.Errorf("invalid ttl %q", rule.TTL)
+		}
+		return appliedAt.Add(d), nil
+	}
+	return time.Time{}, nil
+}
+
+// Key identifies the traffic matched by the rule and how it is handled, ignoring its
+// description. Allow rules without priority that track connections have no suffix.
+func (r Rule) Key() string {
+	k := fmt.Sprintf("%s/%s/%d-%d/%s", r.Direction, r.Protocol, r.PortMin, r.PortMax, r.CIDR)
+	if r.Action != "" {
+		k += "/" + r.Action
+	}
+	if r.Priority != 0 {
+		k += fmt.Sprintf("/p%d", r.Priority)
+	}
+	if r.Stateless {
+		k += "/stateless"
+	}
+	return k
+}
+
+func (r Rule) String() string {
+	return r.Spec().String()
+}
+
+// Ports returns the port range in the format of the SecurityGroup spec.
+func (r Rule) Ports() string {
+	switch {
+	case r.PortMin == 0 && r.PortMax == 0:
+		return ""
+	case r.PortMin == r.PortMax:
+		return strconv.Itoa(int(r.PortMin))
+	default:
+		return fmt.Sprintf("%d-%d", r.PortMin, r.PortMax)
+	}
+}
+
+// Spec returns the rule in the format of the SecurityGroup spec.
+func (r Rule) Spec() paasv1.SecurityGroupRule {
+	return paasv1.SecurityGroupRule{
+		Direction:   r.Direction,
+		Protocol:    r.Protocol,
+		Ports:       r.Ports(),
+		CIDR:        r.CIDR,
+		Description: r.Description,
+		Action:      r.Action,
+		Priority:    r.Priority,
+		Stateless:   r.Stateless,
+	}
+}
+
+// Ethertype returns the family of the CIDR of the rule, paasv1.EthertypeIPv4 or
+// paasv1.EthertypeIPv6.
+func (r Rule) Ethertype() string {
+	if strings.Contains(r.CIDR, ":") {
+		return paasv1.EthertypeIPv6
+	}
+	return paasv1.EthertypeIPv4
+}
+
+// Network returns the parsed CIDR of the rule.
+func (r Rule) Network() *net.IPNet {
+	_, n, _ := net.ParseCIDR(r.CIDR)
+	return n
+}
+
+// allPorts reports whether the rule applies to all ports of its protocol.
+func (r Rule) allPorts() bool {
+	return r.PortMin == 0 && r.PortMax == 0
+}
+
+// Covers reports whether all traffic matched by o is also matched by r and handled the
+// same way. Rules of different priorities never cover each other, because a rule between
+// them may handle the traffic differently.
+func (r Rule) Covers(o Rule) bool {
+	return r.sameHandling(o) && r.Matches(o)
+}
+
+// Matches reports whether all traffic matched by o is also matched by r, regardless of
+// how the rules handle it.
+func (r Rule) Matches(o Rule) bool {
+	if r.Direction != o.Direction {
+		return false
+	}
+	if r.Protocol != "" && r.Protocol != o.Protocol {
+		return false
+	}
+	if !r.allPorts() && (o.allPorts() || o.PortMin < r.PortMin || o.PortMax > r.PortMax) {
+		return false
+	}
+	return ContainsNet(r.Network(), o.Network())
+}
+
+// sameHandling reports whether both rules have the same action, priority and statefulness.
+func (r Rule) sameHandling(o Rule) bool {
+	return r.Action == o.Action && r.Priority == o.Priority && r.Stateless == o.Stateless
+}
+
+// Before reports whether r is evaluated before o: rules with a lower priority first, rules
+// without a priority last, and deny rules before allow rules of the same priority.
+func (r Rule) Before(o Rule) bool {
+	if r.Priority != o.Priority {
+		return o.Priority == 0 || (r.Priority != 0 && r.Priority < o.Priority)
+	}
+	return r.Deny() && !o.Deny()
+}
+
+// Deny reports whether the rule denies the traffic it matches.
+func (r Rule) Deny() bool {
+	return r.Action == paasv1.ActionDeny
+}
+
+// ValidatePriorities returns an error if two rules of the same direction have the same
+// priority. Rules must be validated before address groups and services are expanded,
+// since the rules expanded from a single rule share its priority.
+func ValidatePriorities(specRules []paasv1.SecurityGroupRule) error {
+	used := map[string]int{}
+	for i, rule := range specRules {
+		if rule.Priority == 0 {
+			continue
+		}
+		k := fmt.Sprintf("%s/%d", strings.ToLower(rule.Direction), rule.Priority)
+		if j, ok := used[k]; ok {
+			return fmt.Errorf("rule %d: priority %d is already used by rule %d", i, rule.Priority, j)
+		}
+		used[k] = i
+	}
+	return nil
+}
+
+// Sort sorts the rules by Key.
+func Sort(rules []Rule) {
+	sort.Slice(rules, func(i, j int) bool { return rules[i].Key() < rules[j].Key() })
+}
+
+// CanonicalProtocol returns the lower-case name of the protocol, or empty for any protocol.
+func CanonicalProtocol(protocol string) string {
+	protocol = strings.ToLower(strings.TrimSpace(protocol))
+	if alias, ok := protocolAliases[protocol]; ok {
+		return alias
+	}
+	return protocol
+}
+
+func hasPorts(protocol string) bool {
+	return protocol == "tcp" || protocol == "udp" || protocol == "sctp"
+}
+
+// ParseCIDR parses an IPv4 or IPv6 CIDR or a single address and clears the host bits.
+// An empty string means any IPv4 address. IPv4-mapped IPv6 addresses such as
+// "::ffff:10.0.0.1" are rejected, because it is ambiguous which family they belong to.
+func ParseCIDR(cidr string) (*net.IPNet, error) {
+	cidr = strings.TrimSpace(cidr)
+	if cidr == "" {
+		cidr = "0.0.0.0/0"
+	}
+	if !strings.Contains(cidr, "/") {
+		ip := net.ParseIP(cidr)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid cidr %q", cidr)
+		}
+		if ip4 := ip.To4(); ip4 != nil {
+			if strings.Contains(cidr, ":") {
+				return nil, fmt.Errorf("invalid cidr %q: IPv4-mapped IPv6 addresses are not supported", cidr)
+			}
+			return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, nil
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+	}
+	ip, n, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cidr %q", cidr)
+	}
+	if ip.To4() != nil && strings.Contains(cidr, ":") {
+		return nil, fmt.Errorf("invalid cidr %q: IPv4-mapped IPv6 addresses are not supported", cidr)
+	}
+	return n, nil
+}
+
+// family returns the ethertype of the network.
+func family(n *net.IPNet) string {
+	if _, bits := n.Mask.Size(); bits == 128 {
+		return paasv1.EthertypeIPv6
+	}
+	return paasv1.EthertypeIPv4
+}
+
+// ContainsNet reports whether network a contains network b.
+func ContainsNet(a, b *net.IPNet) bool {
+	aOnes, aBits := a.Mask.Size()
+	bOnes, bBits := b.Mask.Size()
+	return aBits == bBits && aOnes <= bOnes && a.Contains(b.IP)
+}
+
+// OverlapsNet reports whether networks a and b of the same family share an address,
+// which is the case if one contains the other.
+func OverlapsNet(a, b *net.IPNet) bool {
+	return ContainsNet(a, b) || ContainsNet(b, a)
+}
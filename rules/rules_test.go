@@ -0,0 +1,469 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rules
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	paasv1 "security-group/api/v1"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    paasv1.SecurityGroupRule
+		want    Rule
+		wantErr bool
+	}{
+		{
+			name: "protocol case",
+			rule: paasv1.SecurityGroupRule{Direction: "ingress", Protocol: "TCP", Ports: "22", CIDR: "10.0.0.0/8"},
+			want: Rule{Direction: "ingress", Protocol: "tcp", PortMin: 22, PortMax: 22, CIDR: "10.0.0.0/8"},
+		},
+		{
+			name: "direction case",
+			rule: paasv1.SecurityGroupRule{Direction: "Egress", Protocol: "udp", Ports: "53"},
+			want: Rule{Direction: "egress", Protocol: "udp", PortMin: 53, PortMax: 53, CIDR: "0.0.0.0/0"},
+		},
+		{
+			name: "any protocol aliases",
+			rule: paasv1.SecurityGroupRule{Direction: "ingress", Protocol: "ALL"},
+			want: Rule{Direction: "ingress", CIDR: "0.0.0.0/0"},
+		},
+		{
+			name: "numeric protocol",
+			rule: paasv1.SecurityGroupRule{Direction: "ingress", Protocol: "6", Ports: "80"},
+			want: Rule{Direction: "ingress", Protocol: "tcp", PortMin: 80, PortMax: 80, CIDR: "0.0.0.0/0"},
+		},
+		{
+			name: "port range",
+			rule: paasv1.SecurityGroupRule{Direction: "ingress", Protocol: "tcp", Ports: " 8000 - 8080 "},
+			want: Rule{Direction: "ingress", Protocol: "tcp", PortMin: 8000, PortMax: 8080, CIDR: "0.0.0.0/0"},
+		},
+		{
+			name: "full port range means all ports",
+			rule: paasv1.SecurityGroupRule{Direction: "ingress", Protocol: "tcp", Ports: "1-65535"},
+			want: Rule{Direction: "ingress", Protocol: "tcp", CIDR: "0.0.0.0/0"},
+		},
+		{
+			name: "host bits cleared",
+			rule: paasv1.SecurityGroupRule{Direction: "ingress", CIDR: "10.1.2.3/16"},
+			want: Rule{Direction: "ingress", CIDR: "10.1.0.0/16"},
+		},
+		{
+			name: "single ipv4 address",
+			rule: paasv1.SecurityGroupRule{Direction: "ingress", CIDR: "192.168.1.10"},
+			want: Rule{Direction: "ingress", CIDR: "192.168.1.10/32"},
+		},
+		{
+			name: "ipv6 cidr",
+			rule: paasv1.SecurityGroupRule{Direction: "ingress", CIDR: "2001:DB8::1/32"},
+			want: Rule{Direction: "ingress", CIDR: "2001:db8::/32"},
+		},
+		{
+			name: "single ipv6 address",
+			rule: paasv1.SecurityGroupRule{Direction: "ingress", CIDR: "2001:db8::1"},
+			want: Rule{Direction: "ingress", CIDR: "2001:db8::1/128"},
+		},
+		{
+			name: "ipv6 ethertype without cidr",
+			rule: paasv1.SecurityGroupRule{Direction: "ingress", Ethertype: "IPv6", Protocol: "tcp", Ports: "443"},
+			want: Rule{Direction: "ingress", Protocol: "tcp", PortMin: 443, PortMax: 443, CIDR: "::/0"},
+		},
+		{
+			name: "ipv6 ethertype with cidr",
+			rule: paasv1.SecurityGroupRule{Direction: "ingress", Ethertype: "IPv6", CIDR: "fd00::/64"},
+			want: Rule{Direction: "ingress", CIDR: "fd00::/64"},
+		},
+		{
+			name: "icmpv6 aliases",
+			rule: paasv1.SecurityGroupRule{Direction: "ingress", Protocol: "ipv6-icmp", CIDR: "fd00::/64"},
+			want: Rule{Direction: "ingress", Protocol: "icmpv6", CIDR: "fd00::/64"},
+		},
+		{
+			name:    "ethertype of the other family than the cidr",
+			rule:    paasv1.SecurityGroupRule{Direction: "ingress", Ethertype: "IPv6", CIDR: "10.0.0.0/8"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid ethertype",
+			rule:    paasv1.SecurityGroupRule{Direction: "ingress", Ethertype: "IPv5"},
+			wantErr: true,
+		},
+		{
+			name:    "icmp for ipv6",
+			rule:    paasv1.SecurityGroupRule{Direction: "ingress", Protocol: "icmp", CIDR: "fd00::/64"},
+			wantErr: true,
+		},
+		{
+			name:    "icmpv6 for ipv4",
+			rule:    paasv1.SecurityGroupRule{Direction: "ingress", Protocol: "icmpv6"},
+			wantErr: true,
+		},
+		{
+			name:    "ipv4-mapped ipv6 address",
+			rule:    paasv1.SecurityGroupRule{Direction: "ingress", CIDR: "::ffff:10.0.0.1"},
+			wantErr: true,
+		},
+		{
+			name:    "ipv4-mapped ipv6 cidr",
+			rule:    paasv1.SecurityGroupRule{Direction: "ingress", CIDR: "::ffff:10.0.0.0/104"},
+			wantErr: true,
+		},
+		{
+			name: "deny with priority",
+			rule: paasv1.SecurityGroupRule{Direction: "ingress", Protocol: "tcp", Ports: "22", Action: "deny", Priority: 10, Stateless: true},
+			want: Rule{Direction: "ingress", Protocol: "tcp", PortMin: 22, PortMax: 22, CIDR: "0.0.0.0/0", Action: "deny", Priority: 10, Stateless: true},
+		},
+		{
+			name: "allow is the default action",
+			rule: paasv1.SecurityGroupRule{Direction: "ingress", Action: "allow"},
+			want: Rule{Direction: "ingress", CIDR: "0.0.0.0/0"},
+		},
+		{
+			name:    "invalid action",
+			rule:    paasv1.SecurityGroupRule{Direction: "ingress", Action: "drop"},
+			wantErr: true,
+		},
+		{
+			name:    "negative priority",
+			rule:    paasv1.SecurityGroupRule{Direction: "ingress", Priority: -1},
+			wantErr: true,
+		},
+		{
+			name:    "invalid direction",
+			rule:    paasv1.SecurityGroupRule{Direction: "inbound"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid cidr",
+			rule:    paasv1.SecurityGroupRule{Direction: "ingress", CIDR: "10.0.0.0/33"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid ports",
+			rule:    paasv1.SecurityGroupRule{Direction: "ingress", Protocol: "tcp", Ports: "http"},
+			wantErr: true,
+		},
+		{
+			name:    "reversed port range",
+			rule:    paasv1.SecurityGroupRule{Direction: "ingress", Protocol: "tcp", Ports: "90-80"},
+			wantErr: true,
+		},
+		{
+			name:    "port out of range",
+			rule:    paasv1.SecurityGroupRule{Direction: "ingress", Protocol: "tcp", Ports: "0"},
+			wantErr: true,
+		},
+		{
+			name:    "ports without port protocol",
+			rule:    paasv1.SecurityGroupRule{Direction: "ingress", Protocol: "icmp", Ports: "8"},
+			wantErr: true,
+		},
+		{
+			name:    "ports with any protocol",
+			rule:    paasv1.SecurityGroupRule{Direction: "ingress", Ports: "22"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.rule)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("Parse() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tcp := func(ports, cidr string) paasv1.SecurityGroupRule {
+		return paasv1.SecurityGroupRule{Direction: "ingress", Protocol: "tcp", Ports: ports, CIDR: cidr}
+	}
+
+	tests := []struct {
+		name  string
+		rules []paasv1.SecurityGroupRule
+		want  []string
+	}{
+		{
+			name:  "empty",
+			rules: nil,
+			want:  []string{},
+		},
+		{
+			name:  "duplicates",
+			rules: []paasv1.SecurityGroupRule{tcp("22", "10.0.0.0/8"), tcp("22", "10.0.0.0/8"), {Direction: "ingress", Protocol: "TCP", Ports: "22-22", CIDR: "10.1.1.1/8"}},
+			want:  []string{"ingress/tcp/22-22/10.0.0.0/8"},
+		},
+		{
+			name:  "contained cidr",
+			rules: []paasv1.SecurityGroupRule{tcp("22", "10.0.0.0/24"), tcp("22", "10.0.0.0/16")},
+			want:  []string{"ingress/tcp/22-22/10.0.0.0/16"},
+		},
+		{
+			name:  "contained port range",
+			rules: []paasv1.SecurityGroupRule{tcp("8080", "10.0.0.0/16"), tcp("8000-9000", "10.0.0.0/16")},
+			want:  []string{"ingress/tcp/8000-9000/10.0.0.0/16"},
+		},
+		{
+			name:  "covered by any protocol",
+			rules: []paasv1.SecurityGroupRule{tcp("22", "10.0.0.0/24"), {Direction: "ingress", CIDR: "10.0.0.0/16"}},
+			want:  []string{"ingress//0-0/10.0.0.0/16"},
+		},
+		{
+			name:  "covered by all ports",
+			rules: []paasv1.SecurityGroupRule{tcp("22", "10.0.0.0/24"), tcp("", "10.0.0.0/24")},
+			want:  []string{"ingress/tcp/0-0/10.0.0.0/24"},
+		},
+		{
+			name:  "other protocol not covered",
+			rules: []paasv1.SecurityGroupRule{tcp("53", "10.0.0.0/24"), {Direction: "ingress", Protocol: "udp", Ports: "53", CIDR: "10.0.0.0/24"}},
+			want:  []string{"ingress/tcp/53-53/10.0.0.0/24", "ingress/udp/53-53/10.0.0.0/24"},
+		},
+		{
+			name:  "other direction not covered",
+			rules: []paasv1.SecurityGroupRule{tcp("22", "10.0.0.0/24"), {Direction: "egress", CIDR: "0.0.0.0/0"}},
+			want:  []string{"egress//0-0/0.0.0.0/0", "ingress/tcp/22-22/10.0.0.0/24"},
+		},
+		{
+			name:  "overlapping port ranges",
+			rules: []paasv1.SecurityGroupRule{tcp("8000-8080", "10.0.0.0/8"), tcp("8050-8100", "10.0.0.0/8")},
+			want:  []string{"ingress/tcp/8000-8100/10.0.0.0/8"},
+		},
+		{
+			name:  "adjacent port ranges",
+			rules: []paasv1.SecurityGroupRule{tcp("80", "10.0.0.0/8"), tcp("81", "10.0.0.0/8"), tcp("82-90", "10.0.0.0/8")},
+			want:  []string{"ingress/tcp/80-90/10.0.0.0/8"},
+		},
+		{
+			name:  "port ranges with a gap",
+			rules: []paasv1.SecurityGroupRule{tcp("80", "10.0.0.0/8"), tcp("443", "10.0.0.0/8")},
+			want:  []string{"ingress/tcp/443-443/10.0.0.0/8", "ingress/tcp/80-80/10.0.0.0/8"},
+		},
+		{
+			name:  "port ranges adding up to all ports",
+			rules: []paasv1.SecurityGroupRule{tcp("1-1024", "10.0.0.0/8"), tcp("1025-65535", "10.0.0.0/8")},
+			want:  []string{"ingress/tcp/0-0/10.0.0.0/8"},
+		},
+		{
+			name:  "sibling cidrs",
+			rules: []paasv1.SecurityGroupRule{tcp("22", "10.0.0.0/25"), tcp("22", "10.0.0.128/25")},
+			want:  []string{"ingress/tcp/22-22/10.0.0.0/24"},
+		},
+		{
+			name:  "sibling cidrs merged repeatedly",
+			rules: []paasv1.SecurityGroupRule{tcp("22", "10.0.0.0/26"), tcp("22", "10.0.0.64/26"), tcp("22", "10.0.0.128/25")},
+			want:  []string{"ingress/tcp/22-22/10.0.0.0/24"},
+		},
+		{
+			name:  "non sibling cidrs",
+			rules: []paasv1.SecurityGroupRule{tcp("22", "10.0.0.128/25"), tcp("22", "10.0.1.0/25")},
+			want:  []string{"ingress/tcp/22-22/10.0.0.128/25", "ingress/tcp/22-22/10.0.1.0/25"},
+		},
+		{
+			name:  "sibling cidrs with different ports",
+			rules: []paasv1.SecurityGroupRule{tcp("22", "10.0.0.0/25"), tcp("80", "10.0.0.128/25")},
+			want:  []string{"ingress/tcp/22-22/10.0.0.0/25", "ingress/tcp/80-80/10.0.0.128/25"},
+		},
+		{
+			name:  "merged cidrs enable port merge",
+			rules: []paasv1.SecurityGroupRule{tcp("22", "10.0.0.0/25"), tcp("22", "10.0.0.128/25"), tcp("23", "10.0.0.0/24")},
+			want:  []string{"ingress/tcp/22-23/10.0.0.0/24"},
+		},
+		{
+			name:  "merged ports enable cidr merge",
+			rules: []paasv1.SecurityGroupRule{tcp("22", "10.0.0.0/25"), tcp("23", "10.0.0.0/25"), tcp("22-23", "10.0.0.128/25")},
+			want:  []string{"ingress/tcp/22-23/10.0.0.0/24"},
+		},
+		{
+			name:  "ipv6 contained and sibling",
+			rules: []paasv1.SecurityGroupRule{tcp("443", "2001:db8::/33"), tcp("443", "2001:db8:8000::/33"), tcp("443", "2001:db8:1::/48")},
+			want:  []string{"ingress/tcp/443-443/2001:db8::/32"},
+		},
+		{
+			name:  "ipv4 and ipv6 kept apart",
+			rules: []paasv1.SecurityGroupRule{tcp("443", "0.0.0.0/0"), tcp("443", "::/0")},
+			want:  []string{"ingress/tcp/443-443/0.0.0.0/0", "ingress/tcp/443-443/::/0"},
+		},
+		{
+			name: "different handling not merged",
+			rules: []paasv1.SecurityGroupRule{
+				tcp("22", "10.0.0.0/8"),
+				{Direction: "ingress", Protocol: "tcp", Ports: "22", CIDR: "10.1.0.0/16", Priority: 5},
+				{Direction: "ingress", Protocol: "tcp", Ports: "23", CIDR: "10.0.0.0/8", Action: "deny"},
+				{Direction: "ingress", Protocol: "tcp", Ports: "22", CIDR: "10.0.0.0/9", Stateless: true},
+			},
+			want: []string{"ingress/tcp/22-22/10.0.0.0/8", "ingress/tcp/22-22/10.0.0.0/9/stateless", "ingress/tcp/22-22/10.1.0.0/16/p5", "ingress/tcp/23-23/10.0.0.0/8/deny"},
+		},
+		{
+			name: "same handling merged",
+			rules: []paasv1.SecurityGroupRule{
+				{Direction: "ingress", Protocol: "tcp", Ports: "22", CIDR: "10.0.0.0/25", Action: "deny", Priority: 5},
+				{Direction: "ingress", Protocol: "tcp", Ports: "22", CIDR: "10.0.0.128/25", Action: "deny", Priority: 5},
+				{Direction: "ingress", Protocol: "tcp", Ports: "23", CIDR: "10.0.0.0/24", Action: "deny", Priority: 5},
+			},
+			want: []string{"ingress/tcp/22-23/10.0.0.0/24/deny/p5"},
+		},
+		{
+			name:  "halves merged per family",
+			rules: []paasv1.SecurityGroupRule{tcp("443", "0.0.0.0/1"), tcp("443", "::/1"), tcp("443", "128.0.0.0/1"), tcp("443", "8000::/1"), {Direction: "ingress", Ethertype: "IPv6", Protocol: "tcp", Ports: "444"}},
+			want:  []string{"ingress/tcp/443-443/0.0.0.0/0", "ingress/tcp/443-444/::/0"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Normalize(tt.rules)
+			if err != nil {
+				t.Fatalf("Normalize() error = %v", err)
+			}
+			keys := []string{}
+			for _, r := range got {
+				keys = append(keys, r.Key())
+			}
+			if !reflect.DeepEqual(keys, tt.want) {
+				t.Errorf("Normalize() = %v, want %v", keys, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeKeepsDescription(t *testing.T) {
+	got, err := Normalize([]paasv1.SecurityGroupRule{
+		{Direction: "ingress", Protocol: "tcp", Ports: "22", CIDR: "10.0.0.0/24", Description: "ssh"},
+		{Direction: "ingress", Protocol: "tcp", Ports: "22", CIDR: "10.0.0.0/16"},
+	})
+	if err != nil {
+		t.Fatalf("Normalize() error = %v", err)
+	}
+	if len(got) != 1 || got[0].Description != "ssh" {
+		t.Errorf("Normalize() = %+v, want a single rule described as ssh", got)
+	}
+}
+
+func TestNormalizeError(t *testing.T) {
+	_, err := Normalize([]paasv1.SecurityGroupRule{
+		{Direction: "ingress", Protocol: "tcp", Ports: "22"},
+		{Direction: "ingress", Protocol: "tcp", Ports: "99999"},
+	})
+	if err == nil || err.Error() != `rule 1: invalid ports "99999"` {
+		t.Errorf("Normalize() error = %v", err)
+	}
+}
+
+func TestRuleSpecRoundTrip(t *testing.T) {
+	for _, sr := range []paasv1.SecurityGroupRule{
+		{Direction: "ingress", Protocol: "tcp", Ports: "22", CIDR: "10.0.0.0/8", Description: "ssh"},
+		{Direction: "egress", Protocol: "udp", Ports: "1000-2000", CIDR: "2001:db8::/32"},
+		{Direction: "ingress", Protocol: "icmp", CIDR: "0.0.0.0/0"},
+		{Direction: "ingress", Protocol: "tcp", Ports: "22", CIDR: "0.0.0.0/0", Action: "deny", Priority: 100, Stateless: true},
+	} {
+		r, err := Parse(sr)
+		if err != nil {
+			t.Fatalf("Parse(%+v) error = %v", sr, err)
+		}
+		if got := r.Spec(); got != sr {
+			t.Errorf("Spec() = %+v, want %+v", got, sr)
+		}
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	appliedAt := time.Date(2020, 6, 1, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		rule    paasv1.SecurityGroupRule
+		want    time.Time
+		wantErr bool
+	}{
+		{rule: paasv1.SecurityGroupRule{}},
+		{rule: paasv1.SecurityGroupRule{TTL: "90m"}, want: appliedAt.Add(90 * time.Minute)},
+		{rule: paasv1.SecurityGroupRule{ExpiresAt: "2020-06-01T18:00:00+08:00"}, want: time.Date(2020, 6, 1, 10, 0, 0, 0, time.UTC)},
+		{rule: paasv1.SecurityGroupRule{ExpiresAt: "2020-06-01T18:00:00Z", TTL: "1h"}, want: time.Date(2020, 6, 1, 18, 0, 0, 0, time.UTC)},
+		{rule: paasv1.SecurityGroupRule{TTL: "1 hour"}, wantErr: true},
+		{rule: paasv1.SecurityGroupRule{TTL: "-1h"}, wantErr: true},
+		{rule: paasv1.SecurityGroupRule{ExpiresAt: "tomorrow"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := Expiry(tt.rule, appliedAt)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Expiry(%+v) error = %v, wantErr %v", tt.rule, err, tt.wantErr)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("Expiry(%+v) = %v, want %v", tt.rule, got, tt.want)
+		}
+	}
+}
+
+func TestExpand(t *testing.T) {
+	groups := map[string][]string{
+		"partners": {"203.0.113.0/24", "198.51.100.7"},
+		"empty":    nil,
+	}
+	got, err := Expand([]paasv1.SecurityGroupRule{
+		{Direction: "ingress", Protocol: "tcp", Ports: "443", AddressGroup: "partners", Description: "partners"},
+		{Direction: "ingress", Protocol: "tcp", Ports: "22", AddressGroup: "empty"},
+		{Direction: "egress", Protocol: "udp", Ports: "53", CIDR: "10.0.0.2"},
+	}, groups)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []paasv1.SecurityGroupRule{
+		{Direction: "ingress", Protocol: "tcp", Ports: "443", CIDR: "203.0.113.0/24", Description: "partners"},
+		{Direction: "ingress", Protocol: "tcp", Ports: "443", CIDR: "198.51.100.7", Description: "partners"},
+		{Direction: "egress", Protocol: "udp", Ports: "53", CIDR: "10.0.0.2"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expand() = %+v, want %+v", got, want)
+	}
+
+	for _, rule := range []paasv1.SecurityGroupRule{
+		{Direction: "ingress", AddressGroup: "unknown"},
+		{Direction: "ingress", AddressGroup: "partners", CIDR: "10.0.0.0/8"},
+	} {
+		if _, err := Expand([]paasv1.SecurityGroupRule{rule}, groups); err == nil {
+			t.Errorf("Expand(%+v) should fail", rule)
+		}
+	}
+	if _, err := Parse(paasv1.SecurityGroupRule{Direction: "ingress", AddressGroup: "partners"}); err == nil {
+		t.Errorf("Parse() should fail for a rule that is not expanded")
+	}
+}
+
+func TestValidatePriorities(t *testing.T) {
+	valid := []paasv1.SecurityGroupRule{
+		{Direction: "ingress", Priority: 10},
+		{Direction: "egress", Priority: 10},
+		{Direction: "ingress", Priority: 20},
+		{Direction: "ingress"},
+		{Direction: "ingress"},
+	}
+	if err := ValidatePriorities(valid); err != nil {
+		t.Errorf("ValidatePriorities() error = %v", err)
+	}
+	duplicate := append(valid, paasv1.SecurityGroupRule{Direction: "Ingress", Priority: 20})
+	if err := ValidatePriorities(duplicate); err == nil || err.Error() != "rule 5: priority 20 is already used by rule 2" {
+		t.Errorf("ValidatePriorities() error = %v", err)
+	}
+}
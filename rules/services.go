@@ -0,0 +1,133 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rules
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	paasv1 "security-group/api/v1"
+)
+
+// Services are the services rules can reference by name.
+type Services struct {
+	// Ports are the protocols and ports of the services.
+	Ports map[string][]paasv1.ServicePort
+	// Errors tell why services cannot be used, because ServiceCatalogs define them more
+	// than once or invalidly. Only rules that reference them fail to expand.
+	Errors map[string]error
+}
+
+// BuiltinServices are the services rules can reference without a ServiceCatalog.
+var BuiltinServices = map[string][]paasv1.ServicePort{
+	"dns":            {{Protocol: "udp", Ports: "53"}, {Protocol: "tcp", Ports: "53"}},
+	"etcd":           {{Protocol: "tcp", Ports: "2379-2380"}},
+	"http":           {{Protocol: "tcp", Ports: "80"}},
+	"https":          {{Protocol: "tcp", Ports: "443"}},
+	"kube-apiserver": {{Protocol: "tcp", Ports: "6443"}},
+	"ldap":           {{Protocol: "tcp", Ports: "389"}},
+	"ldaps":          {{Protocol: "tcp", Ports: "636"}},
+	"mongodb":        {{Protocol: "tcp", Ports: "27017"}},
+	"mysql":          {{Protocol: "tcp", Ports: "3306"}},
+	"ntp":            {{Protocol: "udp", Ports: "123"}},
+	"ping":           {{Protocol: "icmp"}},
+	"ping6":          {{Protocol: "icmpv6"}},
+	"postgres":       {{Protocol: "tcp", Ports: "5432"}},
+	"rdp":            {{Protocol: "tcp", Ports: "3389"}},
+	"redis":          {{Protocol: "tcp", Ports: "6379"}},
+	"smtp":           {{Protocol: "tcp", Ports: "25"}},
+	"ssh":            {{Protocol: "tcp", Ports: "22"}},
+}
+
+// Catalog returns the built-in services overridden and extended by the services of the
+// catalogs. A service defined by more than one catalog, or with invalid ports, cannot be
+// used, but the other services of the catalogs can.
+func Catalog(catalogs []paasv1.ServiceCatalog) Services {
+	services := Services{Ports: map[string][]paasv1.ServicePort{}, Errors: map[string]error{}}
+	for name, ports := range BuiltinServices {
+		services.Ports[name] = ports
+	}
+	definedBy := map[string]string{}
+	for _, c := range catalogs {
+		for _, s := range c.Spec.Services {
+			if other, ok := definedBy[s.Name]; ok {
+				services.Errors[s.Name] = fmt.Errorf("service %q is defined by both ServiceCatalogs %s and %s", s.Name, other, c.Name)
+				continue
+			}
+			definedBy[s.Name] = c.Name
+			services.Ports[s.Name] = s.Ports
+			if err := validateService(s); err != nil {
+				services.Errors[s.Name] = fmt.Errorf("ServiceCatalog %s service %q: %v", c.Name, s.Name, err)
+			}
+		}
+	}
+	return services
+}
+
+// validateService returns an error if the ports of the service are invalid.
+func validateService(s paasv1.NamedService) error {
+	for _, p := range s.Ports {
+		min, max, err := ParsePorts(p.Ports)
+		if err != nil {
+			return err
+		}
+		if _, err := New(paasv1.DirectionIngress, p.Protocol, min, max, "", ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExpandServices replaces each rule that references a service with one rule for each of
+// the protocols and ports of the service.
+func ExpandServices(specRules []paasv1.SecurityGroupRule, services Services) ([]paasv1.SecurityGroupRule, error) {
+	expanded := make([]paasv1.SecurityGroupRule, 0, len(specRules))
+	for i, rule := range specRules {
+		if rule.Service == "" {
+			expanded = append(expanded, rule)
+			continue
+		}
+		if rule.Protocol != "" || rule.Ports != "" {
+			return nil, fmt.Errorf("rule %d: service cannot be combined with protocol and ports", i)
+		}
+		if err := services.Errors[rule.Service]; err != nil {
+			return nil, fmt.Errorf("rule %d: %v", i, err)
+		}
+		ports, ok := services.Ports[rule.Service]
+		if !ok {
+			return nil, fmt.Errorf("rule %d: unknown service %q, known services are %s", i, rule.Service, services.names())
+		}
+		for _, p := range ports {
+			r := rule
+			r.Service = ""
+			r.Protocol = p.Protocol
+			r.Ports = p.Ports
+			expanded = append(expanded, r)
+		}
+	}
+	return expanded, nil
+}
+
+func (s Services) names() string {
+	names := make([]string, 0, len(s.Ports))
+	for name := range s.Ports {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,133 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rules
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	paasv1 "security-group/api/v1"
+)
+
+func TestExpandServices(t *testing.T) {
+	services := Catalog([]paasv1.ServiceCatalog{{
+		ObjectMeta: metav1.ObjectMeta{Name: "platform"},
+		Spec: paasv1.ServiceCatalogSpec{Services: []paasv1.NamedService{
+			{Name: "https", Ports: []paasv1.ServicePort{{Protocol: "tcp", Ports: "443"}, {Protocol: "tcp", Ports: "8443"}}},
+			{Name: "billing", Ports: []paasv1.ServicePort{{Protocol: "tcp", Ports: "9000-9010"}}},
+		}},
+	}})
+
+	got, err := ExpandServices([]paasv1.SecurityGroupRule{
+		{Direction: "egress", Service: "dns", CIDR: "10.0.0.2"},
+		{Direction: "ingress", Service: "https", Description: "web"},
+		{Direction: "ingress", Service: "billing", CIDR: "10.1.0.0/16"},
+		{Direction: "ingress", Protocol: "tcp", Ports: "22"},
+	}, services)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []paasv1.SecurityGroupRule{
+		{Direction: "egress", Protocol: "udp", Ports: "53", CIDR: "10.0.0.2"},
+		{Direction: "egress", Protocol: "tcp", Ports: "53", CIDR: "10.0.0.2"},
+		{Direction: "ingress", Protocol: "tcp", Ports: "443", Description: "web"},
+		{Direction: "ingress", Protocol: "tcp", Ports: "8443", Description: "web"},
+		{Direction: "ingress", Protocol: "tcp", Ports: "9000-9010", CIDR: "10.1.0.0/16"},
+		{Direction: "ingress", Protocol: "tcp", Ports: "22"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ExpandServices() = %+v, want %+v", got, want)
+	}
+}
+
+func TestExpandServicesError(t *testing.T) {
+	tests := []struct {
+		rule    paasv1.SecurityGroupRule
+		wantErr string
+	}{
+		{paasv1.SecurityGroupRule{Direction: "ingress", Service: "gopher"}, `rule 0: unknown service "gopher"`},
+		{paasv1.SecurityGroupRule{Direction: "ingress", Service: "ssh", Ports: "2222"}, "rule 0: service cannot be combined with protocol and ports"},
+	}
+	for _, tt := range tests {
+		_, err := ExpandServices([]paasv1.SecurityGroupRule{tt.rule}, Catalog(nil))
+		if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+			t.Errorf("ExpandServices(%+v) error = %v, want %s", tt.rule, err, tt.wantErr)
+		}
+	}
+	if _, err := Parse(paasv1.SecurityGroupRule{Direction: "ingress", Service: "ssh"}); err == nil {
+		t.Errorf("Parse() should fail for a rule that is not expanded")
+	}
+}
+
+func TestCatalogError(t *testing.T) {
+	catalog := func(name, service string, ports ...paasv1.ServicePort) paasv1.ServiceCatalog {
+		return paasv1.ServiceCatalog{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec:       paasv1.ServiceCatalogSpec{Services: []paasv1.NamedService{{Name: service, Ports: ports}}},
+		}
+	}
+	tests := []struct {
+		catalogs []paasv1.ServiceCatalog
+		wantErr  string
+	}{
+		{
+			catalogs: []paasv1.ServiceCatalog{
+				catalog("a", "app", paasv1.ServicePort{Protocol: "tcp", Ports: "80"}),
+				catalog("b", "app", paasv1.ServicePort{Protocol: "tcp", Ports: "81"}),
+			},
+			wantErr: `rule 0: service "app" is defined by both ServiceCatalogs a and b`,
+		},
+		{
+			catalogs: []paasv1.ServiceCatalog{catalog("a", "app", paasv1.ServicePort{Protocol: "tcp", Ports: "http"})},
+			wantErr:  `rule 0: ServiceCatalog a service "app"`,
+		},
+		{
+			catalogs: []paasv1.ServiceCatalog{catalog("a", "app", paasv1.ServicePort{Protocol: "icmp", Ports: "8"})},
+			wantErr:  `rule 0: ServiceCatalog a service "app"`,
+		},
+		{
+			// 覆盖内置服务的定义无效时，不退回内置服务
+			catalogs: []paasv1.ServiceCatalog{catalog("a", "ssh", paasv1.ServicePort{Protocol: "tcp", Ports: "0"})},
+			wantErr:  `rule 0: ServiceCatalog a service "ssh"`,
+		},
+	}
+	for _, tt := range tests {
+		services := Catalog(append(tt.catalogs, catalog("c", "billing", paasv1.ServicePort{Protocol: "tcp", Ports: "9000"})))
+		for _, name := range []string{"app", "ssh"} {
+			if _, ok := services.Errors[name]; !ok {
+				continue
+			}
+			_, err := ExpandServices([]paasv1.SecurityGroupRule{{Direction: "ingress", Service: name}}, services)
+			if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+				t.Errorf("ExpandServices(%s) error = %v, want %s", name, err, tt.wantErr)
+			}
+		}
+		if len(services.Errors) != 1 {
+			t.Errorf("Catalog(%+v) errors = %v, want one", tt.catalogs, services.Errors)
+		}
+		// 其他服务不受影响
+		if _, err := ExpandServices([]paasv1.SecurityGroupRule{
+			{Direction: "ingress", Service: "billing"},
+			{Direction: "ingress", Service: "https"},
+		}, services); err != nil {
+			t.Errorf("ExpandServices() of unaffected services error = %v", err)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	paasv1 "security-group/api/v1"
+)
+
+func TestCronNext(t *testing.T) {
+	at := func(s string) time.Time {
+		tm, err := time.Parse("2006-01-02 15:04", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tm
+	}
+	tests := []struct {
+		expr string
+		from string
+		want string
+	}{
+		{"0 1 * * *", "2020-06-01 00:30", "2020-06-01 01:00"},
+		{"0 1 * * *", "2020-06-01 01:00", "2020-06-02 01:00"},
+		{"*/15 * * * *", "2020-06-01 10:01", "2020-06-01 10:15"},
+		{"30 9-17 * * 1-5", "2020-06-05 18:00", "2020-06-08 09:30"},
+		{"0 0 1 * *", "2020-06-15 12:00", "2020-07-01 00:00"},
+		{"0 0 31 12 *", "2020-06-15 12:00", "2020-12-31 00:00"},
+		{"0 12 * * 7", "2020-06-01 00:00", "2020-06-07 12:00"},
+		{"0 0 13 * 5", "2020-06-01 00:00", "2020-06-05 00:00"},
+		{"0,30 22 * * *", "2020-06-01 22:10", "2020-06-01 22:30"},
+		{"0 0 29 2 *", "2021-01-01 00:00", "2024-02-29 00:00"},
+	}
+	for _, tt := range tests {
+		c, err := ParseCron(tt.expr)
+		if err != nil {
+			t.Fatalf("ParseCron(%q) error = %v", tt.expr, err)
+		}
+		if got := c.Next(at(tt.from)); !got.Equal(at(tt.want)) {
+			t.Errorf("%q.Next(%s) = %v, want %s", tt.expr, tt.from, got, tt.want)
+		}
+	}
+}
+
+func TestParseCronError(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "5-1 * * * *", "*/0 * * * *", "a * * * *"} {
+		if _, err := ParseCron(expr); err == nil {
+			t.Errorf("ParseCron(%q) should fail", expr)
+		}
+	}
+}
+
+func TestWindowActive(t *testing.T) {
+	shanghai, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		t.Skip("time zone data is not available")
+	}
+	// 北京时间每天 01:00-04:00
+	w, err := ForRule(&paasv1.RuleSchedule{Cron: "0 1 * * *", Duration: "3h", TimeZone: "Asia/Shanghai"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		now        time.Time
+		wantActive bool
+		wantNext   time.Time
+	}{
+		{time.Date(2020, 6, 1, 0, 30, 0, 0, shanghai), false, time.Date(2020, 6, 1, 1, 0, 0, 0, shanghai)},
+		{time.Date(2020, 6, 1, 1, 0, 0, 0, shanghai), true, time.Date(2020, 6, 1, 4, 0, 0, 0, shanghai)},
+		{time.Date(2020, 6, 1, 3, 59, 30, 0, shanghai), true, time.Date(2020, 6, 1, 4, 0, 0, 0, shanghai)},
+		{time.Date(2020, 6, 1, 4, 0, 0, 0, shanghai), false, time.Date(2020, 6, 2, 1, 0, 0, 0, shanghai)},
+		{time.Date(2020, 6, 1, 4, 0, 30, 0, shanghai), false, time.Date(2020, 6, 2, 1, 0, 0, 0, shanghai)},
+		// UTC 18:00 是北京时间 02:00
+		{time.Date(2020, 5, 31, 18, 0, 0, 0, time.UTC), true, time.Date(2020, 6, 1, 4, 0, 0, 0, shanghai)},
+	}
+	for _, tt := range tests {
+		active, next := w.Active(tt.now)
+		if active != tt.wantActive || !next.Equal(tt.wantNext) {
+			t.Errorf("Active(%v) = %v, %v, want %v, %v", tt.now, active, next, tt.wantActive, tt.wantNext)
+		}
+	}
+}
+
+func TestWindowOverlapping(t *testing.T) {
+	w, err := ForRule(&paasv1.RuleSchedule{Cron: "0 * * * *", Duration: "90m"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2020, 6, 1, 10, 15, 0, 0, time.UTC)
+	active, next := w.Active(now)
+	if !active || next.Sub(now) < maxWindow {
+		t.Errorf("Active() = %v, %v, want an open window for at least %v", active, next, maxWindow)
+	}
+}
+
+func TestForRuleError(t *testing.T) {
+	for _, s := range []paasv1.RuleSchedule{
+		{Cron: "0 1 * *", Duration: "1h"},
+		{Cron: "0 1 * * *", Duration: "1 hour"},
+		{Cron: "0 1 * * *", Duration: "1h", TimeZone: "Mars/Olympus"},
+	} {
+		if _, err := ForRule(&s); err == nil {
+			t.Errorf("ForRule(%+v) should fail", s)
+		}
+	}
+}
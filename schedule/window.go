@@ -0,0 +1,77 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package schedule
+
+import (
+	"fmt"
+	"time"
+
+	paasv1 "security-group/api/v1"
+)
+
+// Window is a recurring time window that starts on a cron schedule and lasts for a fixed duration.
+type Window struct {
+	Cron     *Cron
+	Duration time.Duration
+	Location *time.Location
+}
+
+// ForRule returns the window of a scheduled rule.
+func ForRule(s *paasv1.RuleSchedule) (*Window, error) {
+	c, err := ParseCron(s.Cron)
+	if err != nil {
+		return nil, err
+	}
+	d, err := time.ParseDuration(s.Duration)
+	if err != nil || d <= 0 {
+		return nil, fmt.Errorf("invalid duration %q", s.Duration)
+	}
+	loc := time.UTC
+	if s.TimeZone != "" {
+		if loc, err = time.LoadLocation(s.TimeZone); err != nil {
+			return nil, fmt.Errorf("invalid time zone %q", s.TimeZone)
+		}
+	}
+	return &Window{Cron: c, Duration: d, Location: loc}, nil
+}
+
+// Active reports whether now is inside a window, and returns the time the window opens
+// or closes next. Overlapping windows are merged. The next transition is the zero time
+// if the window never opens again.
+func (w *Window) Active(now time.Time) (bool, time.Time) {
+	now = now.In(w.Location)
+	// 只有在 (now-duration, now] 内开始的窗口才包含 now
+	start := w.Cron.Next(now.Add(-w.Duration - time.Minute))
+	for !start.IsZero() && !start.After(now) && !start.Add(w.Duration).After(now) {
+		start = w.Cron.Next(start)
+	}
+	if start.IsZero() || start.After(now) {
+		return false, start
+	}
+	end := start.Add(w.Duration)
+	for end.Sub(now) < maxWindow {
+		next := w.Cron.Next(start)
+		if next.IsZero() || next.After(end) {
+			break
+		}
+		start, end = next, next.Add(w.Duration)
+	}
+	return true, end
+}
+
+// maxWindow limits how far overlapping windows are merged, e.g. for a window that is always open.
+const maxWindow = 7 * 24 * time.Hour
@@ -0,0 +1,82 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	paasv1 "security-group/api/v1"
+)
+
+// SecurityGroupAnnotatorPath is the path the SecurityGroupAnnotator is served at.
+const SecurityGroupAnnotatorPath string = "/mutate-paas-unicom-cn-v1-securitygroup"
+
+// +kubebuilder:webhook:path=/mutate-paas-unicom-cn-v1-securitygroup,mutating=true,failurePolicy=fail,groups=paas.unicom.cn,resources=securitygroups,verbs=create;update,versions=v1,name=msecuritygroup.kb.io
+
+// SecurityGroupAnnotator records the user who last changed the spec of a SecurityGroup,
+// so that change requests name the requester.
+type SecurityGroupAnnotator struct {
+	decoder *admission.Decoder
+}
+
+// Handle sets paasv1.ChangedByAnnotation when the spec changes, and keeps its previous
+// value otherwise, so that it cannot be forged.
+func (a *SecurityGroupAnnotator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	sg := &paasv1.SecurityGroup{}
+	if err := a.decoder.Decode(req, sg); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	changedBy := req.UserInfo.Username
+	if req.Operation == admissionv1beta1.Update {
+		old := &paasv1.SecurityGroup{}
+		if err := a.decoder.DecodeRaw(req.OldObject, old); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		if reflect.DeepEqual(old.Spec, sg.Spec) {
+			changedBy = old.Annotations[paasv1.ChangedByAnnotation]
+		}
+	}
+	if sg.Annotations[paasv1.ChangedByAnnotation] == changedBy {
+		return admission.Allowed("")
+	}
+
+	if changedBy == "" {
+		delete(sg.Annotations, paasv1.ChangedByAnnotation)
+	} else {
+		if sg.Annotations == nil {
+			sg.Annotations = map[string]string{}
+		}
+		sg.Annotations[paasv1.ChangedByAnnotation] = changedBy
+	}
+	marshaled, err := json.Marshal(sg)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	return admission.PatchResponseFromRaw(req.Object.Raw, marshaled)
+}
+
+// InjectDecoder injects the decoder.
+func (a *SecurityGroupAnnotator) InjectDecoder(d *admission.Decoder) error {
+	a.decoder = d
+	return nil
+}
@@ -0,0 +1,158 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package webhooks contains the admission webhooks of the SecurityGroup APIs.
+package webhooks
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/go-logr/logr"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	paasv1 "security-group/api/v1"
+	"security-group/dcs"
+	"security-group/lint"
+	"security-group/planner"
+	"security-group/policy"
+	"security-group/render"
+	"security-group/rules"
+)
+
+// SecurityGroupValidatorPath is the path the SecurityGroupValidator is served at.
+const SecurityGroupValidatorPath string = "/validate-paas-unicom-cn-v1-securitygroup"
+
+// +kubebuilder:webhook:path=/validate-paas-unicom-cn-v1-securitygroup,mutating=false,failurePolicy=fail,groups=paas.unicom.cn,resources=securitygroups,verbs=create;update,versions=v1,name=vsecuritygroup.kb.io
+
+// SecurityGroupValidator rejects SecurityGroups with invalid rules, rules DCS does not
+// support or rules that violate a SecurityGroupPolicy, including the rules rendered from
+// their template. ObserveOnly SecurityGroups are not rejected for violations, since they
+// only reflect DCS. Templates and address groups that do not exist yet, and later changes
+// to them, are checked by the controller instead.
+type SecurityGroupValidator struct {
+	Client  client.Client
+	Log     logr.Logger
+	decoder *admission.Decoder
+}
+
+// Handle validates a created or updated SecurityGroup.
+func (v *SecurityGroupValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	sg := &paasv1.SecurityGroup{}
+	if err := v.decoder.Decode(req, sg); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	// 删除中的安全组只会移除 finalizer，不检查
+	if !sg.DeletionTimestamp.IsZero() {
+		return admission.Allowed("")
+	}
+	// status 通过子资源写入，不经过该 webhook；spec 不变的更新（如添加 finalizer、修改标签）不检查，
+	// 以免策略变化后无法修改元数据
+	if req.Operation == admissionv1beta1.Update {
+		old := &paasv1.SecurityGroup{}
+		if err := v.decoder.DecodeRaw(req.OldObject, old); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		if reflect.DeepEqual(old.Spec, sg.Spec) {
+			return admission.Allowed("")
+		}
+	}
+
+	if err := dcs.ValidateTags(sg.Spec.Tags); err != nil {
+		return admission.Denied(err.Error())
+	}
+	// 模板渲染出的规则排在 spec 的规则之前，与 planner.SpecRules 一致；尚不存在的模板由控制器报告
+	specRules := sg.Spec.Rules
+	if ref := sg.Spec.Template; ref != nil {
+		spec, _, err := planner.GetTemplate(ctx, v.Client, sg.Namespace, ref)
+		if client.IgnoreNotFound(err) != nil {
+			return admission.Errored(http.StatusInternalServerError, err)
+		}
+		if err == nil {
+			_, rendered, err := render.Template(spec, ref.Parameters)
+			if err != nil {
+				return admission.Denied(fmt.Sprintf("failed to render %s: %v", ref.Key(), err))
+			}
+			specRules = append(rendered, sg.Spec.Rules...)
+		}
+	}
+	if err := rules.ValidatePriorities(specRules); err != nil {
+		return admission.Denied(err.Error())
+	}
+	// 尚不存在的地址组视为空，由控制器报告
+	expanded, err := planner.Expand(ctx, v.Client, sg.Namespace, specRules, true)
+	if err != nil {
+		return admission.Denied(err.Error())
+	}
+	desired, err := rules.Normalize(expanded)
+	if err != nil {
+		return admission.Denied(err.Error())
+	}
+	// DCS 不支持的规则在准入时拒绝，而不是在调谐时才报错
+	for _, rule := range desired {
+		if err := dcs.Supported(rule); err != nil {
+			return admission.Denied(err.Error())
+		}
+	}
+	policies := &paasv1.SecurityGroupPolicyList{}
+	if err := v.Client.List(ctx, policies); err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	violations, err := policy.Check(sg.Namespace, desired, policies.Items)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	// 只观察的安全组反映 DCS 的现状，不修改 DCS，违反策略由控制器记录
+	if len(violations) > 0 && sg.Spec.ManagementPolicy != paasv1.ManagementPolicyObserveOnly {
+		messages := make([]string, 0, len(violations))
+		for _, violation := range violations {
+			messages = append(messages, violation.String())
+		}
+		v.Log.Info("拒绝违反安全策略的 SecurityGroup", "securitygroup", req.Namespace+"/"+req.Name, "violations", messages)
+		return admission.Denied(strings.Join(messages, "; "))
+	}
+	return v.lint(req, expanded)
+}
+
+// lint allows the SecurityGroup and reports the findings of the rule analyzer. Admission
+// responses of this API version cannot carry warnings, so the findings are recorded as the
+// reason of the response and as an audit annotation, and logged.
+func (v *SecurityGroupValidator) lint(req admission.Request, expanded []paasv1.SecurityGroupRule) admission.Response {
+	findings, err := lint.Analyze(expanded)
+	if err != nil || len(findings) == 0 {
+		return admission.Allowed("")
+	}
+	messages := make([]string, 0, len(findings))
+	for _, f := range findings {
+		messages = append(messages, f.String())
+	}
+	msg := strings.Join(messages, "; ")
+	v.Log.Info("SecurityGroup 的规则存在问题", "securitygroup", req.Namespace+"/"+req.Name, "findings", messages)
+	resp := admission.Allowed(msg)
+	resp.AuditAnnotations = map[string]string{"lint": msg}
+	return resp
+}
+
+// InjectDecoder injects the decoder.
+func (v *SecurityGroupValidator) InjectDecoder(d *admission.Decoder) error {
+	v.decoder = d
+	return nil
+}
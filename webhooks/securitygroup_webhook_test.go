@@ -0,0 +1,91 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	paasv1 "security-group/api/v1"
+)
+
+func TestSecurityGroupValidatorTemplate(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := paasv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	decoder, err := admission.NewDecoder(scheme)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := func(name, action string) *paasv1.SecurityGroupTemplate {
+		return &paasv1.SecurityGroupTemplate{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: name},
+			Spec: paasv1.SecurityGroupTemplateSpec{
+				Parameters: []paasv1.TemplateParameter{{Name: "port", Required: true}},
+				Rules:      []paasv1.SecurityGroupRule{{Direction: "ingress", Protocol: "tcp", Ports: "{{ .port }}", CIDR: "10.0.0.0/8", Action: action}},
+			},
+		}
+	}
+	v := &SecurityGroupValidator{
+		Client:  fake.NewFakeClientWithScheme(scheme, template("web", ""), template("deny", paasv1.ActionDeny)),
+		Log:     logf.Log,
+		decoder: decoder,
+	}
+
+	tests := []struct {
+		name    string
+		ref     paasv1.TemplateReference
+		allowed bool
+	}{
+		{name: "rendered", ref: paasv1.TemplateReference{Name: "web", Parameters: map[string]string{"port": "22"}}, allowed: true},
+		{name: "template not created yet", ref: paasv1.TemplateReference{Name: "db"}, allowed: true},
+		{name: "missing parameter", ref: paasv1.TemplateReference{Name: "web"}},
+		{name: "invalid rendered rule", ref: paasv1.TemplateReference{Name: "web", Parameters: map[string]string{"port": "ssh"}}},
+		{name: "rendered rule DCS does not support", ref: paasv1.TemplateReference{Name: "deny", Parameters: map[string]string{"port": "22"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ref := tt.ref
+			sg := &paasv1.SecurityGroup{
+				TypeMeta:   metav1.TypeMeta{APIVersion: paasv1.GroupVersion.String(), Kind: "SecurityGroup"},
+				ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "web"},
+				Spec:       paasv1.SecurityGroupSpec{Template: &ref},
+			}
+			raw, err := json.Marshal(sg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp := v.Handle(context.Background(), admission.Request{AdmissionRequest: admissionv1beta1.AdmissionRequest{
+				Operation: admissionv1beta1.Create,
+				Namespace: "ns",
+				Object:    runtime.RawExtension{Raw: raw},
+			}})
+			if resp.Allowed != tt.allowed {
+				t.Errorf("allowed = %v, want %v: %+v", resp.Allowed, tt.allowed, resp.Result)
+			}
+		})
+	}
+}
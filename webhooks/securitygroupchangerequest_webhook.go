@@ -0,0 +1,115 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhooks
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	paasv1 "security-group/api/v1"
+)
+
+// SecurityGroupChangeRequestValidatorPath is the path the SecurityGroupChangeRequestValidator is served at.
+const SecurityGroupChangeRequestValidatorPath string = "/validate-paas-unicom-cn-v1-securitygroupchangerequest"
+
+// +kubebuilder:webhook:path=/validate-paas-unicom-cn-v1-securitygroupchangerequest,mutating=false,failurePolicy=fail,groups=paas.unicom.cn,resources=securitygroupchangerequests;securitygroupchangerequests/status,verbs=create;update,versions=v1,name=vsecuritygroupchangerequest.kb.io
+
+// SecurityGroupChangeRequestValidator only lets the controller create change requests, keeps
+// their spec unchanged, and only lets members of the approver groups decide on them in the
+// status, never on their own changes. The controller sets requestedBy from the
+// paasv1.ChangedByAnnotation, which the SecurityGroupAnnotator sets from the user info of
+// the request that changed the spec.
+type SecurityGroupChangeRequestValidator struct {
+	// ApproverGroups are the groups whose members may approve or reject changes.
+	ApproverGroups []string
+	// ControllerUsername is the user the controller runs as, e.g. its service account.
+	ControllerUsername string
+	decoder            *admission.Decoder
+}
+
+// Handle validates a created or updated SecurityGroupChangeRequest or its status.
+func (v *SecurityGroupChangeRequestValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	cr := &paasv1.SecurityGroupChangeRequest{}
+	if err := v.decoder.Decode(req, cr); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	if req.Operation == admissionv1beta1.Create {
+		switch {
+		case req.UserInfo.Username != v.ControllerUsername:
+			return admission.Denied("change requests are only created by the controller")
+		case cr.Spec.RequestedBy == "":
+			return admission.Denied("a change request must name the user who requested it")
+		case cr.Status.Decision != "" || cr.Status.DecidedBy != "":
+			return admission.Denied("a change request cannot be created with a decision")
+		}
+		return admission.Allowed("")
+	}
+	if req.Operation != admissionv1beta1.Update {
+		return admission.Allowed("")
+	}
+	old := &paasv1.SecurityGroupChangeRequest{}
+	if err := v.decoder.DecodeRaw(req.OldObject, old); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	// spec 不可修改，审批结果只能通过 status 子资源设置
+	if !reflect.DeepEqual(cr.Spec, old.Spec) {
+		return admission.Denied("the spec of a change request cannot be changed")
+	}
+	if cr.Status.Decision == old.Status.Decision && cr.Status.DecidedBy == old.Status.DecidedBy {
+		return admission.Allowed("")
+	}
+
+	switch {
+	case old.Status.Decision != "":
+		return admission.Denied(fmt.Sprintf("change request was already %s", old.Status.Decision))
+	case old.Status.Phase != paasv1.ChangeRequestPending:
+		return admission.Denied(fmt.Sprintf("change request is %s", old.Status.Phase))
+	case cr.Status.Decision == "":
+		return admission.Denied("decision must be set with decidedBy")
+	case cr.Status.DecidedBy != req.UserInfo.Username:
+		return admission.Denied(fmt.Sprintf("decidedBy must be set to %q", req.UserInfo.Username))
+	case cr.Spec.RequestedBy == "":
+		return admission.Denied("the change request does not name who requested it, change the spec of the SecurityGroup again")
+	case cr.Spec.RequestedBy == req.UserInfo.Username:
+		return admission.Denied("a change cannot be decided by the user who requested it")
+	case !v.approver(req.UserInfo.Groups):
+		return admission.Denied(fmt.Sprintf("user %q is not in any of the approver groups %v", req.UserInfo.Username, v.ApproverGroups))
+	}
+	return admission.Allowed("")
+}
+
+func (v *SecurityGroupChangeRequestValidator) approver(groups []string) bool {
+	for _, g := range groups {
+		for _, a := range v.ApproverGroups {
+			if g == a {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// InjectDecoder injects the decoder.
+func (v *SecurityGroupChangeRequestValidator) InjectDecoder(d *admission.Decoder) error {
+	v.decoder = d
+	return nil
+}
@@ -0,0 +1,107 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	paasv1 "security-group/api/v1"
+)
+
+const controllerUser = "system:serviceaccount:security-group-system:default"
+
+var metaChangeRequest = metav1.TypeMeta{APIVersion: paasv1.GroupVersion.String(), Kind: "SecurityGroupChangeRequest"}
+
+func changeRequestReview(t *testing.T, op admissionv1beta1.Operation, user string, groups []string, old, cr *paasv1.SecurityGroupChangeRequest) admission.Request {
+	raw := func(cr *paasv1.SecurityGroupChangeRequest) runtime.RawExtension {
+		if cr == nil {
+			return runtime.RawExtension{}
+		}
+		b, err := json.Marshal(cr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return runtime.RawExtension{Raw: b}
+	}
+	return admission.Request{AdmissionRequest: admissionv1beta1.AdmissionRequest{
+		Operation: op,
+		UserInfo:  authenticationv1.UserInfo{Username: user, Groups: groups},
+		Object:    raw(cr),
+		OldObject: raw(old),
+	}}
+}
+
+func TestSecurityGroupChangeRequestValidator(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := paasv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	decoder, err := admission.NewDecoder(scheme)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := &SecurityGroupChangeRequestValidator{ApproverGroups: []string{"approvers"}, ControllerUsername: controllerUser, decoder: decoder}
+
+	request := func(requestedBy, phase, decision, decidedBy string) *paasv1.SecurityGroupChangeRequest {
+		return &paasv1.SecurityGroupChangeRequest{
+			TypeMeta: metaChangeRequest,
+			Spec:     paasv1.SecurityGroupChangeRequestSpec{SecurityGroup: "web", SpecHash: "0123", RequestedBy: requestedBy},
+			Status:   paasv1.SecurityGroupChangeRequestStatus{Phase: phase, Decision: decision, DecidedBy: decidedBy},
+		}
+	}
+	approvers := []string{"approvers"}
+	tests := []struct {
+		name    string
+		req     admission.Request
+		allowed bool
+	}{
+		{name: "controller creates", req: changeRequestReview(t, admissionv1beta1.Create, controllerUser, nil, nil, request("bob", "", "", "")), allowed: true},
+		{name: "user creates", req: changeRequestReview(t, admissionv1beta1.Create, "alice", approvers, nil, request("bob", "", "", ""))},
+		{name: "create without requester", req: changeRequestReview(t, admissionv1beta1.Create, controllerUser, nil, nil, request("", "", "", ""))},
+		{name: "create with decision", req: changeRequestReview(t, admissionv1beta1.Create, controllerUser, nil, nil, request("bob", "", paasv1.DecisionApproved, "alice"))},
+		{name: "approver approves", req: changeRequestReview(t, admissionv1beta1.Update, "alice", approvers,
+			request("bob", paasv1.ChangeRequestPending, "", ""), request("bob", paasv1.ChangeRequestPending, paasv1.DecisionApproved, "alice")), allowed: true},
+		{name: "requester approves", req: changeRequestReview(t, admissionv1beta1.Update, "bob", approvers,
+			request("bob", paasv1.ChangeRequestPending, "", ""), request("bob", paasv1.ChangeRequestPending, paasv1.DecisionApproved, "bob"))},
+		{name: "approve without requester", req: changeRequestReview(t, admissionv1beta1.Update, "alice", approvers,
+			request("", paasv1.ChangeRequestPending, "", ""), request("", paasv1.ChangeRequestPending, paasv1.DecisionApproved, "alice"))},
+		{name: "not an approver", req: changeRequestReview(t, admissionv1beta1.Update, "carol", []string{"dev"},
+			request("bob", paasv1.ChangeRequestPending, "", ""), request("bob", paasv1.ChangeRequestPending, paasv1.DecisionApproved, "carol"))},
+		{name: "decided for someone else", req: changeRequestReview(t, admissionv1beta1.Update, "alice", approvers,
+			request("bob", paasv1.ChangeRequestPending, "", ""), request("bob", paasv1.ChangeRequestPending, paasv1.DecisionApproved, "dave"))},
+		{name: "spec changed", req: changeRequestReview(t, admissionv1beta1.Update, "alice", approvers,
+			request("bob", paasv1.ChangeRequestPending, "", ""), request("alice", paasv1.ChangeRequestPending, "", ""))},
+		{name: "controller sets phase", req: changeRequestReview(t, admissionv1beta1.Update, controllerUser, nil,
+			request("bob", paasv1.ChangeRequestPending, paasv1.DecisionApproved, "alice"), request("bob", paasv1.ChangeRequestApproved, paasv1.DecisionApproved, "alice")), allowed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := v.Handle(context.Background(), tt.req)
+			if resp.Allowed != tt.allowed {
+				t.Errorf("allowed = %v, want %v: %v", resp.Allowed, tt.allowed, resp.Result)
+			}
+		})
+	}
+}